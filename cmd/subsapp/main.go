@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"time"
 
+	"github.com/MosinFAM/subs-app/internal/config"
 	"github.com/MosinFAM/subs-app/internal/db"
 	"github.com/MosinFAM/subs-app/internal/handlers"
 	"github.com/MosinFAM/subs-app/internal/logger"
 	"github.com/MosinFAM/subs-app/internal/middleware"
+	"github.com/MosinFAM/subs-app/internal/rates"
 	"github.com/MosinFAM/subs-app/internal/repo"
 	"github.com/gin-gonic/gin"
 
@@ -30,30 +34,49 @@ import (
 func main() {
 	logger.Init()
 
-	conn, err := db.Connect()
+	cfg, err := config.Load()
+	if err != nil {
+		logger.LogError("Invalid configuration", err, nil)
+		log.Fatal(err)
+	}
+
+	store, err := newRepository(cfg)
 	if err != nil {
 		logger.LogError("Failed to connect to DB", err, nil)
 		log.Fatal(err)
 	}
 
-	repo := repo.NewPostgresRepo(conn)
-	h := &handlers.Handler{Repo: repo}
+	if cfg.ExchangeRatesFile != "" {
+		if err := loadExchangeRates(store, cfg.ExchangeRatesFile); err != nil {
+			logger.LogError("Failed to load exchange rates", err, nil)
+			log.Fatal(err)
+		}
+	}
 
-	r := gin.Default()
-	r.Use(middleware.GinLogger())
+	if cfg.DeletedRetention > 0 {
+		go purgeDeleted(store, cfg.DeletedRetention, cfg.PurgeInterval)
+	}
+	if cfg.IdempotencyTTL > 0 {
+		go purgeIdempotencyKeys(store, cfg.PurgeInterval)
+	}
 
-	subscriptions := r.Group("/subscriptions")
-	{
-		subscriptions.POST("", h.CreateSubscription)
-		subscriptions.GET("", h.ListSubscriptions)
-		subscriptions.GET(":id", h.GetSubscription)
-		subscriptions.PUT(":id", h.UpdateSubscription)
-		subscriptions.DELETE(":id", h.DeleteSubscription)
-		subscriptions.GET("/summary", h.SumSubscriptions)
+	h := &handlers.Handler{
+		Repo:           store,
+		QueryTimeout:   cfg.QueryTimeout,
+		RequireIfMatch: cfg.RequireIfMatch,
+		IdempotencyTTL: cfg.IdempotencyTTL,
 	}
 
+	r := gin.New()
+	r.Use(gin.Logger(), middleware.Recovery())
+	r.Use(middleware.RequestID())
+	r.Use(middleware.GinLogger())
+	r.Use(middleware.AdminAuth(cfg.AdminToken))
+
+	h.RegisterRoutes(r)
+
 	// Swagger docs only in non-prod
-	if os.Getenv("ENV") != "production" {
+	if cfg.Env != "production" {
 		r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	}
 
@@ -62,3 +85,65 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func newRepository(cfg config.Config) (repo.Repository, error) {
+	if cfg.Storage == config.StorageMemory {
+		logger.LogInfo("Using in-memory storage, data is not persisted", nil)
+		return repo.NewMemoryRepo(), nil
+	}
+
+	conn, driver, err := db.Connect(cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if driver == db.DriverSQLite {
+		return repo.NewSQLiteRepo(conn), nil
+	}
+	return repo.NewPostgresRepo(conn), nil
+}
+
+// loadExchangeRates stores the rates from path, replacing those already kept
+// for the same currency and month.
+func loadExchangeRates(store repo.Repository, path string) error {
+	list, err := rates.LoadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := store.SetExchangeRates(context.Background(), list); err != nil {
+		return err
+	}
+	logger.LogInfo("Exchange rates loaded", map[string]interface{}{"file": path, "count": len(list)})
+	return nil
+}
+
+// purgeDeleted removes the subscriptions deleted longer than retention ago,
+// checking every interval for as long as the server runs.
+func purgeDeleted(store repo.Repository, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := store.PurgeDeleted(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			logger.LogError("Failed to purge deleted subscriptions", err, nil)
+		} else if n > 0 {
+			logger.LogInfo("Purged deleted subscriptions", map[string]interface{}{"count": n})
+		}
+		<-ticker.C
+	}
+}
+
+// purgeIdempotencyKeys forgets the expired idempotency keys, checking every
+// interval for as long as the server runs.
+func purgeIdempotencyKeys(store repo.Repository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := store.PurgeIdempotencyKeys(context.Background(), time.Now())
+		if err != nil {
+			logger.LogError("Failed to purge idempotency keys", err, nil)
+		} else if n > 0 {
+			logger.LogInfo("Purged idempotency keys", map[string]interface{}{"count": n})
+		}
+		<-ticker.C
+	}
+}
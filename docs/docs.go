@@ -15,22 +15,82 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/subscriptions": {
+        "/audit": {
             "get": {
-                "description": "Returns all subscriptions for the specified user",
+                "description": "Returns a page of the audit log of all subscription changes, newest first. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "subscriptions"
+                    "audit"
                 ],
-                "summary": "List all subscriptions for a user",
+                "summary": "List audit log",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "User UUID",
-                        "name": "user_id",
-                        "in": "query",
+                        "description": "Filter by subscription ID",
+                        "name": "subscription_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by actor: admin, user:\u003cX-User-ID\u003e, anonymous or system",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "create",
+                            "update",
+                            "delete",
+                            "price_change",
+                            "pause",
+                            "resume",
+                            "restore",
+                            "purge"
+                        ],
+                        "type": "string",
+                        "description": "Filter by action",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by X-Request-ID of the request that made the change",
+                        "name": "request_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "First day, YYYY-MM-DD or MM-YYYY for the start of a month (UTC)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last day, YYYY-MM-DD or MM-YYYY for the end of a month (UTC)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 100,
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
                         "required": true
                     }
                 ],
@@ -38,10 +98,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Subscription"
-                            }
+                            "$ref": "#/definitions/models.AuditPage"
                         }
                     },
                     "400": {
@@ -50,42 +107,103 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/exchange-rates": {
+            "get": {
+                "description": "Returns every exchange rate ordered by currency and month.\nA rate is the price of one USD in the currency and applies from its month until the next rate.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "exchange-rates"
+                ],
+                "summary": "List exchange rates",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ExchangeRate"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
                     }
                 }
             },
-            "post": {
-                "description": "Create a new subscription for a user",
+            "put": {
+                "description": "Stores the given rates, replacing existing ones for the same currency and month. Admin only.\nThe body is a JSON array or, with Content-Type text/csv, a table with currency, month and rate columns.\nEither all rates are stored or none; invalid entries are reported with 422.",
                 "consumes": [
-                    "application/json"
+                    "application/json",
+                    "text/csv"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "subscriptions"
+                    "exchange-rates"
                 ],
-                "summary": "Create a new subscription",
+                "summary": "Add or replace exchange rates",
                 "parameters": [
                     {
-                        "description": "Subscription data",
+                        "description": "Exchange rates",
                         "name": "input",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.Subscription"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ExchangeRate"
+                            }
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Subscription"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ExchangeRate"
+                            }
                         }
                     },
                     "400": {
@@ -94,62 +212,69 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/subscriptions/summary": {
-            "get": {
-                "description": "Calculates the total subscription cost over a given period, optionally filtered by user ID and service name",
+        "/exchange-rates/{currency}/{month}": {
+            "delete": {
+                "description": "Deletes the rate of a currency for one month. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "subscriptions"
+                    "exchange-rates"
                 ],
-                "summary": "Calculate total cost of subscriptions",
+                "summary": "Delete an exchange rate",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Start date in MM-YYYY format",
-                        "name": "from",
-                        "in": "query",
+                        "description": "ISO 4217 currency code",
+                        "name": "currency",
+                        "in": "path",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "End date in MM-YYYY format",
-                        "name": "to",
-                        "in": "query",
+                        "description": "Month in MM-YYYY format",
+                        "name": "month",
+                        "in": "path",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Filter by user ID",
-                        "name": "user_id",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "Filter by service name",
-                        "name": "service_name",
-                        "in": "query"
+                        "description": "Admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Total cost",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "integer"
-                            }
-                        }
+                    "204": {
+                        "description": "No Content"
                     },
                     "400": {
                         "description": "Bad Request",
@@ -157,51 +282,69 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/subscriptions/{id}": {
+        "/services": {
             "get": {
-                "description": "Returns the subscription with the specified ID",
+                "description": "Returns every catalog service ordered by name.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "subscriptions"
-                ],
-                "summary": "Get subscription by ID",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Subscription ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
+                    "services"
                 ],
+                "summary": "List catalog services",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Subscription"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Service"
+                            }
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
                     }
                 }
             },
-            "put": {
-                "description": "Updates an existing subscription by ID",
+            "post": {
+                "description": "Adds a service to the catalog. Admin only.\nSubscriptions whose service_name matches the name or an alias, ignoring case and extra spaces, are linked to the service and take its name.\nA name or alias already used by another service is rejected with 409.",
                 "consumes": [
                     "application/json"
                 ],
@@ -209,32 +352,32 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "subscriptions"
+                    "services"
                 ],
-                "summary": "Update a subscription",
+                "summary": "Add a catalog service",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Subscription ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Updated subscription data",
+                        "description": "Service",
                         "name": "input",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.Subscription"
+                            "$ref": "#/definitions/models.Service"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Subscription"
+                            "$ref": "#/definitions/models.Service"
                         }
                     },
                     "400": {
@@ -243,82 +386,2425 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
                     }
                 }
-            },
-            "delete": {
-                "description": "Deletes the subscription with the specified ID",
+            }
+        },
+        "/services/{id}": {
+            "get": {
+                "description": "Returns the catalog service with the specified ID",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "subscriptions"
+                    "services"
                 ],
-                "summary": "Delete a subscription",
+                "summary": "Get catalog service by ID",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Subscription ID",
+                        "description": "Service ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Service"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
                     }
                 }
-            }
-        }
-    },
-    "definitions": {
-        "models.ErrorResponse": {
-            "type": "object",
-            "properties": {
-                "error": {
-                    "type": "string",
-                    "example": "Invalid input"
-                }
-            }
-        },
-        "models.Subscription": {
-            "type": "object",
-            "properties": {
-                "end_date": {
-                    "description": "формат: MM-YYYY",
-                    "type": "string",
-                    "example": "12-2024"
-                },
-                "id": {
+            },
+            "put": {
+                "description": "Replaces the catalog service with the specified ID and renames the subscriptions linked to it, except deleted ones, which keep their name. Admin only.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "Update a catalog service",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Service",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Service"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Service"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes the catalog service with the specified ID. Linked subscriptions, deleted ones included, keep their service name but lose their service_id. Admin only.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "services"
+                ],
+                "summary": "Delete a catalog service",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions": {
+            "get": {
+                "description": "Returns a page of subscriptions for the specified user, sorted and filtered as requested.\nAdministrators may omit user_id to list subscriptions of all users, and may set include_deleted to list deleted subscriptions that have not been purged yet.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "List subscriptions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User UUID, required for non-admins",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Catalog service UUID",
+                        "name": "service_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Service name substring",
+                        "name": "service_name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Minimum price",
+                        "name": "min_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum price",
+                        "name": "max_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only subscriptions active and not paused on this day (YYYY-MM-DD) or at any time in this month (MM-YYYY)",
+                        "name": "active_on",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only subscriptions with (true) or without (false) an end date",
+                        "name": "has_end_date",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only subscriptions in this category, ignoring case; empty for uncategorized ones",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Only subscriptions with all of these tags, ignoring case (repeat or comma-separate)",
+                        "name": "tag",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 0,
+                        "type": "integer",
+                        "description": "Only subscriptions whose free trial ends between today and this many days from now",
+                        "name": "trial_ends_within",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "start_date",
+                        "description": "Sort by price, start_date or service_name (by character code, so capitals come first), prefix with - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 100,
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also list deleted subscriptions, admin only",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.SubscriptionPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new subscription for a user.\nThe subscription is linked to the catalog service given by service_id or, without it, to the one whose name or alias matches service_name; a linked subscription takes the service's name and, where not given, its default price, currency and category.\nA subscription without a category of its own or from the catalog gets a built-in one if it is a well-known service such as Netflix or Spotify. Categories and tags are stored in lower case.\nInvalid fields are reported with 422 and a per-field error list.\nA request with an Idempotency-Key header can be retried safely: while the key is remembered, a retry with the same subscription data gets the response of the first request instead of creating another subscription, and a request reusing the key for different data fails with 409.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Create a new subscription",
+                "parameters": [
+                    {
+                        "description": "Subscription data",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        }
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unique key of the request, at most 255 characters",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the subscription"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/batch": {
+            "post": {
+                "description": "Runs up to 100 create, update and delete operations, each meaning the same as the single request.\nIn all_or_nothing mode, the default, the operations run in one transaction: if any of them is invalid or fails, none is applied and the response is the error of the failing operation, with the fields named after it, like operations[2].subscription.price.\nIn best_effort mode every operation runs on its own, and the response lists the status of each together with its error, if any.\nThe if_match of an update or delete is the ETag the subscription must still have, as in the If-Match header: otherwise the operation fails with 412, and with REQUIRE_IF_MATCH set an update or delete without it fails with 428.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Create, update and delete subscriptions in bulk",
+                "parameters": [
+                    {
+                        "description": "Operations",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.BatchRequest"
+                        }
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.BatchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/export": {
+            "get": {
+                "description": "Downloads every subscription matching the filters of the list endpoint, in the requested order, as CSV, JSON Lines or an XLSX workbook.\nCSV and XLSX exports have a header row and one column per field, named like the columns read by the import, so an export can be imported again. Text starting with =, +, -, @, a tab or a carriage return, possibly after quotes, gets a leading ' there, so spreadsheets show it rather than run it as a formula; the import drops that quote again. Pauses are only part of JSON Lines exports, which hold one subscription object per line.\nSubscriptions are read and sent in batches rather than all at once. QUERY_TIMEOUT bounds each batch rather than the whole download. Should reading or sending fail once the download has started, the connection is aborted, so the download fails instead of ending early.",
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Export subscriptions",
+                "parameters": [
+                    {
+                        "enum": [
+                            "csv",
+                            "jsonl",
+                            "xlsx"
+                        ],
+                        "type": "string",
+                        "default": "csv",
+                        "description": "File format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "User UUID, required for non-admins",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Catalog service UUID",
+                        "name": "service_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Service name substring",
+                        "name": "service_name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Minimum price",
+                        "name": "min_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum price",
+                        "name": "max_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only subscriptions active and not paused on this day (YYYY-MM-DD) or at any time in this month (MM-YYYY)",
+                        "name": "active_on",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only subscriptions with (true) or without (false) an end date",
+                        "name": "has_end_date",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only subscriptions in this category, ignoring case; empty for uncategorized ones",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Only subscriptions with all of these tags, ignoring case (repeat or comma-separate)",
+                        "name": "tag",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 0,
+                        "type": "integer",
+                        "description": "Only subscriptions whose free trial ends between today and this many days from now",
+                        "name": "trial_ends_within",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "start_date",
+                        "description": "Sort by price, start_date or service_name (by character code, so capitals come first), prefix with - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the export: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also export deleted subscriptions, admin only",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscriptions",
+                        "schema": {
+                            "type": "file"
+                        },
+                        "headers": {
+                            "Content-Disposition": {
+                                "type": "string",
+                                "description": "attachment; filename=subscriptions.csv"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/import": {
+            "post": {
+                "description": "Creates subscriptions from the rows of a CSV file, sent as the file field of a multipart form or as the request body. The first row holds the column headers.\nColumns are matched to subscription fields by name, ignoring case, unless the column parameter maps a field to another header, like price:Cost. Tags are comma-separated within their cell, and rows without a user_id get the one given as a parameter. The ' an export puts before text that would start a formula is dropped.\nEvery row is validated like a created subscription. The valid rows are created in one transaction, and if any of them fails none is; the invalid ones are reported along with the errors. With dry_run the transaction is rolled back, so the response shows what would be created, or the error the import would fail with, and nothing is kept.",
+                "consumes": [
+                    "multipart/form-data",
+                    "text/csv",
+                    "text/plain"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Import subscriptions from CSV",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "CSV file, for multipart requests",
+                        "name": "file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Header of the column holding a field, as field:header (repeat or comma-separate)",
+                        "name": "column",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": ",",
+                        "description": "Field delimiter, a single character",
+                        "name": "delimiter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "User of the rows without a user_id",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only validate the rows",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ImportResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/summary": {
+            "get": {
+                "description": "Calculates the subscription cost over a given period month by month, optionally filtered by user ID and service name.\nMonths that a subscription or the period covers only partly are charged for the share of days covered.\nPrice changes recorded under /subscriptions/{id}/prices apply from their effective date, splitting the month they fall in.\nDays within a pause recorded under /subscriptions/{id}/pause are not charged.\nDays up to trial_end_date are free, and the intro_months that follow are charged at intro_price.\nEvery subscription is charged its price normalized to one month (yearly prices are divided by 12, weekly ones multiplied by 52/12 and so on) for each month it is active within the period.\nWith currency every amount is converted at the exchange rate effective for the month it is charged for; without it amounts in different currencies are added up as they are.\nWith group_by the response also contains subtotals for every combination of the grouped fields.\nGrouped by tag, a subscription counts towards the group of each of its tags, so the subtotals may add up to more than the total.\nDeleted subscriptions are left out unless an administrator sets include_deleted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Calculate total cost of subscriptions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First day of the period, YYYY-MM-DD or MM-YYYY for the start of a month",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last day of the period, YYYY-MM-DD or MM-YYYY for the end of a month",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by user ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by catalog service ID",
+                        "name": "service_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by service name",
+                        "name": "service_name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by category, ignoring case",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Only subscriptions with all of these tags, ignoring case (repeat or comma-separate)",
+                        "name": "tag",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ISO 4217 currency to convert the totals to",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Group subtotals by service_name, user_id, currency, month, category and/or tag (repeat or comma-separate)",
+                        "name": "group_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also count deleted subscriptions, admin only",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.SubscriptionSummary"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/{id}": {
+            "get": {
+                "description": "Returns the subscription with the specified ID. A deleted subscription is only returned to administrators with include_deleted.\nThe ETag header carries the version of the subscription; with If-None-Match listing it the response is 304 without a body.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Get subscription by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also return a deleted subscription, admin only",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin token",
+                        "name": "X-Admin-Token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a cached copy",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the subscription"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified",
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the subscription"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Updates an existing subscription by ID.\nInvalid fields are reported with 422 and a per-field error list. Dates that would leave a price change or a pause outside the subscription are rejected with 400.\nWith If-Match set to the ETag of the subscription the update only succeeds if nobody changed it since, and fails with 412 otherwise. The server may be configured to require If-Match and reject updates without it with 428.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Update a subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated subscription data",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        }
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the subscription must still have",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the subscription"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes the subscription with the specified ID.\nThe subscription is hidden from listings and summaries and can be restored with /subscriptions/{id}/restore until the retention period passes and it is purged.\nIf-Match is honored and may be required as for updates.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Delete a subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the subscription must still have",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Changes only some fields of a subscription. With application/merge-patch+json (or plain application/json) the body is a JSON Merge Patch (RFC 7396): fields set to null are cleared and absent fields keep their values. With application/json-patch+json it is a JSON Patch (RFC 6902) applied to the subscription as returned by GET.\nThe patched subscription is validated as a whole, and invalid fields are reported with 422. While service_id is set the service name comes from the catalog; clear service_id to name a service outside of it.\nDates are checked against price changes and pauses, and If-Match is honored and may be required, as for updates. A patch whose test operation fails is rejected with 409.",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json",
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Patch a subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Merge patch or JSON Patch",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the subscription must still have",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the subscription"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/{id}/history": {
+            "get": {
+                "description": "Returns the audit entries of the subscription, oldest first, including those of a deleted or purged subscription. A subscription without entries gets an empty list; 404 means there is no such subscription.\nEvery entry lists the changed fields with their values before and after the change; dates are always YYYY-MM-DD.\nThe actor is admin for requests with the admin token, user:\u003cX-User-ID\u003e for requests with that header and anonymous otherwise.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Get subscription history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditEntry"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/{id}/pause": {
+            "post": {
+                "description": "Records a pause from from to to, both included; without to the subscription stays paused until it is resumed.\nPaused days are not charged in summaries, and a subscription paused throughout a day or month is not listed as active on it.\nA pause must lie within the subscription and must not overlap another one; a pause starting the day after another ends is merged with it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Pause a subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Pause",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Pause"
+                        }
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the subscription"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/{id}/prices": {
+            "get": {
+                "description": "Returns the price changes of the subscription ordered by date. Before the first change the subscription's own price applies.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "List price changes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.PriceChange"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Sets a new price of the subscription from effective_from on, so summaries charge every month at the price in effect.\nThe change must take effect after start_date and no later than end_date.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Add a price change",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Price change",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PriceChange"
+                        }
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.PriceChange"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/{id}/restore": {
+            "post": {
+                "description": "Undoes the deletion of a subscription that has not been purged yet.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Restore a deleted subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the subscription"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The subscription is not deleted",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/subscriptions/{id}/resume": {
+            "post": {
+                "description": "Ends the pause that the day on falls in, so the subscription is charged again from that day. A pause starting on that day is removed.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "subscriptions"
+                ],
+                "summary": "Resume a subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "First day to charge again",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ResumeRequest"
+                        }
+                    },
+                    {
+                        "enum": [
+                            "month",
+                            "iso"
+                        ],
+                        "type": "string",
+                        "description": "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header",
+                        "name": "date_format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Subscription"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the subscription"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The subscription is not paused on that day",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "models.AuditEntry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "create, update, delete, price_change, pause, resume, restore или purge",
+                    "type": "string",
+                    "example": "update"
+                },
+                "actor": {
+                    "type": "string",
+                    "example": "admin"
+                },
+                "at": {
+                    "type": "string",
+                    "example": "2024-06-01T12:00:00Z"
+                },
+                "changes": {
+                    "description": "Изменённые поля подписки: значения до и после",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.FieldChange"
+                    }
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "request_id": {
+                    "type": "string",
+                    "example": "7d0e1f2a-3b4c-4d5e-8f90-a1b2c3d4e5f6"
+                },
+                "subscription_id": {
                     "type": "string",
                     "example": "123e4567-e89b-12d3-a456-426614174000"
+                }
+            }
+        },
+        "models.AuditPage": {
+            "type": "object",
+            "properties": {
+                "has_more": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.AuditEntry"
+                    }
+                },
+                "limit": {
+                    "type": "integer",
+                    "example": 20
+                },
+                "next_cursor": {
+                    "description": "Курсор следующей страницы, отсутствует на последней странице",
+                    "type": "string",
+                    "example": "41"
+                }
+            }
+        },
+        "models.BatchOperation": {
+            "type": "object",
+            "required": [
+                "op"
+            ],
+            "properties": {
+                "id": {
+                    "description": "Подписка для update и delete",
+                    "type": "string",
+                    "example": "123e4567-e89b-12d3-a456-426614174000"
+                },
+                "if_match": {
+                    "description": "ETag подписки для update и delete, как в заголовке If-Match; при REQUIRE_IF_MATCH без него операция завершается с 428",
+                    "type": "string",
+                    "example": "\"3\""
+                },
+                "op": {
+                    "description": "create, update или delete",
+                    "type": "string",
+                    "enum": [
+                        "create",
+                        "update",
+                        "delete"
+                    ],
+                    "example": "update"
+                },
+                "subscription": {
+                    "description": "Данные подписки для create и update",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Subscription"
+                        }
+                    ]
+                }
+            }
+        },
+        "models.BatchRequest": {
+            "type": "object",
+            "required": [
+                "operations"
+            ],
+            "properties": {
+                "mode": {
+                    "description": "all_or_nothing (по умолчанию) — все операции в одной транзакции, при первой ошибке ни одна не применяется;\nbest_effort — каждая операция выполняется отдельно",
+                    "type": "string",
+                    "enum": [
+                        "all_or_nothing",
+                        "best_effort"
+                    ],
+                    "example": "best_effort"
+                },
+                "operations": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/models.BatchOperation"
+                    }
+                }
+            }
+        },
+        "models.BatchResponse": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.BatchResult"
+                    }
+                },
+                "succeeded": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "models.BatchResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/models.ErrorResponse"
+                },
+                "status": {
+                    "description": "HTTP-статус, с которым завершился бы отдельный запрос",
+                    "type": "integer",
+                    "example": 200
+                },
+                "subscription": {
+                    "description": "после create и update",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Subscription"
+                        }
+                    ]
+                }
+            }
+        },
+        "models.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "invalid_input"
+                },
+                "error": {
+                    "type": "string",
+                    "example": "Invalid input"
+                },
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FieldError"
+                    }
+                }
+            }
+        },
+        "models.ExchangeRate": {
+            "type": "object",
+            "required": [
+                "currency",
+                "month"
+            ],
+            "properties": {
+                "currency": {
+                    "type": "string",
+                    "example": "EUR"
+                },
+                "month": {
+                    "description": "формат: MM-YYYY",
+                    "type": "string",
+                    "example": "01-2024"
+                },
+                "rate": {
+                    "type": "number",
+                    "example": 0.92
+                }
+            }
+        },
+        "models.FieldChange": {
+            "type": "object",
+            "properties": {
+                "after": {
+                    "type": "object"
+                },
+                "before": {
+                    "type": "object"
+                }
+            }
+        },
+        "models.FieldError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "date"
+                },
+                "field": {
+                    "type": "string",
+                    "example": "start_date"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "must be a date in YYYY-MM-DD or MM-YYYY format"
+                }
+            }
+        },
+        "models.ImportResponse": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "description": "при dry_run всегда 0",
+                    "type": "integer",
+                    "example": 11
+                },
+                "dry_run": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "invalid": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "rows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ImportRow"
+                    }
+                },
+                "valid": {
+                    "type": "integer",
+                    "example": 11
+                }
+            }
+        },
+        "models.ImportRow": {
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FieldError"
+                    }
+                },
+                "line": {
+                    "description": "номер строки в файле; строка заголовка — 1",
+                    "type": "integer",
+                    "example": 2
+                },
+                "status": {
+                    "description": "created, would_create (при dry_run) или invalid",
+                    "type": "string",
+                    "example": "created"
+                },
+                "subscription": {
+                    "description": "созданная подписка или, при dry_run, подписка без id, какой она была бы создана",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Subscription"
+                        }
+                    ]
+                }
+            }
+        },
+        "models.MonthlyCost": {
+            "type": "object",
+            "properties": {
+                "month": {
+                    "description": "формат: MM-YYYY",
+                    "type": "string",
+                    "example": "01-2024"
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 1299
+                }
+            }
+        },
+        "models.Pause": {
+            "type": "object",
+            "required": [
+                "from"
+            ],
+            "properties": {
+                "from": {
+                    "description": "формат: YYYY-MM-DD или MM-YYYY",
+                    "type": "string",
+                    "example": "2024-06-01"
+                },
+                "to": {
+                    "description": "включительно; месяц MM-YYYY — до его конца",
+                    "type": "string",
+                    "example": "2024-08-31"
+                }
+            }
+        },
+        "models.PriceChange": {
+            "type": "object",
+            "required": [
+                "effective_from"
+            ],
+            "properties": {
+                "effective_from": {
+                    "description": "формат: YYYY-MM-DD или MM-YYYY",
+                    "type": "string",
+                    "example": "2024-06-01"
+                },
+                "price": {
+                    "type": "integer",
+                    "example": 1499
+                }
+            }
+        },
+        "models.ResumeRequest": {
+            "type": "object",
+            "required": [
+                "on"
+            ],
+            "properties": {
+                "on": {
+                    "description": "первый оплачиваемый день после паузы",
+                    "type": "string",
+                    "example": "2024-09-01"
+                }
+            }
+        },
+        "models.Service": {
+            "type": "object",
+            "properties": {
+                "aliases": {
+                    "type": "array",
+                    "maxItems": 50,
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "Netflix Premium",
+                        "NFLX"
+                    ]
+                },
+                "category": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "example": "video"
+                },
+                "default_currency": {
+                    "type": "string",
+                    "example": "USD"
+                },
+                "default_price": {
+                    "description": "Цена и валюта по умолчанию для связанных подписок; цену можно опустить только при service_id",
+                    "type": "integer",
+                    "example": 1299
+                },
+                "homepage": {
+                    "type": "string",
+                    "maxLength": 2048,
+                    "example": "https://www.netflix.com"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "5b2c6a0e-8f0a-4c57-9a4e-1d2f3b4c5d6e"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 255,
+                    "example": "Netflix"
+                }
+            }
+        },
+        "models.Subscription": {
+            "type": "object",
+            "required": [
+                "start_date",
+                "user_id"
+            ],
+            "properties": {
+                "billing_months": {
+                    "description": "Длина периода в месяцах, задаётся только для custom",
+                    "type": "integer",
+                    "maximum": 120,
+                    "example": 6
+                },
+                "billing_period": {
+                    "description": "Период оплаты: weekly, monthly (по умолчанию), quarterly, yearly или custom",
+                    "type": "string",
+                    "enum": [
+                        "weekly",
+                        "monthly",
+                        "quarterly",
+                        "yearly",
+                        "custom"
+                    ],
+                    "example": "yearly"
+                },
+                "category": {
+                    "description": "Категория; если не задана, берётся из каталога или из списка известных сервисов",
+                    "type": "string",
+                    "maxLength": 100,
+                    "example": "streaming"
+                },
+                "currency": {
+                    "description": "ISO 4217, по умолчанию USD",
+                    "type": "string",
+                    "example": "EUR"
+                },
+                "deleted_at": {
+                    "description": "Время удаления; есть только у удалённых подписок, видимых с include_deleted, и в теле запроса игнорируется",
+                    "type": "string",
+                    "example": "2024-06-01T12:00:00Z"
+                },
+                "end_date": {
+                    "description": "включительно; месяц MM-YYYY — до его конца",
+                    "type": "string",
+                    "example": "2024-12-31"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "123e4567-e89b-12d3-a456-426614174000"
+                },
+                "intro_months": {
+                    "type": "integer",
+                    "maximum": 120,
+                    "example": 3
+                },
+                "intro_price": {
+                    "description": "Вводная цена за период оплаты, действует intro_months месяцев после пробного периода",
+                    "type": "integer",
+                    "minimum": 0,
+                    "example": 499
+                },
+                "pauses": {
+                    "description": "Паузы по порядку дат; задаются через /pause и /resume и в теле запроса игнорируются",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Pause"
+                    }
                 },
                 "price": {
-                    "description": "Цена в центах",
+                    "description": "Цена в сотых долях валюты за один период оплаты",
                     "type": "integer",
                     "example": 1299
                 },
+                "service_id": {
+                    "description": "сервис из каталога",
+                    "type": "string",
+                    "example": "5b2c6a0e-8f0a-4c57-9a4e-1d2f3b4c5d6e"
+                },
                 "service_name": {
+                    "description": "при service_id берётся из каталога",
                     "type": "string",
+                    "maxLength": 255,
                     "example": "Netflix"
                 },
                 "start_date": {
+                    "description": "формат: YYYY-MM-DD или MM-YYYY",
+                    "type": "string",
+                    "example": "2024-01-20"
+                },
+                "tags": {
+                    "description": "Произвольные метки без запятых; хранятся в нижнем регистре без повторов",
+                    "type": "array",
+                    "maxItems": 20,
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "family",
+                        "work"
+                    ]
+                },
+                "trial_end_date": {
+                    "description": "Последний день бесплатного пробного периода, включительно; месяц MM-YYYY — до его конца",
+                    "type": "string",
+                    "example": "2024-02-19"
+                },
+                "user_id": {
+                    "type": "string",
+                    "example": "987e6543-e21b-12d3-a456-426614174999"
+                }
+            }
+        },
+        "models.SubscriptionPage": {
+            "type": "object",
+            "properties": {
+                "has_more": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Subscription"
+                    }
+                },
+                "limit": {
+                    "type": "integer",
+                    "example": 20
+                },
+                "next_cursor": {
+                    "description": "Курсор следующей страницы, отсутствует на последней странице",
+                    "type": "string",
+                    "example": "eyJzIjoicHJpY2UiLCJ2IjoiMTI5OSIsImlkIjoiMTIzIn0"
+                }
+            }
+        },
+        "models.SubscriptionSummary": {
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "description": "Валюта, в которую пересчитаны суммы, если она была запрошена",
+                    "type": "string",
+                    "example": "EUR"
+                },
+                "groups": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.SummaryGroup"
+                    }
+                },
+                "months": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.MonthlyCost"
+                    }
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 15588
+                }
+            }
+        },
+        "models.SummaryGroup": {
+            "type": "object",
+            "properties": {
+                "category": {
+                    "description": "пустая у подписок без категории",
+                    "type": "string",
+                    "example": "streaming"
+                },
+                "currency": {
+                    "description": "исходная валюта подписок",
+                    "type": "string",
+                    "example": "EUR"
+                },
+                "month": {
                     "description": "формат: MM-YYYY",
                     "type": "string",
                     "example": "01-2024"
                 },
+                "service_name": {
+                    "type": "string",
+                    "example": "Netflix"
+                },
+                "tag": {
+                    "description": "пустая у подписок без меток",
+                    "type": "string",
+                    "example": "family"
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 1299
+                },
                 "user_id": {
                     "type": "string",
                     "example": "987e6543-e21b-12d3-a456-426614174999"
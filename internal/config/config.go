@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultQueryTimeout     = 5 * time.Second
+	defaultDeletedRetention = 30 * 24 * time.Hour
+	defaultPurgeInterval    = time.Hour
+	defaultIdempotencyTTL   = 24 * time.Hour
+)
+
+// Storage backends selectable with the STORAGE variable.
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
+type Config struct {
+	Env string
+	// Storage selects the repository implementation. The memory backend
+	// needs no database and loses all data on restart.
+	Storage     string
+	DatabaseURL string
+	AdminToken  string
+	// ExchangeRatesFile is a CSV or JSON file with exchange rates loaded
+	// into the storage at startup.
+	ExchangeRatesFile string
+	// QueryTimeout bounds the repository work done for a single request.
+	// Zero disables the deadline.
+	QueryTimeout time.Duration
+	// RequireIfMatch rejects updates and deletes without an If-Match header.
+	RequireIfMatch bool
+	// DeletedRetention is how long deleted subscriptions can be restored
+	// before the purge removes them for good. Zero disables the purge.
+	DeletedRetention time.Duration
+	// PurgeInterval is how often the purge looks for expired subscriptions
+	// and idempotency keys.
+	PurgeInterval time.Duration
+	// IdempotencyTTL is how long the Idempotency-Key of a create request is
+	// remembered. Zero disables idempotency keys.
+	IdempotencyTTL time.Duration
+}
+
+// Load reads the configuration from environment variables.
+func Load() (Config, error) {
+	cfg := Config{
+		Env:               os.Getenv("ENV"),
+		Storage:           os.Getenv("STORAGE"),
+		DatabaseURL:       os.Getenv("DATABASE_URL"),
+		AdminToken:        os.Getenv("ADMIN_TOKEN"),
+		ExchangeRatesFile: os.Getenv("EXCHANGE_RATES_FILE"),
+		QueryTimeout:      defaultQueryTimeout,
+		DeletedRetention:  defaultDeletedRetention,
+		PurgeInterval:     defaultPurgeInterval,
+		IdempotencyTTL:    defaultIdempotencyTTL,
+	}
+
+	switch cfg.Storage {
+	case "":
+		cfg.Storage = StoragePostgres
+	case StoragePostgres, StorageMemory:
+	default:
+		return cfg, fmt.Errorf("unknown STORAGE %q", cfg.Storage)
+	}
+
+	if v := os.Getenv("QUERY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid QUERY_TIMEOUT %q", v)
+		}
+		cfg.QueryTimeout = d
+	}
+	if v := os.Getenv("REQUIRE_IF_MATCH"); v != "" {
+		require, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid REQUIRE_IF_MATCH %q", v)
+		}
+		cfg.RequireIfMatch = require
+	}
+	if v := os.Getenv("DELETED_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid DELETED_RETENTION %q", v)
+		}
+		cfg.DeletedRetention = d
+	}
+	if v := os.Getenv("PURGE_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid PURGE_INTERVAL %q", v)
+		}
+		cfg.PurgeInterval = d
+	}
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid IDEMPOTENCY_TTL %q", v)
+		}
+		cfg.IdempotencyTTL = d
+	}
+
+	return cfg, nil
+}
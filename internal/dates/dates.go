@@ -0,0 +1,95 @@
+// Package dates parses and formats the calendar dates used by subscriptions.
+// Clients may send either a full ISO-8601 date or, for backward
+// compatibility, a bare MM-YYYY month.
+package dates
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// MonthLayout is the legacy MM-YYYY format.
+	MonthLayout = "01-2006"
+	// DayLayout is the ISO-8601 calendar date format.
+	DayLayout = "2006-01-02"
+)
+
+// Output formats a client can ask for.
+const (
+	FormatMonth = "month"
+	FormatISO   = "iso"
+)
+
+var ErrInvalid = errors.New("expected YYYY-MM-DD or MM-YYYY")
+
+// Parse reads an ISO-8601 date, an RFC 3339 timestamp (only its date is
+// kept) or an MM-YYYY month. The boolean reports the last case, in which the
+// first day of the month is returned.
+func Parse(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(DayLayout, value); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), false, nil
+	}
+	if t, err := time.Parse(MonthLayout, value); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, ErrInvalid
+}
+
+// ParseStart parses the first day of a period: a month stands for its first
+// day.
+func ParseStart(value string) (time.Time, error) {
+	t, _, err := Parse(value)
+	return t, err
+}
+
+// ParseEnd parses the last day of a period: a month stands for its last day.
+func ParseEnd(value string) (time.Time, error) {
+	t, monthOnly, err := Parse(value)
+	if err != nil || !monthOnly {
+		return t, err
+	}
+	return EndOfMonth(t), nil
+}
+
+// EndOfMonth returns the last day of the month t falls in.
+func EndOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location())
+}
+
+// AddMonths moves t by n months, keeping the day of month unless the target
+// month is shorter, in which case it ends on that month's last day.
+func AddMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, t.Location())
+	if last := EndOfMonth(first); t.Day() > last.Day() {
+		return last
+	}
+	return first.AddDate(0, 0, t.Day()-1)
+}
+
+// Today returns the current day in UTC, the zone all dates are kept in.
+func Today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ValidFormat reports whether format is a known output format.
+func ValidFormat(format string) bool {
+	return format == FormatMonth || format == FormatISO
+}
+
+// Reformat rewrites a date in the given output format. Values that cannot be
+// parsed are returned unchanged.
+func Reformat(value, format string) string {
+	t, _, err := Parse(value)
+	if err != nil {
+		return value
+	}
+	if format == FormatISO {
+		return t.Format(DayLayout)
+	}
+	return t.Format(MonthLayout)
+}
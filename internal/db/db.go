@@ -3,30 +3,82 @@ package db
 import (
 	"database/sql"
 	"log"
-	"os"
+	"strings"
 
 	_ "github.com/lib/pq"
 	"github.com/pressly/goose"
+	_ "modernc.org/sqlite"
 )
 
-func Connect() (*sql.DB, error) {
-	dsn := os.Getenv("DATABASE_URL")
-	connStr := dsn
-	db, err := sql.Open("postgres", connStr)
+// Supported database drivers, chosen by the DSN scheme.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+const sqliteScheme = "sqlite:"
+
+// Driver returns the driver for dsn: the sqlite: scheme (for example
+// sqlite:///var/lib/subs.db or sqlite::memory:) selects SQLite, anything
+// else is handed to PostgreSQL.
+func Driver(dsn string) string {
+	if strings.HasPrefix(dsn, sqliteScheme) {
+		return DriverSQLite
+	}
+	return DriverPostgres
+}
+
+// Connect opens the database described by dsn, applies the migrations for
+// its driver and reports which driver was used.
+func Connect(dsn string) (*sql.DB, string, error) {
+	driver := Driver(dsn)
+	dir := "migrations"
+	if driver == DriverSQLite {
+		dsn = sqliteDSN(dsn)
+		dir = "migrations/sqlite"
+	}
+
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
-		return nil, err
+		return nil, driver, err
+	}
+	if driver == DriverSQLite {
+		// SQLite allows a single writer; one connection avoids SQLITE_BUSY
+		// and keeps :memory: databases alive between queries.
+		db.SetMaxOpenConns(1)
 	}
 
 	if err := db.Ping(); err != nil {
-		return nil, err
+		return nil, driver, err
 	}
 
-	log.Println("Connected to PostgreSQL successfully!")
+	log.Printf("Connected to %s successfully!", driver)
 
-	if err := goose.Up(db, "migrations"); err != nil {
+	if err := goose.SetDialect(gooseDialect(driver)); err != nil {
+		return nil, driver, err
+	}
+	if err := goose.Up(db, dir); err != nil {
 		log.Fatalf("Failed to apply migrations: %v", err)
-		return nil, err
+		return nil, driver, err
+	}
+
+	return db, driver, nil
+}
+
+// sqliteDSN turns a sqlite: DSN into the form the driver expects, enabling
+// the sortable time format the repository relies on.
+func sqliteDSN(dsn string) string {
+	path := strings.TrimPrefix(strings.TrimPrefix(dsn, sqliteScheme), "//")
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
 	}
+	return path + sep + "_time_format=sqlite&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
 
-	return db, nil
+func gooseDialect(driver string) string {
+	if driver == DriverSQLite {
+		return "sqlite3"
+	}
+	return "postgres"
 }
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/MosinFAM/subs-app/internal/dates"
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get subscription history
+// @Description Returns the audit entries of the subscription, oldest first, including those of a deleted or purged subscription. A subscription without entries gets an empty list; 404 means there is no such subscription.
+// @Description Every entry lists the changed fields with their values before and after the change; dates are always YYYY-MM-DD.
+// @Description The actor is admin for requests with the admin token, user:<X-User-ID> for requests with that header and anonymous otherwise.
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {array} models.AuditEntry
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/history [get]
+func (h *Handler) GetSubscriptionHistory(c *gin.Context) {
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	history, err := h.Repo.ListSubscriptionHistory(ctx, c.Param("id"))
+	if err != nil {
+		handleError(ctx, c, err, "Could not fetch subscription history")
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// @Summary List audit log
+// @Description Returns a page of the audit log of all subscription changes, newest first. Admin only.
+// @Tags audit
+// @Produce json
+// @Param subscription_id query string false "Filter by subscription ID"
+// @Param actor query string false "Filter by actor: admin, user:<X-User-ID>, anonymous or system"
+// @Param action query string false "Filter by action" Enums(create, update, delete, price_change, pause, resume, restore, purge)
+// @Param request_id query string false "Filter by X-Request-ID of the request that made the change"
+// @Param from query string false "First day, YYYY-MM-DD or MM-YYYY for the start of a month (UTC)"
+// @Param to query string false "Last day, YYYY-MM-DD or MM-YYYY for the end of a month (UTC)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size" default(20) maximum(100)
+// @Param X-Admin-Token header string true "Admin token"
+// @Success 200 {object} models.AuditPage
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /audit [get]
+func (h *Handler) ListAuditEntries(c *gin.Context) {
+	var f models.AuditListRequest
+	if err := c.ShouldBindQuery(&f); err != nil || f.Limit < 0 {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query")
+		return
+	}
+	for _, d := range []*string{f.From, f.To} {
+		if d == nil {
+			continue
+		}
+		if _, _, err := dates.Parse(*d); err != nil {
+			respondError(c, http.StatusBadRequest, models.CodeInvalidDate, "Invalid from or to")
+			return
+		}
+	}
+	if f.Limit == 0 {
+		f.Limit = models.DefaultListLimit
+	}
+	f.Limit = min(f.Limit, models.MaxListLimit)
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	page, err := h.Repo.ListAuditEntries(ctx, f)
+	if err != nil {
+		handleError(ctx, c, err, "Could not fetch audit log")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
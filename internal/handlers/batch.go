@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/MosinFAM/subs-app/internal/logger"
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/repo"
+	"github.com/MosinFAM/subs-app/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Create, update and delete subscriptions in bulk
+// @Description Runs up to 100 create, update and delete operations, each meaning the same as the single request.
+// @Description In all_or_nothing mode, the default, the operations run in one transaction: if any of them is invalid or fails, none is applied and the response is the error of the failing operation, with the fields named after it, like operations[2].subscription.price.
+// @Description In best_effort mode every operation runs on its own, and the response lists the status of each together with its error, if any.
+// @Description The if_match of an update or delete is the ETag the subscription must still have, as in the If-Match header: otherwise the operation fails with 412, and with REQUIRE_IF_MATCH set an update or delete without it fails with 428.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param input body models.BatchRequest true "Operations"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Success 200 {object} models.BatchResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /subscriptions/batch [post]
+func (h *Handler) BatchSubscriptions(c *gin.Context) {
+	var req models.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return
+	}
+	if fields := validation.Struct(req); fields != nil {
+		respondValidation(c, fields)
+		return
+	}
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	checks := make([]batchCheck, len(req.Operations))
+	for i, op := range req.Operations {
+		checks[i] = h.checkBatchOperation(op)
+	}
+	var results []models.BatchResult
+	if req.Mode == models.BatchBestEffort {
+		results = h.runBestEffort(ctx, c, req.Operations, checks)
+	} else {
+		if results, ok = h.runAllOrNothing(ctx, c, req.Operations, checks); !ok {
+			return
+		}
+	}
+
+	resp := models.BatchResponse{Results: results}
+	for _, res := range results {
+		if res.Subscription != nil {
+			formatDates(res.Subscription, format)
+		}
+		if res.Status < http.StatusBadRequest {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// batchCheck is what checking an operation before running it found.
+type batchCheck struct {
+	fields []models.FieldError
+	// precondition is the error of an if_match that cannot be satisfied.
+	precondition *errorMapping
+	// version is the version the subscription must have, 0 for any.
+	version int
+}
+
+// checkBatchOperation validates op and reads its if_match the way
+// ifMatchVersion reads the header of a single request.
+func (h *Handler) checkBatchOperation(op models.BatchOperation) batchCheck {
+	check := batchCheck{fields: validation.Struct(op)}
+	if op.Op != models.BatchUpdate && op.Op != models.BatchDelete {
+		return check
+	}
+	if op.IfMatch == "" {
+		if h.RequireIfMatch {
+			check.precondition = &errorMapping{
+				status: http.StatusPreconditionRequired, code: models.CodePreconditionRequired, message: "if_match required",
+			}
+		}
+		return check
+	}
+	version, ok := parseIfMatch(strings.TrimSpace(op.IfMatch))
+	if !ok {
+		check.precondition = &errorMapping{
+			status: http.StatusPreconditionFailed, code: models.CodePreconditionFailed, message: "Precondition failed",
+		}
+	}
+	check.version = version
+	return check
+}
+
+// runAllOrNothing runs ops in one transaction. It responds with the error of
+// the first invalid or failing operation and returns false if there is one.
+func (h *Handler) runAllOrNothing(ctx context.Context, c *gin.Context, ops []models.BatchOperation,
+	checks []batchCheck) ([]models.BatchResult, bool) {
+	var fields []models.FieldError
+	for i, check := range checks {
+		for _, f := range check.fields {
+			f.Field = fmt.Sprintf("operations[%d].%s", i, f.Field)
+			fields = append(fields, f)
+		}
+	}
+	if fields != nil {
+		respondValidation(c, fields)
+		return nil, false
+	}
+	for i, check := range checks {
+		if check.precondition != nil {
+			respondBatchFailure(c, i, *check.precondition)
+			return nil, false
+		}
+	}
+
+	results := make([]models.BatchResult, len(ops))
+	failed := 0
+	err := h.Repo.InTransaction(ctx, func(tx repo.Repository) error {
+		for i, op := range ops {
+			res, err := runBatchOperation(ctx, tx, op, checks[i].version)
+			if err != nil {
+				failed = i
+				return err
+			}
+			results[i] = res
+		}
+		return nil
+	})
+	if err == nil {
+		return results, true
+	}
+	m, ok := lookupError(ctx, err)
+	if !ok {
+		handleError(ctx, c, err, "Batch failed")
+		return nil, false
+	}
+	respondBatchFailure(c, failed, m)
+	return nil, false
+}
+
+// respondBatchFailure reports that operation i failed with m, undoing the
+// whole batch.
+func respondBatchFailure(c *gin.Context, i int, m errorMapping) {
+	c.JSON(m.status, models.ErrorResponse{
+		Error:  m.message,
+		Code:   m.code,
+		Fields: []models.FieldError{{Field: fmt.Sprintf("operations[%d]", i), Code: m.code, Message: m.message}},
+	})
+}
+
+// runBestEffort runs each of ops on its own and reports how each went.
+func (h *Handler) runBestEffort(ctx context.Context, c *gin.Context, ops []models.BatchOperation,
+	checks []batchCheck) []models.BatchResult {
+	results := make([]models.BatchResult, len(ops))
+	for i, op := range ops {
+		if checks[i].fields != nil {
+			results[i] = models.BatchResult{
+				Status: http.StatusUnprocessableEntity,
+				Error:  &models.ErrorResponse{Error: "Validation failed", Code: models.CodeValidation, Fields: checks[i].fields},
+			}
+			continue
+		}
+		if m := checks[i].precondition; m != nil {
+			results[i] = models.BatchResult{Status: m.status, Error: &models.ErrorResponse{Error: m.message, Code: m.code}}
+			continue
+		}
+		res, err := runBatchOperation(ctx, h.Repo, op, checks[i].version)
+		if err != nil {
+			res = batchError(ctx, c, i, err)
+		}
+		results[i] = res
+	}
+	return results
+}
+
+// runBatchOperation applies a valid operation through r, expecting the
+// subscription at version unless it is 0.
+func runBatchOperation(ctx context.Context, r repo.Repository, op models.BatchOperation, version int) (models.BatchResult, error) {
+	if version > 0 {
+		ctx = repo.WithExpectedVersion(ctx, version)
+	}
+	switch op.Op {
+	case models.BatchCreate:
+		sub, err := r.CreateSubscription(ctx, *op.Subscription)
+		return models.BatchResult{Status: http.StatusOK, Subscription: &sub}, err
+	case models.BatchUpdate:
+		s := *op.Subscription
+		s.ID = op.ID
+		sub, err := r.UpdateSubscription(ctx, s)
+		return models.BatchResult{Status: http.StatusOK, Subscription: &sub}, err
+	default:
+		return models.BatchResult{Status: http.StatusNoContent}, r.DeleteSubscription(ctx, op.ID)
+	}
+}
+
+// batchError is the result of operation i that failed with err. Errors
+// without a mapping are logged and reported as a 500.
+func batchError(ctx context.Context, c *gin.Context, i int, err error) models.BatchResult {
+	m, ok := lookupError(ctx, err)
+	if !ok {
+		logger.LogError("Batch operation failed", err, map[string]interface{}{
+			"method":    c.Request.Method,
+			"path":      c.Request.URL.Path,
+			"operation": i,
+		})
+		m = errorMapping{status: http.StatusInternalServerError, code: models.CodeInternal, message: "Operation failed"}
+	}
+	return models.BatchResult{Status: m.status, Error: &models.ErrorResponse{Error: m.message, Code: m.code}}
+}
@@ -0,0 +1,856 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/middleware"
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const e2eUserID = "987e6543-e21b-12d3-a456-426614174999"
+
+func newTestServer() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	r.Use(middleware.AdminAuth("secret"))
+	h := &Handler{Repo: repo.NewMemoryRepo(), IdempotencyTTL: time.Hour}
+	h.RegisterRoutes(r)
+	return r
+}
+
+func doRequest(t *testing.T, r http.Handler, method, path string, body interface{}, out interface{}) int {
+	t.Helper()
+	return doRequestWithHeaders(t, r, method, path, nil, body, out)
+}
+
+// doAdminRequest is doRequest with the admin token set.
+func doAdminRequest(t *testing.T, r http.Handler, method, path string, body interface{}, out interface{}) int {
+	t.Helper()
+	return doRequestWithHeaders(t, r, method, path, map[string]string{"X-Admin-Token": "secret"}, body, out)
+}
+
+func doRequestWithHeaders(t *testing.T, r http.Handler, method, path string, headers map[string]string, body interface{}, out interface{}) int {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if out != nil && w.Body.Len() > 0 {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), out))
+	}
+	return w.Code
+}
+
+func TestEndToEnd_SubscriptionLifecycle(t *testing.T) {
+	r := newTestServer()
+
+	end := "03-2024"
+	var created models.Subscription
+	status := doRequest(t, r, "POST", "/subscriptions", models.Subscription{
+		ServiceName: "Netflix",
+		Price:       1000,
+		UserID:      e2eUserID,
+		StartDate:   "01-2024",
+		EndDate:     &end,
+	}, &created)
+	require.Equal(t, http.StatusOK, status)
+	require.NotEmpty(t, created.ID)
+
+	status = doRequest(t, r, "POST", "/subscriptions", models.Subscription{
+		ServiceName: "Spotify",
+		Price:       500,
+		UserID:      e2eUserID,
+		StartDate:   "02-2024",
+	}, nil)
+	require.Equal(t, http.StatusOK, status)
+
+	var got models.Subscription
+	status = doRequest(t, r, "GET", "/subscriptions/"+created.ID, nil, &got)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, created, got)
+
+	var page models.SubscriptionPage
+	status = doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&sort=-price&limit=1", nil, &page)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "Netflix", page.Items[0].ServiceName)
+	require.True(t, page.HasMore)
+	require.NotNil(t, page.NextCursor)
+
+	var next models.SubscriptionPage
+	status = doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&sort=-price&limit=1&cursor="+*page.NextCursor, nil, &next)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, next.Items, 1)
+	assert.Equal(t, "Spotify", next.Items[0].ServiceName)
+	assert.False(t, next.HasMore)
+
+	var summary models.SubscriptionSummary
+	status = doRequest(t, r, "GET", "/subscriptions/summary?from=01-2024&to=04-2024", nil, &summary)
+	require.Equal(t, http.StatusOK, status)
+	// Netflix for Jan-Mar, Spotify for Feb-Apr.
+	assert.Equal(t, 3*1000+3*500, summary.Total)
+	assert.Equal(t, []models.MonthlyCost{
+		{Month: "01-2024", Total: 1000},
+		{Month: "02-2024", Total: 1500},
+		{Month: "03-2024", Total: 1500},
+		{Month: "04-2024", Total: 500},
+	}, summary.Months)
+
+	created.Price = 1200
+	status = doRequest(t, r, "PUT", "/subscriptions/"+created.ID, created, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, r, "DELETE", "/subscriptions/"+created.ID, nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	var errResp models.ErrorResponse
+	status = doRequest(t, r, "GET", "/subscriptions/"+created.ID, nil, &errResp)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, models.CodeNotFound, errResp.Code)
+
+	status = doRequest(t, r, "DELETE", "/subscriptions/"+created.ID, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestEndToEnd_Errors(t *testing.T) {
+	r := newTestServer()
+
+	var errResp models.ErrorResponse
+	status := doRequest(t, r, "GET", "/subscriptions/not-a-uuid", nil, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, models.CodeInvalidInput, errResp.Code)
+
+	status = doRequest(t, r, "PUT", "/subscriptions/123e4567-e89b-12d3-a456-426614174000", models.Subscription{
+		ServiceName: "Netflix",
+		Price:       1000,
+		UserID:      e2eUserID,
+		StartDate:   "01-2024",
+	}, &errResp)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status = doRequest(t, r, "GET", "/subscriptions/summary?from=05-2024&to=01-2024", nil, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, models.CodeInvalidDate, errResp.Code)
+
+	status = doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&cursor=bogus", nil, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, models.CodeInvalidCursor, errResp.Code)
+}
+
+func TestEndToEnd_ExchangeRates(t *testing.T) {
+	r := newTestServer()
+
+	for _, s := range []models.Subscription{
+		{ServiceName: "Netflix", Price: 1000, Currency: "USD", UserID: e2eUserID, StartDate: "01-2024"},
+		{ServiceName: "Kinopoisk", Price: 45000, Currency: "RUB", UserID: e2eUserID, StartDate: "01-2024"},
+	} {
+		require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions", s, nil))
+	}
+
+	var errResp models.ErrorResponse
+	status := doRequest(t, r, "GET", "/subscriptions/summary?from=01-2024&to=02-2024&currency=USD", nil, &errResp)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, models.CodeNoRate, errResp.Code)
+
+	rates := []models.ExchangeRate{{Currency: "RUB", Month: "01-2024", Rate: 90}}
+	status = doRequest(t, r, "PUT", "/exchange-rates", rates, &errResp)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, models.CodeForbidden, errResp.Code)
+
+	data, err := json.Marshal(rates)
+	require.NoError(t, err)
+	req := httptest.NewRequest("PUT", "/exchange-rates", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-Token", "secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var listed []models.ExchangeRate
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/exchange-rates", nil, &listed))
+	assert.Equal(t, rates, listed)
+
+	var summary models.SubscriptionSummary
+	status = doRequest(t, r, "GET", "/subscriptions/summary?from=01-2024&to=02-2024&currency=USD", nil, &summary)
+	require.Equal(t, http.StatusOK, status)
+	require.NotNil(t, summary.Currency)
+	assert.Equal(t, "USD", *summary.Currency)
+	assert.Equal(t, 2*(1000+500), summary.Total)
+}
+
+func TestEndToEnd_DateFormats(t *testing.T) {
+	r := newTestServer()
+
+	end := "2024-03-10"
+	var created models.Subscription
+	status := doRequest(t, r, "POST", "/subscriptions?date_format=iso", models.Subscription{
+		ServiceName: "Netflix",
+		Price:       3100,
+		UserID:      e2eUserID,
+		StartDate:   "2024-01-20",
+		EndDate:     &end,
+	}, &created)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "2024-01-20", created.StartDate)
+	assert.Equal(t, &end, created.EndDate)
+
+	var got models.Subscription
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions/"+created.ID, nil, &got))
+	assert.Equal(t, "01-2024", got.StartDate)
+	assert.Equal(t, "03-2024", *got.EndDate)
+
+	req := httptest.NewRequest("GET", "/subscriptions/"+created.ID, nil)
+	req.Header.Set("Accept", "text/html, application/json; date-format=iso")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "2024-01-20", got.StartDate)
+
+	var page models.SubscriptionPage
+	status = doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&active_on=2024-01-20&date_format=iso", nil, &page)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "2024-01-20", page.Items[0].StartDate)
+
+	var errResp models.ErrorResponse
+	status = doRequest(t, r, "GET", "/subscriptions/"+created.ID+"?date_format=unix", nil, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, models.CodeInvalidQuery, errResp.Code)
+
+	var summary models.SubscriptionSummary
+	status = doRequest(t, r, "GET", "/subscriptions/summary?from=2024-01-01&to=2024-01-31", nil, &summary)
+	require.Equal(t, http.StatusOK, status)
+	// Charged for 12 of the 31 days in January.
+	assert.Equal(t, 1200, summary.Total)
+}
+
+func TestEndToEnd_PriceHistory(t *testing.T) {
+	r := newTestServer()
+
+	var created models.Subscription
+	require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions", models.Subscription{
+		ServiceName: "Netflix",
+		Price:       1000,
+		UserID:      e2eUserID,
+		StartDate:   "01-2024",
+	}, &created))
+
+	var change models.PriceChange
+	status := doRequest(t, r, "POST", "/subscriptions/"+created.ID+"/prices", models.PriceChange{EffectiveFrom: "03-2024", Price: 1500}, &change)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, models.PriceChange{EffectiveFrom: "03-2024", Price: 1500}, change)
+
+	var errResp models.ErrorResponse
+	status = doRequest(t, r, "POST", "/subscriptions/"+created.ID+"/prices", models.PriceChange{EffectiveFrom: "01-2024", Price: 1500}, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	var changes []models.PriceChange
+	status = doRequest(t, r, "GET", "/subscriptions/"+created.ID+"/prices?date_format=iso", nil, &changes)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []models.PriceChange{{EffectiveFrom: "2024-03-01", Price: 1500}}, changes)
+
+	var summary models.SubscriptionSummary
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions/summary?from=01-2024&to=04-2024", nil, &summary))
+	assert.Equal(t, 2*1000+2*1500, summary.Total)
+
+	status = doRequest(t, r, "GET", "/subscriptions/123e4567-e89b-12d3-a456-426614174000/prices", nil, &errResp)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestEndToEnd_PauseResume(t *testing.T) {
+	r := newTestServer()
+
+	var created models.Subscription
+	require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions", models.Subscription{
+		ServiceName: "Netflix",
+		Price:       1000,
+		UserID:      e2eUserID,
+		StartDate:   "01-2024",
+	}, &created))
+	assert.Empty(t, created.Pauses)
+
+	var sub models.Subscription
+	status := doRequest(t, r, "POST", "/subscriptions/"+created.ID+"/pause", models.Pause{From: "03-2024"}, &sub)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []models.Pause{{From: "03-2024"}}, sub.Pauses)
+
+	var errResp models.ErrorResponse
+	status = doRequest(t, r, "POST", "/subscriptions/"+created.ID+"/pause", models.Pause{From: "04-2024"}, &errResp)
+	assert.Equal(t, http.StatusConflict, status)
+
+	status = doRequest(t, r, "POST", "/subscriptions/"+created.ID+"/resume?date_format=iso", models.ResumeRequest{On: "2024-05-01"}, &sub)
+	require.Equal(t, http.StatusOK, status)
+	to := "2024-04-30"
+	assert.Equal(t, []models.Pause{{From: "2024-03-01", To: &to}}, sub.Pauses)
+
+	status = doRequest(t, r, "POST", "/subscriptions/"+created.ID+"/resume", models.ResumeRequest{On: "2024-05-01"}, &errResp)
+	assert.Equal(t, http.StatusConflict, status)
+
+	var summary models.SubscriptionSummary
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions/summary?from=01-2024&to=06-2024", nil, &summary))
+	assert.Equal(t, 4*1000, summary.Total)
+
+	var page models.SubscriptionPage
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&active_on=04-2024", nil, &page))
+	assert.Empty(t, page.Items)
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&active_on=05-2024", nil, &page))
+	assert.Len(t, page.Items, 1)
+}
+
+func TestEndToEnd_ServiceCatalog(t *testing.T) {
+	r := newTestServer()
+
+	svc := models.Service{Name: "Netflix", Aliases: []string{"Netflix Premium"}, DefaultCurrency: "EUR"}
+	var errResp models.ErrorResponse
+	status := doRequest(t, r, "POST", "/services", svc, &errResp)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, models.CodeForbidden, errResp.Code)
+
+	var created models.Service
+	require.Equal(t, http.StatusOK, doAdminRequest(t, r, "POST", "/services", svc, &created))
+	require.NotEmpty(t, created.ID)
+	status = doAdminRequest(t, r, "POST", "/services", models.Service{Name: "netflix premium"}, &errResp)
+	assert.Equal(t, http.StatusConflict, status)
+
+	var sub models.Subscription
+	status = doRequest(t, r, "POST", "/subscriptions", models.Subscription{
+		ServiceName: " NETFLIX  premium",
+		Price:       1000,
+		UserID:      e2eUserID,
+		StartDate:   "01-2024",
+	}, &sub)
+	require.Equal(t, http.StatusOK, status)
+	require.NotNil(t, sub.ServiceID)
+	assert.Equal(t, created.ID, *sub.ServiceID)
+	assert.Equal(t, "Netflix", sub.ServiceName)
+	assert.Equal(t, "EUR", sub.Currency)
+
+	var page models.SubscriptionPage
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&service_id="+created.ID, nil, &page))
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, sub.ID, page.Items[0].ID)
+
+	created.Name = "Netflix Standard"
+	require.Equal(t, http.StatusOK, doAdminRequest(t, r, "PUT", "/services/"+created.ID, created, nil))
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions/"+sub.ID, nil, &sub))
+	assert.Equal(t, "Netflix Standard", sub.ServiceName)
+
+	require.Equal(t, http.StatusNoContent, doAdminRequest(t, r, "DELETE", "/services/"+created.ID, nil, nil))
+	assert.Equal(t, http.StatusNotFound, doRequest(t, r, "GET", "/services/"+created.ID, nil, nil))
+	var unlinked models.Subscription
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions/"+sub.ID, nil, &unlinked))
+	assert.Nil(t, unlinked.ServiceID)
+	assert.Equal(t, "Netflix Standard", unlinked.ServiceName)
+}
+
+func TestEndToEnd_CategoriesAndTags(t *testing.T) {
+	r := newTestServer()
+	str := func(s string) *string { return &s }
+
+	for _, s := range []models.Subscription{
+		{ServiceName: "Netflix", Price: 1000, UserID: e2eUserID, StartDate: "01-2024", Tags: []string{"Family"}},
+		{ServiceName: "Spotify", Price: 500, UserID: e2eUserID, StartDate: "01-2024", Tags: []string{"family", "music"}},
+		{ServiceName: "Notion", Price: 800, UserID: e2eUserID, StartDate: "01-2024", Category: "Work"},
+	} {
+		require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions", s, nil))
+	}
+
+	var page models.SubscriptionPage
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&category=STREAMING", nil, &page))
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "Netflix", page.Items[0].ServiceName)
+	assert.Equal(t, []string{"family"}, page.Items[0].Tags)
+
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&tag=family,music", nil, &page))
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "Spotify", page.Items[0].ServiceName)
+
+	var summary models.SubscriptionSummary
+	status := doRequest(t, r, "GET", "/subscriptions/summary?user_id="+e2eUserID+"&from=01-2024&to=01-2024&group_by=category", nil, &summary)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []models.SummaryGroup{
+		{Category: str("music"), Total: 500},
+		{Category: str("streaming"), Total: 1000},
+		{Category: str("work"), Total: 800},
+	}, summary.Groups)
+
+	var byTag models.SubscriptionSummary
+	status = doRequest(t, r, "GET", "/subscriptions/summary?user_id="+e2eUserID+"&from=01-2024&to=01-2024&group_by=tag", nil, &byTag)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2300, byTag.Total)
+	assert.Equal(t, []models.SummaryGroup{
+		{Tag: str(""), Total: 800},
+		{Tag: str("family"), Total: 1500},
+		{Tag: str("music"), Total: 500},
+	}, byTag.Groups)
+}
+
+func TestEndToEnd_AuditLog(t *testing.T) {
+	r := newTestServer()
+
+	var created models.Subscription
+	status := doRequestWithHeaders(t, r, "POST", "/subscriptions", map[string]string{
+		"X-User-ID":    e2eUserID,
+		"X-Request-ID": "req-create",
+	}, models.Subscription{ServiceName: "Netflix", Price: 1000, UserID: e2eUserID, StartDate: "01-2024"}, &created)
+	require.Equal(t, http.StatusOK, status)
+
+	created.Price = 1200
+	require.Equal(t, http.StatusOK, doAdminRequest(t, r, "PUT", "/subscriptions/"+created.ID, created, nil))
+	require.Equal(t, http.StatusNoContent, doRequest(t, r, "DELETE", "/subscriptions/"+created.ID, nil, nil))
+
+	var history []models.AuditEntry
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions/"+created.ID+"/history", nil, &history))
+	require.Len(t, history, 3)
+	assert.Equal(t, models.AuditCreate, history[0].Action)
+	assert.Equal(t, "user:"+e2eUserID, history[0].Actor)
+	assert.Equal(t, "req-create", history[0].RequestID)
+	assert.Equal(t, "admin", history[1].Actor)
+	assert.NotEmpty(t, history[1].RequestID, "generated")
+	assert.JSONEq(t, "1200", string(history[1].Changes["price"].After))
+	assert.Equal(t, "anonymous", history[2].Actor)
+
+	var errResp models.ErrorResponse
+	status = doRequest(t, r, "GET", "/audit", nil, &errResp)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	var page models.AuditPage
+	require.Equal(t, http.StatusOK, doAdminRequest(t, r, "GET", "/audit?actor=admin", nil, &page))
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, history[1], page.Items[0])
+}
+
+func TestEndToEnd_SoftDelete(t *testing.T) {
+	r := newTestServer()
+
+	var created models.Subscription
+	require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions",
+		models.Subscription{ServiceName: "Netflix", Price: 1000, UserID: e2eUserID, StartDate: "01-2024"}, &created))
+	require.Equal(t, http.StatusNoContent, doRequest(t, r, "DELETE", "/subscriptions/"+created.ID, nil, nil))
+
+	assert.Equal(t, http.StatusNotFound, doRequest(t, r, "GET", "/subscriptions/"+created.ID, nil, nil))
+	var page models.SubscriptionPage
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID, nil, &page))
+	assert.Empty(t, page.Items)
+
+	var errResp models.ErrorResponse
+	status := doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&include_deleted=true", nil, &errResp)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, models.CodeForbidden, errResp.Code)
+	status = doAdminRequest(t, r, "GET", "/subscriptions/"+created.ID+"?include_deleted=maybe", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	var deleted models.Subscription
+	require.Equal(t, http.StatusOK, doAdminRequest(t, r, "GET", "/subscriptions/"+created.ID+"?include_deleted=true", nil, &deleted))
+	assert.NotNil(t, deleted.DeletedAt)
+	var summary models.SubscriptionSummary
+	require.Equal(t, http.StatusOK, doAdminRequest(t, r, "GET", "/subscriptions/summary?from=01-2024&to=01-2024&include_deleted=true", nil, &summary))
+	assert.Equal(t, 1000, summary.Total)
+
+	var restored models.Subscription
+	require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions/"+created.ID+"/restore", nil, &restored))
+	assert.Equal(t, created, restored)
+	assert.Equal(t, http.StatusConflict, doRequest(t, r, "POST", "/subscriptions/"+created.ID+"/restore", nil, nil))
+	assert.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions/"+created.ID, nil, nil))
+}
+
+func TestEndToEnd_ETags(t *testing.T) {
+	r := newTestServer()
+	send := func(method, path, header, value string, body interface{}) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	sub := models.Subscription{ServiceName: "Netflix", Price: 1000, UserID: e2eUserID, StartDate: "01-2024"}
+	w := send("POST", "/subscriptions", "", "", sub)
+	require.Equal(t, http.StatusOK, w.Code)
+	var created models.Subscription
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	tag := w.Header().Get("ETag")
+	require.Equal(t, `"1"`, tag)
+
+	w = send("GET", "/subscriptions/"+created.ID, "If-None-Match", tag, nil)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, tag, w.Header().Get("ETag"))
+	assert.Equal(t, 0, w.Body.Len())
+
+	// Two clients update the same version; the second one loses.
+	sub.Price = 1100
+	w = send("PUT", "/subscriptions/"+created.ID, "If-Match", tag, sub)
+	require.Equal(t, http.StatusOK, w.Code)
+	newTag := w.Header().Get("ETag")
+	assert.Equal(t, `"2"`, newTag)
+	sub.Price = 1200
+	w = send("PUT", "/subscriptions/"+created.ID, "If-Match", tag, sub)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	var errResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	assert.Equal(t, models.CodePreconditionFailed, errResp.Code)
+
+	w = send("GET", "/subscriptions/"+created.ID, "If-None-Match", tag, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var current models.Subscription
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &current))
+	assert.Equal(t, 1100, current.Price)
+
+	// Pausing changes the version too.
+	w = send("POST", "/subscriptions/"+created.ID+"/pause", "", "", models.Pause{From: "02-2024"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	assert.Equal(t, http.StatusPreconditionFailed, send("DELETE", "/subscriptions/"+created.ID, "If-Match", newTag, nil).Code)
+	assert.Equal(t, http.StatusNoContent, send("DELETE", "/subscriptions/"+created.ID, "If-Match", `"3"`, nil).Code)
+}
+
+func TestEndToEnd_Patch(t *testing.T) {
+	r := newTestServer()
+	end := "12-2024"
+	var created models.Subscription
+	require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions", models.Subscription{
+		ServiceName: "Netflix", Price: 1000, UserID: e2eUserID, StartDate: "01-2024", EndDate: &end, Tags: []string{"family"},
+	}, &created))
+	patch := func(contentType, body string, out interface{}) int {
+		req := httptest.NewRequest("PATCH", "/subscriptions/"+created.ID, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if out != nil {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), out))
+		}
+		return w.Code
+	}
+
+	var patched models.Subscription
+	require.Equal(t, http.StatusOK, patch("application/merge-patch+json", `{"price": 1200}`, &patched))
+	assert.Equal(t, 1200, patched.Price)
+	assert.Equal(t, &end, patched.EndDate)
+	assert.Equal(t, []string{"family"}, patched.Tags)
+
+	patched = models.Subscription{}
+	require.Equal(t, http.StatusOK, patch("application/merge-patch+json", `{"end_date": null, "category": "video"}`, &patched))
+	assert.Nil(t, patched.EndDate)
+	assert.Equal(t, "video", patched.Category)
+	assert.Equal(t, 1200, patched.Price)
+
+	patched = models.Subscription{}
+	require.Equal(t, http.StatusOK, patch("application/json-patch+json",
+		`[{"op": "add", "path": "/tags/-", "value": "work"}, {"op": "remove", "path": "/category"}]`, &patched))
+	assert.Equal(t, []string{"family", "work"}, patched.Tags)
+
+	var errResp models.ErrorResponse
+	assert.Equal(t, http.StatusUnprocessableEntity, patch("application/merge-patch+json", `{"price": -5}`, &errResp))
+	assert.Equal(t, models.CodeValidation, errResp.Code)
+
+	var current models.Subscription
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions/"+created.ID, nil, &current))
+	assert.Equal(t, patched, current)
+}
+
+func TestEndToEnd_IdempotencyKeys(t *testing.T) {
+	r := newTestServer()
+	headers := map[string]string{"Idempotency-Key": "a3f1c9e0-retry"}
+	sub := models.Subscription{ServiceName: "Netflix", Price: 1000, UserID: e2eUserID, StartDate: "01-2024"}
+
+	var created, retried models.Subscription
+	require.Equal(t, http.StatusOK, doRequestWithHeaders(t, r, "POST", "/subscriptions", headers, sub, &created))
+	require.Equal(t, http.StatusOK, doRequestWithHeaders(t, r, "POST", "/subscriptions?date_format=iso", headers, sub, &retried))
+	assert.Equal(t, created.ID, retried.ID)
+	assert.Equal(t, "2024-01-01", retried.StartDate)
+
+	var errResp models.ErrorResponse
+	sub.Price = 1200
+	assert.Equal(t, http.StatusConflict, doRequestWithHeaders(t, r, "POST", "/subscriptions", headers, sub, &errResp))
+	assert.Equal(t, models.CodeConflict, errResp.Code)
+	long := map[string]string{"Idempotency-Key": strings.Repeat("k", 256)}
+	assert.Equal(t, http.StatusBadRequest, doRequestWithHeaders(t, r, "POST", "/subscriptions", long, sub, nil))
+
+	// Without a key every request creates a subscription.
+	var other models.Subscription
+	require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions", sub, &other))
+	assert.NotEqual(t, created.ID, other.ID)
+	var page models.SubscriptionPage
+	require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID, nil, &page))
+	assert.Len(t, page.Items, 2)
+}
+
+func TestEndToEnd_Batch(t *testing.T) {
+	r := newTestServer()
+
+	var existing models.Subscription
+	require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions",
+		models.Subscription{ServiceName: "Netflix", Price: 1000, UserID: e2eUserID, StartDate: "01-2024"}, &existing))
+	updated := existing
+	updated.Price = 1100
+	missing := "123e4567-e89b-12d3-a456-426614174000"
+	spotify := models.Subscription{ServiceName: "Spotify", Price: 500, UserID: e2eUserID, StartDate: "02-2024"}
+	list := func() []models.Subscription {
+		var page models.SubscriptionPage
+		require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&sort=service_name", nil, &page))
+		return page.Items
+	}
+
+	// A failing operation rolls back the ones before it.
+	var errResp models.ErrorResponse
+	status := doRequest(t, r, "POST", "/subscriptions/batch", models.BatchRequest{Operations: []models.BatchOperation{
+		{Op: models.BatchCreate, Subscription: &spotify},
+		{Op: models.BatchUpdate, ID: existing.ID, Subscription: &updated},
+		{Op: models.BatchDelete, ID: missing},
+	}}, &errResp)
+	assert.Equal(t, http.StatusNotFound, status)
+	require.Len(t, errResp.Fields, 1)
+	assert.Equal(t, "operations[2]", errResp.Fields[0].Field)
+	assert.Equal(t, []models.Subscription{existing}, list())
+
+	// Invalid operations are reported before anything runs.
+	invalid := spotify
+	invalid.Price = -1
+	status = doRequest(t, r, "POST", "/subscriptions/batch", models.BatchRequest{Operations: []models.BatchOperation{
+		{Op: models.BatchCreate, Subscription: &invalid},
+		{Op: models.BatchUpdate, Subscription: &updated},
+	}}, &errResp)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	var fields []string
+	for _, f := range errResp.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.ElementsMatch(t, []string{"operations[0].subscription.price", "operations[1].id"}, fields)
+
+	var resp models.BatchResponse
+	require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions/batch?date_format=iso", models.BatchRequest{
+		Mode: models.BatchBestEffort,
+		Operations: []models.BatchOperation{
+			{Op: models.BatchCreate, Subscription: &spotify},
+			{Op: models.BatchUpdate, ID: existing.ID, Subscription: &updated},
+			{Op: models.BatchDelete, ID: missing},
+			{Op: models.BatchCreate, Subscription: &invalid},
+		},
+	}, &resp))
+	assert.Equal(t, 2, resp.Succeeded)
+	assert.Equal(t, 2, resp.Failed)
+	require.Len(t, resp.Results, 4)
+	assert.Equal(t, http.StatusOK, resp.Results[0].Status)
+	assert.Equal(t, "2024-02-01", resp.Results[0].Subscription.StartDate)
+	assert.Equal(t, 1100, resp.Results[1].Subscription.Price)
+	assert.Equal(t, http.StatusNotFound, resp.Results[2].Status)
+	assert.Equal(t, models.CodeNotFound, resp.Results[2].Error.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Results[3].Status)
+	assert.Equal(t, "subscription.price", resp.Results[3].Error.Fields[0].Field)
+
+	items := list()
+	require.Len(t, items, 2)
+	assert.Equal(t, 1100, items[0].Price)
+	assert.Equal(t, "Spotify", items[1].ServiceName)
+
+	// A stale if_match fails the batch with 412.
+	cheaper := items[1]
+	cheaper.Price = 400
+	status = doRequest(t, r, "POST", "/subscriptions/batch", models.BatchRequest{Operations: []models.BatchOperation{
+		{Op: models.BatchUpdate, ID: cheaper.ID, Subscription: &cheaper, IfMatch: `"1"`},
+		{Op: models.BatchDelete, ID: existing.ID, IfMatch: `"1"`},
+	}}, &errResp)
+	assert.Equal(t, http.StatusPreconditionFailed, status)
+	require.Len(t, errResp.Fields, 1)
+	assert.Equal(t, "operations[1]", errResp.Fields[0].Field)
+	assert.Equal(t, items, list())
+
+	// Deleting in an all_or_nothing batch.
+	require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions/batch", models.BatchRequest{
+		Operations: []models.BatchOperation{{Op: models.BatchDelete, ID: existing.ID}, {Op: models.BatchDelete, ID: items[1].ID}},
+	}, &resp))
+	assert.Equal(t, http.StatusNoContent, resp.Results[0].Status)
+	assert.Empty(t, list())
+
+	assert.Equal(t, http.StatusUnprocessableEntity, doRequest(t, r, "POST", "/subscriptions/batch", models.BatchRequest{}, nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, doRequest(t, r, "POST", "/subscriptions/batch", models.BatchRequest{
+		Mode: "sometimes", Operations: []models.BatchOperation{{Op: models.BatchDelete, ID: missing}},
+	}, nil))
+}
+
+func TestEndToEnd_Import(t *testing.T) {
+	r := newTestServer()
+	file := "\ufeffName,Cost,Start,tags\n" +
+		"Netflix,1000,01-2024,\"video, family\"\n" +
+		"Spotify,ten,02-2024,\n" +
+		"YouTube,300,13-2024,\n" +
+		"Yandex Plus,400,03-2024,\n"
+	upload := func(query string, out interface{}) int {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("file", "subscriptions.csv")
+		require.NoError(t, err)
+		_, err = part.Write([]byte(file))
+		require.NoError(t, err)
+		require.NoError(t, form.Close())
+
+		req := httptest.NewRequest("POST", "/subscriptions/import?column=service_name:Name,price:Cost&column=start_date:Start&user_id="+e2eUserID+query, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), out))
+		return w.Code
+	}
+	list := func() []models.Subscription {
+		var page models.SubscriptionPage
+		require.Equal(t, http.StatusOK, doRequest(t, r, "GET", "/subscriptions?user_id="+e2eUserID+"&sort=service_name", nil, &page))
+		return page.Items
+	}
+
+	var resp models.ImportResponse
+	require.Equal(t, http.StatusOK, upload("&dry_run=true", &resp))
+	assert.True(t, resp.DryRun)
+	assert.Equal(t, 0, resp.Created)
+	assert.Equal(t, 2, resp.Valid)
+	assert.Equal(t, 2, resp.Invalid)
+	require.Len(t, resp.Rows, 4)
+	assert.Equal(t, models.ImportWouldCreate, resp.Rows[0].Status)
+	assert.Equal(t, []string{"family", "video"}, resp.Rows[0].Subscription.Tags, "as they would be stored")
+	assert.Empty(t, resp.Rows[0].Subscription.ID)
+	assert.Equal(t, 3, resp.Rows[1].Line)
+	assert.Equal(t, []models.FieldError{{Field: "price", Code: "integer", Message: "must be an integer"}}, resp.Rows[1].Errors)
+	assert.Equal(t, models.ImportInvalid, resp.Rows[2].Status)
+	assert.Empty(t, list())
+
+	resp = models.ImportResponse{}
+	require.Equal(t, http.StatusOK, upload("&date_format=iso", &resp))
+	assert.Equal(t, 2, resp.Created)
+	assert.Equal(t, models.ImportCreated, resp.Rows[3].Status)
+	assert.Equal(t, "2024-03-01", resp.Rows[3].Subscription.StartDate)
+	subs := list()
+	require.Len(t, subs, 2)
+	assert.Equal(t, "Netflix", subs[0].ServiceName)
+	assert.Equal(t, 1000, subs[0].Price)
+	assert.Equal(t, "Yandex Plus", subs[1].ServiceName)
+
+	// A raw body works too, and a missing mapped column is rejected.
+	req := httptest.NewRequest("POST", "/subscriptions/import?column=price:Cost", strings.NewReader("service_name,price\nNetflix,1000\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `no column \"Cost\" for price`)
+
+	// A dry run fails where the import would, here on an unknown service.
+	for _, query := range []string{"?dry_run=true", ""} {
+		body := "service_id,price,start_date,user_id\n5b2c6a0e-8f0a-4c57-9a4e-1d2f3b4c5d6e,1000,01-2024," + e2eUserID + "\n"
+		req := httptest.NewRequest("POST", "/subscriptions/import"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.Contains(t, w.Body.String(), "Line 2")
+	}
+	assert.Len(t, list(), 2)
+}
+
+func TestEndToEnd_Export(t *testing.T) {
+	r := newTestServer()
+	for _, s := range []models.Subscription{
+		{ServiceName: "Netflix", Price: 1000, UserID: e2eUserID, StartDate: "01-2024", Tags: []string{"video", "family"}},
+		{ServiceName: "-Prime", Price: 500, UserID: e2eUserID, StartDate: "02-2024", Category: "=cmd", Tags: []string{"'@home"}},
+		{ServiceName: "Other user", Price: 700, UserID: "123e4567-e89b-12d3-a456-426614174000", StartDate: "02-2024"},
+	} {
+		require.Equal(t, http.StatusOK, doRequest(t, r, "POST", "/subscriptions", s, nil))
+	}
+	export := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/subscriptions/export?user_id="+e2eUserID+"&sort=-price&"+query, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w
+	}
+
+	w := export("")
+	assert.Equal(t, `attachment; filename="subscriptions.csv"`, w.Header().Get("Content-Disposition"))
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "Netflix", records[1][2])
+	assert.Equal(t, "family,video", records[1][14])
+	assert.Equal(t, "'-Prime", records[2][2])
+	assert.Equal(t, "'=cmd", records[2][13])
+	assert.Equal(t, "''@home", records[2][14])
+
+	// The CSV export can be imported again.
+	other := httptest.NewRecorder()
+	r.ServeHTTP(other, httptest.NewRequest("GET", "/subscriptions/export?user_id="+e2eUserID, nil))
+	copied := newTestServer()
+	req := httptest.NewRequest("POST", "/subscriptions/import", other.Body)
+	req.Header.Set("Content-Type", "text/csv")
+	imported := httptest.NewRecorder()
+	copied.ServeHTTP(imported, req)
+	require.Equal(t, http.StatusOK, imported.Code)
+	var resp models.ImportResponse
+	require.NoError(t, json.Unmarshal(imported.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Created)
+	// The quotes guarding formulas are dropped again.
+	prime := resp.Rows[1].Subscription
+	assert.Equal(t, "-Prime", prime.ServiceName)
+	assert.Equal(t, "=cmd", prime.Category)
+	assert.Equal(t, []string{"'@home"}, prime.Tags)
+
+	w = export("format=jsonl&date_format=iso")
+	var lines []models.Subscription
+	dec := json.NewDecoder(w.Body)
+	for dec.More() {
+		var s models.Subscription
+		require.NoError(t, dec.Decode(&s))
+		lines = append(lines, s)
+	}
+	require.Len(t, lines, 2)
+	assert.Equal(t, "2024-01-01", lines[0].StartDate)
+	assert.Equal(t, []string{"family", "video"}, lines[0].Tags)
+
+	w = export("format=xlsx")
+	body := w.Body.Bytes()
+	book, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	var sheet []byte
+	for _, f := range book.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			sheet, err = io.ReadAll(rc)
+			require.NoError(t, err)
+			rc.Close()
+		}
+	}
+	assert.Contains(t, string(sheet), `<c r="C2" t="inlineStr"><is><t>Netflix</t></is></c><c r="D2"><v>1000</v></c>`)
+	assert.Contains(t, string(sheet), `<c r="N3" t="inlineStr"><is><t>&#39;=cmd</t></is></c>`)
+	assert.Contains(t, string(sheet), `<row r="3">`)
+	assert.NotContains(t, string(sheet), `<row r="4">`)
+}
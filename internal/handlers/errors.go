@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/MosinFAM/subs-app/internal/logger"
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/repo"
+	"github.com/gin-gonic/gin"
+)
+
+type errorMapping struct {
+	target  error
+	status  int
+	code    string
+	message string
+}
+
+// errorMappings lists the domain errors with a dedicated response, checked in
+// order with errors.Is.
+var errorMappings = []errorMapping{
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, models.CodeTimeout, "Request timed out"},
+	{repo.ErrNotFound, http.StatusNotFound, models.CodeNotFound, "Not found"},
+	{repo.ErrInvalidDate, http.StatusBadRequest, models.CodeInvalidDate, "Invalid date"},
+	{repo.ErrInvalidInput, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input"},
+	{repo.ErrInvalidSort, http.StatusBadRequest, models.CodeInvalidSort, "Invalid sort"},
+	{repo.ErrInvalidCursor, http.StatusBadRequest, models.CodeInvalidCursor, "Invalid cursor"},
+	{repo.ErrConstraint, http.StatusUnprocessableEntity, models.CodeConstraint, "Constraint violation"},
+	{repo.ErrConflict, http.StatusConflict, models.CodeConflict, "Conflict"},
+	{repo.ErrNoRate, http.StatusUnprocessableEntity, models.CodeNoRate, "No exchange rate for the requested conversion"},
+	{repo.ErrVersionMismatch, http.StatusPreconditionFailed, models.CodePreconditionFailed, "Precondition failed"},
+}
+
+func respondError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, models.ErrorResponse{Error: message, Code: code})
+}
+
+// respondValidation reports rejected fields so clients can point at them.
+func respondValidation(c *gin.Context, fields []models.FieldError) {
+	c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+		Error:  "Validation failed",
+		Code:   models.CodeValidation,
+		Fields: fields,
+	})
+}
+
+// handleError responds to a failed repository call. Known domain errors map to
+// their own status and code; anything else is logged and reported as a 500
+// with the given message.
+func handleError(ctx context.Context, c *gin.Context, err error, message string) {
+	if m, ok := lookupError(ctx, err); ok {
+		respondError(c, m.status, m.code, m.message)
+		return
+	}
+
+	logger.LogError(message, err, map[string]interface{}{
+		"method": c.Request.Method,
+		"path":   c.Request.URL.Path,
+	})
+	respondError(c, http.StatusInternalServerError, models.CodeInternal, message)
+}
+
+// lookupError finds the mapping of a domain error returned by a repository
+// call made under ctx.
+func lookupError(ctx context.Context, err error) (errorMapping, bool) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = context.DeadlineExceeded
+	}
+	for _, m := range errorMappings {
+		if errors.Is(err, m.target) {
+			return m, true
+		}
+	}
+	return errorMapping{}, false
+}
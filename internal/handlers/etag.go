@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// etag formats the version of a subscription as a strong entity tag.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// setETag tags the response with the version of s.
+func setETag(c *gin.Context, s models.Subscription) {
+	c.Header("ETag", etag(s.Version))
+}
+
+// ifMatchVersion reads the If-Match header of a request changing a
+// subscription and returns the version it expects, or 0 when any version
+// will do. Only a single tag issued by setETag or * is understood; any other
+// tag cannot match, so the request fails with 412. Without the header the
+// request fails with 428 when RequireIfMatch is set. The second value is
+// false when a response has been sent.
+func (h *Handler) ifMatchVersion(c *gin.Context) (int, bool) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" {
+		if h.RequireIfMatch {
+			respondError(c, http.StatusPreconditionRequired, models.CodePreconditionRequired, "If-Match header required")
+			return 0, false
+		}
+		return 0, true
+	}
+	version, ok := parseIfMatch(value)
+	if !ok {
+		respondError(c, http.StatusPreconditionFailed, models.CodePreconditionFailed, "Precondition failed")
+		return 0, false
+	}
+	return version, true
+}
+
+// parseIfMatch returns the version an If-Match value expects, or 0 for *.
+// The second value is false for tags setETag never issues.
+func parseIfMatch(value string) (int, bool) {
+	if value == "*" {
+		return 0, true
+	}
+	version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(value, `"`), `"`))
+	if err != nil || version <= 0 || value != etag(version) {
+		return 0, false
+	}
+	return version, true
+}
+
+// notModified reports whether the If-None-Match header of a GET lists the
+// current tag of s, using the weak comparison RFC 9110 prescribes.
+func notModified(c *gin.Context, s models.Subscription) bool {
+	current := etag(s.Version)
+	for _, tag := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/rates"
+	"github.com/MosinFAM/subs-app/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List exchange rates
+// @Description Returns every exchange rate ordered by currency and month.
+// @Description A rate is the price of one USD in the currency and applies from its month until the next rate.
+// @Tags exchange-rates
+// @Produce json
+// @Success 200 {array} models.ExchangeRate
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /exchange-rates [get]
+func (h *Handler) ListExchangeRates(c *gin.Context) {
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	list, err := h.Repo.ListExchangeRates(ctx)
+	if err != nil {
+		handleError(ctx, c, err, "Could not fetch exchange rates")
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Add or replace exchange rates
+// @Description Stores the given rates, replacing existing ones for the same currency and month. Admin only.
+// @Description The body is a JSON array or, with Content-Type text/csv, a table with currency, month and rate columns.
+// @Description Either all rates are stored or none; invalid entries are reported with 422.
+// @Tags exchange-rates
+// @Accept json
+// @Accept text/csv
+// @Produce json
+// @Param input body []models.ExchangeRate true "Exchange rates"
+// @Param X-Admin-Token header string true "Admin token"
+// @Success 200 {array} models.ExchangeRate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /exchange-rates [put]
+func (h *Handler) SetExchangeRates(c *gin.Context) {
+	format := rates.FormatJSON
+	if c.ContentType() == "text/csv" {
+		format = rates.FormatCSV
+	}
+	list, err := rates.Parse(c.Request.Body, format)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return
+	}
+
+	var fields []models.FieldError
+	for i, rate := range list {
+		for _, f := range validation.Struct(rate) {
+			f.Field = fmt.Sprintf("[%d].%s", i, f.Field)
+			fields = append(fields, f)
+		}
+	}
+	if fields != nil {
+		respondValidation(c, fields)
+		return
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	if err := h.Repo.SetExchangeRates(ctx, list); err != nil {
+		handleError(ctx, c, err, "Could not store exchange rates")
+		return
+	}
+	h.ListExchangeRates(c)
+}
+
+// @Summary Delete an exchange rate
+// @Description Deletes the rate of a currency for one month. Admin only.
+// @Tags exchange-rates
+// @Produce json
+// @Param currency path string true "ISO 4217 currency code"
+// @Param month path string true "Month in MM-YYYY format"
+// @Param X-Admin-Token header string true "Admin token"
+// @Success 204 "No Content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /exchange-rates/{currency}/{month} [delete]
+func (h *Handler) DeleteExchangeRate(c *gin.Context) {
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	err := h.Repo.DeleteExchangeRate(ctx, c.Param("currency"), c.Param("month"))
+	if err != nil {
+		handleError(ctx, c, err, "Delete failed")
+		return
+	}
+	c.Status(http.StatusNoContent)
+	c.Writer.WriteHeaderNow()
+}
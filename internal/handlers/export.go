@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/logger"
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/repo"
+	"github.com/MosinFAM/subs-app/internal/xlsx"
+	"github.com/gin-gonic/gin"
+)
+
+// Export formats.
+const (
+	exportCSV   = "csv"
+	exportJSONL = "jsonl"
+	exportXLSX  = "xlsx"
+)
+
+var exportContentTypes = map[string]string{
+	exportCSV:   "text/csv; charset=utf-8",
+	exportJSONL: "application/x-ndjson",
+	exportXLSX:  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportColumns are the columns of CSV and XLSX exports, named like the
+// fields ImportSubscriptions reads so that an export can be imported again.
+var exportColumns = []string{
+	"id", "service_id", "service_name", "price", "currency", "user_id", "start_date", "end_date",
+	"billing_period", "billing_months", "trial_end_date", "intro_price", "intro_months", "category", "tags",
+	"deleted_at",
+}
+
+// exportCells returns the cells of s under exportColumns, nil for those
+// without a value. Text cells are guarded by spreadsheetText.
+func exportCells(s models.Subscription) []any {
+	var deleted any
+	if s.DeletedAt != nil {
+		deleted = s.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	var tags any
+	if len(s.Tags) > 0 {
+		tags = strings.Join(s.Tags, ",")
+	}
+	cells := []any{
+		s.ID, optional(s.ServiceID), s.ServiceName, s.Price, s.Currency, s.UserID, s.StartDate, optional(s.EndDate),
+		s.BillingPeriod, optional(s.BillingMonths), optional(s.TrialEndDate), optional(s.IntroPrice), optional(s.IntroMonths),
+		s.Category, tags, deleted,
+	}
+	for i, cell := range cells {
+		if text, ok := cell.(string); ok {
+			cells[i] = spreadsheetText(text)
+		}
+	}
+	return cells
+}
+
+// spreadsheetText keeps user-supplied text from being run as a formula when
+// the export is opened in a spreadsheet: text starting with a character
+// that begins a formula gets a leading ', which shows it as plain text. So
+// does text where such a character follows leading quotes, so that
+// importedText can tell the added quote from those of the text.
+func spreadsheetText(text string) string {
+	if startsFormula(strings.TrimLeft(text, "'")) {
+		return "'" + text
+	}
+	return text
+}
+
+// importedText undoes spreadsheetText for a cell of an imported file.
+func importedText(text string) string {
+	if strings.HasPrefix(text, "'") && startsFormula(strings.TrimLeft(text, "'")) {
+		return text[1:]
+	}
+	return text
+}
+
+func startsFormula(text string) bool {
+	return text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0]))
+}
+
+func optional[T any](v *T) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// exportWriter writes the subscriptions of an export in one format.
+type exportWriter interface {
+	Write(s models.Subscription) error
+	// Close writes whatever the format needs after the last subscription.
+	Close() error
+}
+
+func newExportWriter(w io.Writer, format string) (exportWriter, error) {
+	switch format {
+	case exportJSONL:
+		return jsonlExport{json.NewEncoder(w)}, nil
+	case exportXLSX:
+		x, err := xlsx.NewWriter(w, "Subscriptions")
+		if err != nil {
+			return nil, err
+		}
+		header := make([]any, len(exportColumns))
+		for i, name := range exportColumns {
+			header[i] = name
+		}
+		return xlsxExport{x}, x.WriteRow(header...)
+	default:
+		c := csvExport{csv.NewWriter(w)}
+		return c, c.w.Write(exportColumns)
+	}
+}
+
+type csvExport struct{ w *csv.Writer }
+
+func (e csvExport) Write(s models.Subscription) error {
+	cells := exportCells(s)
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		if cell != nil {
+			record[i] = fmt.Sprint(cell)
+		}
+	}
+	return e.w.Write(record)
+}
+
+func (e csvExport) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonlExport struct{ enc *json.Encoder }
+
+func (e jsonlExport) Write(s models.Subscription) error { return e.enc.Encode(s) }
+
+func (e jsonlExport) Close() error { return nil }
+
+type xlsxExport struct{ w *xlsx.Writer }
+
+func (e xlsxExport) Write(s models.Subscription) error { return e.w.WriteRow(exportCells(s)...) }
+
+func (e xlsxExport) Close() error { return e.w.Close() }
+
+// @Summary Export subscriptions
+// @Description Downloads every subscription matching the filters of the list endpoint, in the requested order, as CSV, JSON Lines or an XLSX workbook.
+// @Description CSV and XLSX exports have a header row and one column per field, named like the columns read by the import, so an export can be imported again. Text starting with =, +, -, @, a tab or a carriage return, possibly after quotes, gets a leading ' there, so spreadsheets show it rather than run it as a formula; the import drops that quote again. Pauses are only part of JSON Lines exports, which hold one subscription object per line.
+// @Description Subscriptions are read and sent in batches rather than all at once. QUERY_TIMEOUT bounds each batch rather than the whole download. Should reading or sending fail once the download has started, the connection is aborted, so the download fails instead of ending early.
+// @Tags subscriptions
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce json
+// @Param format query string false "File format" Enums(csv, jsonl, xlsx) default(csv)
+// @Param user_id query string false "User UUID, required for non-admins"
+// @Param service_id query string false "Catalog service UUID"
+// @Param service_name query string false "Service name substring"
+// @Param min_price query int false "Minimum price"
+// @Param max_price query int false "Maximum price"
+// @Param active_on query string false "Only subscriptions active and not paused on this day (YYYY-MM-DD) or at any time in this month (MM-YYYY)"
+// @Param has_end_date query bool false "Only subscriptions with (true) or without (false) an end date"
+// @Param category query string false "Only subscriptions in this category, ignoring case; empty for uncategorized ones"
+// @Param tag query []string false "Only subscriptions with all of these tags, ignoring case (repeat or comma-separate)" collectionFormat(csv)
+// @Param trial_ends_within query int false "Only subscriptions whose free trial ends between today and this many days from now" minimum(0)
+// @Param sort query string false "Sort by price, start_date or service_name (by character code, so capitals come first), prefix with - for descending" default(start_date)
+// @Param date_format query string false "Format of dates in the export: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Param include_deleted query bool false "Also export deleted subscriptions, admin only"
+// @Param X-Admin-Token header string false "Admin token"
+// @Success 200 {file} file "Subscriptions"
+// @Header 200 {string} Content-Disposition "attachment; filename=subscriptions.csv"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /subscriptions/export [get]
+func (h *Handler) ExportSubscriptions(c *gin.Context) {
+	format := c.DefaultQuery("format", exportCSV)
+	if _, ok := exportContentTypes[format]; !ok {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid format")
+		return
+	}
+	f, ok := bindListRequest(c)
+	if !ok {
+		return
+	}
+	datesIn, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	withDeleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+
+	// The download takes as long as the client needs to receive it, so
+	// QueryTimeout bounds each batch read rather than the whole response.
+	ctx := repo.WithBatchTimeout(auditContext(c), h.QueryTimeout)
+	if withDeleted {
+		ctx = repo.WithDeleted(ctx)
+	}
+
+	// The response starts with the first subscription, so that errors of
+	// the first query, such as an invalid sort, still get a JSON error.
+	var out exportWriter
+	started := false
+	start := func() error {
+		started = true
+		c.Header("Content-Type", exportContentTypes[format])
+		c.Header("Content-Disposition", `attachment; filename="subscriptions.`+format+`"`)
+		c.Status(http.StatusOK)
+		w, err := newExportWriter(c.Writer, format)
+		out = w
+		return err
+	}
+	err := h.Repo.EachSubscription(ctx, f, func(s models.Subscription) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		formatDates(&s, datesIn)
+		return out.Write(s)
+	})
+	if err != nil && !started {
+		handleError(ctx, c, err, "Could not export subscriptions")
+		return
+	}
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		logger.LogError("Export failed", err, map[string]interface{}{
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+			"format": format,
+		})
+		// The status is sent already; cutting the connection is the only
+		// way to keep a partial file from passing for a complete one.
+		panic(http.ErrAbortHandler)
+	}
+}
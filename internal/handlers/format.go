@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/MosinFAM/subs-app/internal/dates"
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// dateFormat returns the format the client wants subscription dates in: the
+// date_format query parameter, else a date-format parameter of the Accept
+// header (application/json; date-format=iso), else MM-YYYY. It responds with
+// 400 and returns false for unknown formats.
+func dateFormat(c *gin.Context) (string, bool) {
+	format := c.Query("date_format")
+	if format == "" {
+		format = acceptDateFormat(c.GetHeader("Accept"))
+	}
+	if format == "" {
+		return dates.FormatMonth, true
+	}
+	if !dates.ValidFormat(format) {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid date_format")
+		return "", false
+	}
+	return format, true
+}
+
+func acceptDateFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if format, ok := params["date-format"]; ok {
+			return format
+		}
+	}
+	return ""
+}
+
+// formatDates rewrites the dates of s in the requested format. The pauses
+// are copied rather than changed in place, since the repository may share them.
+func formatDates(s *models.Subscription, format string) {
+	s.StartDate = dates.Reformat(s.StartDate, format)
+	if s.EndDate != nil {
+		end := dates.Reformat(*s.EndDate, format)
+		s.EndDate = &end
+	}
+	if s.Pauses != nil {
+		pauses := make([]models.Pause, len(s.Pauses))
+		for i, p := range s.Pauses {
+			pauses[i] = formatPause(p, format)
+		}
+		s.Pauses = pauses
+	}
+}
+
+func formatPause(p models.Pause, format string) models.Pause {
+	p.From = dates.Reformat(p.From, format)
+	if p.To != nil {
+		to := dates.Reformat(*p.To, format)
+		p.To = &to
+	}
+	return p
+}
@@ -1,149 +1,614 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/MosinFAM/subs-app/internal/dates"
+	"github.com/MosinFAM/subs-app/internal/middleware"
 	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/patch"
 	"github.com/MosinFAM/subs-app/internal/repo"
+	"github.com/MosinFAM/subs-app/internal/validation"
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
 	Repo repo.Repository
+	// QueryTimeout bounds the repository calls made for a single request.
+	// Zero means the calls only end with the request itself.
+	QueryTimeout time.Duration
+	// RequireIfMatch makes updates and deletes of subscriptions without an
+	// If-Match header fail with 428 instead of overwriting blindly.
+	RequireIfMatch bool
+	// IdempotencyTTL is how long an Idempotency-Key of a create request is
+	// remembered. Zero ignores the header.
+	IdempotencyTTL time.Duration
+}
+
+// requestContext derives the context for repository calls from the request,
+// so a client disconnect cancels the query, bounded by QueryTimeout. Changes
+// made under it are audited with the request's actor and ID.
+func (h *Handler) requestContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	ctx := auditContext(c)
+	if h.QueryTimeout > 0 {
+		return context.WithTimeout(ctx, h.QueryTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// auditContext is the request's context carrying its actor and ID for the
+// audit log, without a timeout.
+func auditContext(c *gin.Context) context.Context {
+	return repo.WithAuditInfo(c.Request.Context(), repo.AuditInfo{
+		Actor:     middleware.Actor(c),
+		RequestID: middleware.RequestIDOf(c),
+	})
 }
 
 // @Summary Create a new subscription
-// @Description Create a new subscription for a user
+// @Description Create a new subscription for a user.
+// @Description The subscription is linked to the catalog service given by service_id or, without it, to the one whose name or alias matches service_name; a linked subscription takes the service's name and, where not given, its default price, currency and category.
+// @Description A subscription without a category of its own or from the catalog gets a built-in one if it is a well-known service such as Netflix or Spotify. Categories and tags are stored in lower case.
+// @Description Invalid fields are reported with 422 and a per-field error list.
+// @Description A request with an Idempotency-Key header can be retried safely: while the key is remembered, a retry with the same subscription data gets the response of the first request instead of creating another subscription, and a request reusing the key for different data fails with 409.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param input body models.Subscription true "Subscription data"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Param Idempotency-Key header string false "Unique key of the request, at most 255 characters"
 // @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "Version of the subscription"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
 // @Router /subscriptions [post]
 func (h *Handler) CreateSubscription(c *gin.Context) {
 	var s models.Subscription
 	if err := c.ShouldBindJSON(&s); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid input"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return
+	}
+	if fields := validation.Struct(s); fields != nil {
+		respondValidation(c, fields)
 		return
 	}
-	sub, err := h.Repo.CreateSubscription(s)
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+	ctx, ok = h.withIdempotencyKey(ctx, c, s)
+	if !ok {
+		return
+	}
+
+	sub, err := h.Repo.CreateSubscription(ctx, s)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Could not create subscription"})
+		handleError(ctx, c, err, "Could not create subscription")
 		return
 	}
+	formatDates(&sub, format)
+	setETag(c, sub)
 	c.JSON(http.StatusOK, sub)
 }
 
-// @Summary List all subscriptions for a user
-// @Description Returns all subscriptions for the specified user
+// @Summary List subscriptions
+// @Description Returns a page of subscriptions for the specified user, sorted and filtered as requested.
+// @Description Administrators may omit user_id to list subscriptions of all users, and may set include_deleted to list deleted subscriptions that have not been purged yet.
 // @Tags subscriptions
 // @Produce json
-// @Param user_id query string true "User UUID"
-// @Success 200 {array} models.Subscription
+// @Param user_id query string false "User UUID, required for non-admins"
+// @Param service_id query string false "Catalog service UUID"
+// @Param service_name query string false "Service name substring"
+// @Param min_price query int false "Minimum price"
+// @Param max_price query int false "Maximum price"
+// @Param active_on query string false "Only subscriptions active and not paused on this day (YYYY-MM-DD) or at any time in this month (MM-YYYY)"
+// @Param has_end_date query bool false "Only subscriptions with (true) or without (false) an end date"
+// @Param category query string false "Only subscriptions in this category, ignoring case; empty for uncategorized ones"
+// @Param tag query []string false "Only subscriptions with all of these tags, ignoring case (repeat or comma-separate)" collectionFormat(csv)
+// @Param trial_ends_within query int false "Only subscriptions whose free trial ends between today and this many days from now" minimum(0)
+// @Param sort query string false "Sort by price, start_date or service_name (by character code, so capitals come first), prefix with - for descending" default(start_date)
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size" default(20) maximum(100)
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Param include_deleted query bool false "Also list deleted subscriptions, admin only"
+// @Param X-Admin-Token header string false "Admin token"
+// @Success 200 {object} models.SubscriptionPage
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
 // @Router /subscriptions [get]
 func (h *Handler) ListSubscriptions(c *gin.Context) {
-	userID := c.Query("user_id")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "user_id required"})
+	f, ok := bindListRequest(c)
+	if !ok {
+		return
+	}
+	if f.Limit == 0 {
+		f.Limit = models.DefaultListLimit
+	}
+	f.Limit = min(f.Limit, models.MaxListLimit)
+	format, ok := dateFormat(c)
+	if !ok {
 		return
 	}
-	subs, err := h.Repo.ListSubscriptions(userID)
+	withDeleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+	if withDeleted {
+		ctx = repo.WithDeleted(ctx)
+	}
+
+	page, err := h.Repo.ListSubscriptions(ctx, f)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Could not fetch subscriptions"})
+		handleError(ctx, c, err, "Could not fetch subscriptions")
 		return
 	}
-	c.JSON(http.StatusOK, subs)
+	for i := range page.Items {
+		formatDates(&page.Items[i], format)
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// bindListRequest reads the filters of a subscription list from the query.
+// It responds with 400 to invalid ones, and to non-admins leaving out
+// user_id, returning false as the second value.
+func bindListRequest(c *gin.Context) (models.SubscriptionListRequest, bool) {
+	var f models.SubscriptionListRequest
+	if err := c.ShouldBindQuery(&f); err != nil || f.Limit < 0 || f.TrialEndsWithin != nil && *f.TrialEndsWithin < 0 {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query")
+		return f, false
+	}
+	if f.UserID != nil && *f.UserID == "" {
+		f.UserID = nil
+	}
+	f.Tags = splitTags(f.Tags)
+	if f.UserID == nil && !middleware.IsAdmin(c) {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "user_id required")
+		return f, false
+	}
+	if f.ActiveOn != nil {
+		if _, _, err := dates.Parse(*f.ActiveOn); err != nil {
+			respondError(c, http.StatusBadRequest, models.CodeInvalidDate, "Invalid active_on")
+			return f, false
+		}
+	}
+	return f, true
 }
 
 // @Summary Get subscription by ID
-// @Description Returns the subscription with the specified ID
+// @Description Returns the subscription with the specified ID. A deleted subscription is only returned to administrators with include_deleted.
+// @Description The ETag header carries the version of the subscription; with If-None-Match listing it the response is 304 without a body.
 // @Tags subscriptions
 // @Produce json
 // @Param id path string true "Subscription ID"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Param include_deleted query bool false "Also return a deleted subscription, admin only"
+// @Param X-Admin-Token header string false "Admin token"
+// @Param If-None-Match header string false "ETag of a cached copy"
 // @Success 200 {object} models.Subscription
+// @Success 304 "Not Modified"
+// @Header 200,304 {string} ETag "Version of the subscription"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
 // @Router /subscriptions/{id} [get]
 func (h *Handler) GetSubscription(c *gin.Context) {
 	id := c.Param("id")
-	sub, err := h.Repo.GetSubscriptionByID(id)
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	withDeleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+	if withDeleted {
+		ctx = repo.WithDeleted(ctx)
+	}
+
+	sub, err := h.Repo.GetSubscriptionByID(ctx, id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Not found"})
+		handleError(ctx, c, err, "Could not fetch subscription")
+		return
+	}
+	setETag(c, sub)
+	if notModified(c, sub) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
 		return
 	}
+	formatDates(&sub, format)
 	c.JSON(http.StatusOK, sub)
 }
 
 // @Summary Update a subscription
-// @Description Updates an existing subscription by ID
+// @Description Updates an existing subscription by ID.
+// @Description Invalid fields are reported with 422 and a per-field error list. Dates that would leave a price change or a pause outside the subscription are rejected with 400.
+// @Description With If-Match set to the ETag of the subscription the update only succeeds if nobody changed it since, and fails with 412 otherwise. The server may be configured to require If-Match and reject updates without it with 428.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param id path string true "Subscription ID"
 // @Param input body models.Subscription true "Updated subscription data"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Param If-Match header string false "ETag the subscription must still have"
 // @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "New version of the subscription"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
 // @Router /subscriptions/{id} [put]
 func (h *Handler) UpdateSubscription(c *gin.Context) {
 	id := c.Param("id")
 	var s models.Subscription
 	if err := c.ShouldBindJSON(&s); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid input"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return
+	}
+	if fields := validation.Struct(s); fields != nil {
+		respondValidation(c, fields)
 		return
 	}
 	s.ID = id
-	sub, err := h.Repo.UpdateSubscription(s)
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	version, ok := h.ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+	if version != 0 {
+		ctx = repo.WithExpectedVersion(ctx, version)
+	}
+
+	sub, err := h.Repo.UpdateSubscription(ctx, s)
+	if err != nil {
+		handleError(ctx, c, err, "Update failed")
+		return
+	}
+	formatDates(&sub, format)
+	setETag(c, sub)
+	c.JSON(http.StatusOK, sub)
+}
+
+// @Summary Patch a subscription
+// @Description Changes only some fields of a subscription. With application/merge-patch+json (or plain application/json) the body is a JSON Merge Patch (RFC 7396): fields set to null are cleared and absent fields keep their values. With application/json-patch+json it is a JSON Patch (RFC 6902) applied to the subscription as returned by GET.
+// @Description The patched subscription is validated as a whole, and invalid fields are reported with 422. While service_id is set the service name comes from the catalog; clear service_id to name a service outside of it.
+// @Description Dates are checked against price changes and pauses, and If-Match is honored and may be required, as for updates. A patch whose test operation fails is rejected with 409.
+// @Tags subscriptions
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param input body object true "Merge patch or JSON Patch"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Param If-Match header string false "ETag the subscription must still have"
+// @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "New version of the subscription"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /subscriptions/{id} [patch]
+func (h *Handler) PatchSubscription(c *gin.Context) {
+	id := c.Param("id")
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch c.ContentType() {
+	case "application/merge-patch+json", "application/json":
+		apply = patch.Merge
+	case "application/json-patch+json":
+		apply = patch.Apply
+	default:
+		respondError(c, http.StatusUnsupportedMediaType, models.CodeInvalidInput,
+			"Expected application/merge-patch+json or application/json-patch+json")
+		return
+	}
+	body, err := c.GetRawData()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Update failed"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return
+	}
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	version, ok := h.ifMatchVersion(c)
+	if !ok {
 		return
 	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	// The patch is applied to the subscription as read, and the update only
+	// goes through if nobody changed it since. Without If-Match a concurrent
+	// change is not the client's concern, so the patch is simply reapplied.
+	var sub models.Subscription
+	for attempt := 1; ; attempt++ {
+		current, err := h.Repo.GetSubscriptionByID(ctx, id)
+		if err != nil {
+			handleError(ctx, c, err, "Could not fetch subscription")
+			return
+		}
+		if version != 0 && version != current.Version {
+			respondError(c, http.StatusPreconditionFailed, models.CodePreconditionFailed, "Precondition failed")
+			return
+		}
+		s, ok := patchSubscription(c, current, body, apply)
+		if !ok {
+			return
+		}
+		sub, err = h.Repo.UpdateSubscription(repo.WithExpectedVersion(ctx, current.Version), s)
+		if version == 0 && attempt < patchAttempts && errors.Is(err, repo.ErrVersionMismatch) {
+			continue
+		}
+		if err != nil {
+			handleError(ctx, c, err, "Patch failed")
+			return
+		}
+		break
+	}
+	formatDates(&sub, format)
+	setETag(c, sub)
 	c.JSON(http.StatusOK, sub)
 }
 
+// patchAttempts bounds how often PatchSubscription reapplies a patch that
+// raced with another change.
+const patchAttempts = 3
+
+// patchSubscription applies the patch in body to current and validates the
+// result. It responds and returns false when the patch cannot be applied or
+// the result is invalid.
+func patchSubscription(c *gin.Context, current models.Subscription, body []byte,
+	apply func(doc, patch []byte) ([]byte, error)) (models.Subscription, bool) {
+	doc, err := json.Marshal(current)
+	if err == nil {
+		doc, err = apply(doc, body)
+	}
+	switch {
+	case errors.Is(err, patch.ErrTestFailed):
+		respondError(c, http.StatusConflict, models.CodeConflict, "Patch test failed")
+		return current, false
+	case err != nil:
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid patch")
+		return current, false
+	}
+	var s models.Subscription
+	if err := json.Unmarshal(doc, &s); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return current, false
+	}
+	if fields := validation.Struct(s); fields != nil {
+		respondValidation(c, fields)
+		return current, false
+	}
+	s.ID = current.ID
+	return s, true
+}
+
 // @Summary Delete a subscription
-// @Description Deletes the subscription with the specified ID
+// @Description Deletes the subscription with the specified ID.
+// @Description The subscription is hidden from listings and summaries and can be restored with /subscriptions/{id}/restore until the retention period passes and it is purged.
+// @Description If-Match is honored and may be required as for updates.
 // @Tags subscriptions
 // @Produce json
 // @Param id path string true "Subscription ID"
+// @Param If-Match header string false "ETag the subscription must still have"
 // @Success 204 "No Content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
 // @Router /subscriptions/{id} [delete]
 func (h *Handler) DeleteSubscription(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.Repo.DeleteSubscription(id); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Delete failed"})
+	version, ok := h.ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+	if version != 0 {
+		ctx = repo.WithExpectedVersion(ctx, version)
+	}
+
+	err := h.Repo.DeleteSubscription(ctx, id)
+	if err != nil {
+		handleError(ctx, c, err, "Delete failed")
 		return
 	}
 	c.Status(http.StatusNoContent)
 	c.Writer.WriteHeaderNow()
 }
 
+// @Summary Restore a deleted subscription
+// @Description Undoes the deletion of a subscription that has not been purged yet.
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "Version of the subscription"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse "The subscription is not deleted"
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/restore [post]
+func (h *Handler) RestoreSubscription(c *gin.Context) {
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	sub, err := h.Repo.RestoreSubscription(ctx, c.Param("id"))
+	if err != nil {
+		handleError(ctx, c, err, "Could not restore subscription")
+		return
+	}
+	formatDates(&sub, format)
+	setETag(c, sub)
+	c.JSON(http.StatusOK, sub)
+}
+
 // @Summary Calculate total cost of subscriptions
-// @Description Calculates the total subscription cost over a given period, optionally filtered by user ID and service name
+// @Description Calculates the subscription cost over a given period month by month, optionally filtered by user ID and service name.
+// @Description Months that a subscription or the period covers only partly are charged for the share of days covered.
+// @Description Price changes recorded under /subscriptions/{id}/prices apply from their effective date, splitting the month they fall in.
+// @Description Days within a pause recorded under /subscriptions/{id}/pause are not charged.
+// @Description Days up to trial_end_date are free, and the intro_months that follow are charged at intro_price.
+// @Description Every subscription is charged its price normalized to one month (yearly prices are divided by 12, weekly ones multiplied by 52/12 and so on) for each month it is active within the period.
+// @Description With currency every amount is converted at the exchange rate effective for the month it is charged for; without it amounts in different currencies are added up as they are.
+// @Description With group_by the response also contains subtotals for every combination of the grouped fields.
+// @Description Grouped by tag, a subscription counts towards the group of each of its tags, so the subtotals may add up to more than the total.
+// @Description Deleted subscriptions are left out unless an administrator sets include_deleted.
 // @Tags subscriptions
 // @Produce json
-// @Param from query string true "Start date in MM-YYYY format"
-// @Param to query string true "End date in MM-YYYY format"
+// @Param from query string true "First day of the period, YYYY-MM-DD or MM-YYYY for the start of a month"
+// @Param to query string true "Last day of the period, YYYY-MM-DD or MM-YYYY for the end of a month"
 // @Param user_id query string false "Filter by user ID"
+// @Param service_id query string false "Filter by catalog service ID"
 // @Param service_name query string false "Filter by service name"
-// @Success 200 {object} map[string]int "Total cost"
+// @Param category query string false "Filter by category, ignoring case"
+// @Param tag query []string false "Only subscriptions with all of these tags, ignoring case (repeat or comma-separate)" collectionFormat(csv)
+// @Param currency query string false "ISO 4217 currency to convert the totals to"
+// @Param group_by query []string false "Group subtotals by service_name, user_id, currency, month, category and/or tag (repeat or comma-separate)" collectionFormat(csv)
+// @Param include_deleted query bool false "Also count deleted subscriptions, admin only"
+// @Param X-Admin-Token header string false "Admin token"
+// @Success 200 {object} models.SubscriptionSummary
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
 // @Router /subscriptions/summary [get]
 func (h *Handler) SumSubscriptions(c *gin.Context) {
 	var f models.SubscriptionSumRequest
 	if err := c.ShouldBindQuery(&f); err != nil || f.From == "" || f.To == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid query"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query")
+		return
+	}
+	groupBy, ok := parseGroupBy(f.GroupBy)
+	if !ok {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid group_by")
+		return
+	}
+	f.GroupBy = groupBy
+	f.Tags = splitTags(f.Tags)
+	if f.Currency != nil && !validation.Currency(*f.Currency) {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid currency")
+		return
+	}
+	withDeleted, ok := includeDeleted(c)
+	if !ok {
 		return
 	}
-	sum, err := h.Repo.SumSubscriptions(f)
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+	if withDeleted {
+		ctx = repo.WithDeleted(ctx)
+	}
+
+	summary, err := h.Repo.SumSubscriptions(ctx, f)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Could not calculate total"})
+		handleError(ctx, c, err, "Could not calculate total")
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"total": sum})
+	c.JSON(http.StatusOK, summary)
+}
+
+// parseGroupBy accepts group_by both as repeated parameters and as a
+// comma-separated list, dropping duplicates while keeping the order.
+func parseGroupBy(values []string) ([]string, bool) {
+	var groupBy []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		for _, g := range strings.Split(v, ",") {
+			g = strings.TrimSpace(g)
+			switch g {
+			case "":
+				continue
+			case models.GroupByServiceName, models.GroupByUserID, models.GroupByCurrency, models.GroupByMonth,
+				models.GroupByCategory, models.GroupByTag:
+			default:
+				return nil, false
+			}
+			if !seen[g] {
+				seen[g] = true
+				groupBy = append(groupBy, g)
+			}
+		}
+	}
+	return groupBy, true
+}
+
+// splitTags accepts the tag filter both as repeated parameters and as a
+// comma-separated list.
+func splitTags(values []string) []string {
+	var tags []string
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// includeDeleted reports whether the include_deleted query parameter asks to
+// see deleted subscriptions. It responds with 400 to a malformed value and
+// with 403 to non-admins setting it, returning false as the second value.
+func includeDeleted(c *gin.Context) (bool, bool) {
+	value := c.Query("include_deleted")
+	if value == "" {
+		return false, true
+	}
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid include_deleted")
+		return false, false
+	}
+	if include && !middleware.IsAdmin(c) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Admin token required")
+		return false, false
+	}
+	return include, true
 }
@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/MosinFAM/subs-app/internal/middleware"
 	"github.com/MosinFAM/subs-app/internal/models"
 	"github.com/MosinFAM/subs-app/internal/repo"
 	"github.com/gin-gonic/gin"
@@ -48,21 +53,25 @@ func TestHandler_CreateSubscription(t *testing.T) {
 	validSub := models.Subscription{
 		ServiceName: "Netflix",
 		Price:       1299,
-		UserID:      "user-123",
+		UserID:      "987e6543-e21b-12d3-a456-426614174999",
 		StartDate:   "01-2024",
 	}
+	endBeforeStart := "01-2024"
+	introPrice := 499
+	serviceID := "123e4567-e89b-12d3-a456-426614174000"
 
 	tests := []struct {
 		name       string
 		reqBody    interface{}
 		mockSetup  func()
 		wantStatus int
+		wantFields []string
 	}{
 		{
 			name:    "success",
 			reqBody: validSub,
 			mockSetup: func() {
-				mockRepo.EXPECT().CreateSubscription(gomock.AssignableToTypeOf(models.Subscription{})).
+				mockRepo.EXPECT().CreateSubscription(gomock.Any(), gomock.AssignableToTypeOf(models.Subscription{})).
 					Return(validSub, nil)
 			},
 			wantStatus: http.StatusOK,
@@ -73,11 +82,113 @@ func TestHandler_CreateSubscription(t *testing.T) {
 			mockSetup:  func() {},
 			wantStatus: http.StatusBadRequest,
 		},
+		{
+			name: "validation failed",
+			reqBody: models.Subscription{
+				ServiceName: "  ",
+				Price:       -100,
+				UserID:      "user-123",
+				StartDate:   "13-2024",
+			},
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"service_name", "price", "user_id", "start_date"},
+		},
+		{
+			name: "success by service id",
+			reqBody: models.Subscription{
+				ServiceID: &serviceID,
+				UserID:    "987e6543-e21b-12d3-a456-426614174999",
+				StartDate: "01-2024",
+			},
+			mockSetup: func() {
+				mockRepo.EXPECT().CreateSubscription(gomock.Any(), gomock.AssignableToTypeOf(models.Subscription{})).
+					Return(validSub, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "validation failed no service",
+			reqBody: models.Subscription{
+				UserID:    "987e6543-e21b-12d3-a456-426614174999",
+				StartDate: "01-2024",
+			},
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"service_name", "price"},
+		},
+		{
+			name: "validation failed category and tags",
+			reqBody: models.Subscription{
+				ServiceName: "Netflix",
+				Price:       1299,
+				UserID:      "987e6543-e21b-12d3-a456-426614174999",
+				StartDate:   "01-2024",
+				Category:    strings.Repeat("a", 101),
+				Tags:        []string{"family", " ", "a,b"},
+			},
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"category", "tags[1]", "tags[2]"},
+		},
+		{
+			name: "validation failed end before start",
+			reqBody: models.Subscription{
+				ServiceName: "Netflix",
+				Price:       1299,
+				UserID:      "987e6543-e21b-12d3-a456-426614174999",
+				StartDate:   "06-2024",
+				EndDate:     &endBeforeStart,
+			},
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"end_date"},
+		},
+		{
+			name: "validation failed billing period",
+			reqBody: models.Subscription{
+				ServiceName:   "Netflix",
+				Price:         1299,
+				UserID:        "987e6543-e21b-12d3-a456-426614174999",
+				StartDate:     "01-2024",
+				BillingPeriod: "daily",
+			},
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"billing_period"},
+		},
+		{
+			name: "validation failed custom period without months",
+			reqBody: models.Subscription{
+				ServiceName:   "Netflix",
+				Price:         1299,
+				UserID:        "987e6543-e21b-12d3-a456-426614174999",
+				StartDate:     "01-2024",
+				BillingPeriod: models.BillingCustom,
+			},
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"billing_months"},
+		},
+		{
+			name: "validation failed trial and intro",
+			reqBody: models.Subscription{
+				ServiceName:  "Netflix",
+				Price:        1299,
+				UserID:       "987e6543-e21b-12d3-a456-426614174999",
+				StartDate:    "06-2024",
+				TrialEndDate: &endBeforeStart,
+				IntroPrice:   &introPrice,
+			},
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"intro_months", "trial_end_date"},
+		},
 		{
 			name:    "internal error",
 			reqBody: validSub,
 			mockSetup: func() {
-				mockRepo.EXPECT().CreateSubscription(gomock.AssignableToTypeOf(models.Subscription{})).
+				mockRepo.EXPECT().CreateSubscription(gomock.Any(), gomock.AssignableToTypeOf(models.Subscription{})).
 					Return(models.Subscription{}, errors.New("db error"))
 			},
 			wantStatus: http.StatusInternalServerError,
@@ -104,6 +215,17 @@ func TestHandler_CreateSubscription(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, validSub.ServiceName, resp.ServiceName)
 			}
+			if tt.wantFields != nil {
+				var resp models.ErrorResponse
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.NoError(t, err)
+				assert.Equal(t, models.CodeValidation, resp.Code)
+				fields := make([]string, 0, len(resp.Fields))
+				for _, f := range resp.Fields {
+					fields = append(fields, f.Field)
+				}
+				assert.ElementsMatch(t, tt.wantFields, fields)
+			}
 		})
 	}
 }
@@ -124,10 +246,16 @@ func TestHandler_ListSubscriptions(t *testing.T) {
 			StartDate:   "01-2024",
 		},
 	}
+	next := "next-page"
+	page := models.SubscriptionPage{Items: subs, NextCursor: &next, Limit: 1, HasMore: true}
+	userID := "user-123"
+	minPrice := 500
+	trialDays := 7
 
 	tests := []struct {
 		name       string
 		query      string
+		admin      bool
 		mockSetup  func()
 		wantStatus int
 		wantLen    int
@@ -136,24 +264,102 @@ func TestHandler_ListSubscriptions(t *testing.T) {
 			name:  "success",
 			query: "user_id=user-123",
 			mockSetup: func() {
-				mockRepo.EXPECT().ListSubscriptions("user-123").
-					Return(subs, nil)
+				mockRepo.EXPECT().ListSubscriptions(gomock.Any(), models.SubscriptionListRequest{
+					UserID: &userID,
+					Limit:  models.DefaultListLimit,
+				}).Return(page, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantLen:    len(subs),
+		},
+		{
+			name:  "success with filters and cursor",
+			query: "user_id=user-123&min_price=500&sort=-price&cursor=abc&limit=1000",
+			mockSetup: func() {
+				mockRepo.EXPECT().ListSubscriptions(gomock.Any(), models.SubscriptionListRequest{
+					UserID:   &userID,
+					MinPrice: &minPrice,
+					Sort:     "-price",
+					Cursor:   "abc",
+					Limit:    models.MaxListLimit,
+				}).Return(page, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantLen:    len(subs),
+		},
+		{
+			name:  "admin lists all users",
+			query: "",
+			admin: true,
+			mockSetup: func() {
+				mockRepo.EXPECT().ListSubscriptions(gomock.Any(), models.SubscriptionListRequest{
+					Limit: models.DefaultListLimit,
+				}).Return(page, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantLen:    len(subs),
+		},
+		{
+			name:  "category and tags",
+			query: "user_id=user-123&category=streaming&tag=family,%20work&tag=shared",
+			mockSetup: func() {
+				category := "streaming"
+				mockRepo.EXPECT().ListSubscriptions(gomock.Any(), models.SubscriptionListRequest{
+					UserID:   &userID,
+					Category: &category,
+					Tags:     []string{"family", "work", "shared"},
+					Limit:    models.DefaultListLimit,
+				}).Return(page, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantLen:    len(subs),
+		},
+		{
+			name:  "trials ending soon",
+			query: "user_id=user-123&trial_ends_within=7",
+			mockSetup: func() {
+				mockRepo.EXPECT().ListSubscriptions(gomock.Any(), models.SubscriptionListRequest{
+					UserID:          &userID,
+					TrialEndsWithin: &trialDays,
+					Limit:           models.DefaultListLimit,
+				}).Return(page, nil)
 			},
 			wantStatus: http.StatusOK,
 			wantLen:    len(subs),
 		},
+		{
+			name:       "bad request negative trial_ends_within",
+			query:      "user_id=user-123&trial_ends_within=-1",
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
 		{
 			name:       "bad request missing user_id",
 			query:      "",
 			mockSetup:  func() {},
 			wantStatus: http.StatusBadRequest,
 		},
+		{
+			name:       "bad request invalid active_on",
+			query:      "user_id=user-123&active_on=2024-13",
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "bad request invalid cursor",
+			query: "user_id=user-123&cursor=garbage",
+			mockSetup: func() {
+				mockRepo.EXPECT().ListSubscriptions(gomock.Any(), gomock.AssignableToTypeOf(models.SubscriptionListRequest{})).
+					Return(models.SubscriptionPage{}, repo.ErrInvalidCursor)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
 		{
 			name:  "internal error",
 			query: "user_id=user-123",
 			mockSetup: func() {
-				mockRepo.EXPECT().ListSubscriptions("user-123").
-					Return(nil, errors.New("db error"))
+				mockRepo.EXPECT().ListSubscriptions(gomock.Any(), gomock.AssignableToTypeOf(models.SubscriptionListRequest{})).
+					Return(models.SubscriptionPage{}, errors.New("db error"))
 			},
 			wantStatus: http.StatusInternalServerError,
 		},
@@ -163,14 +369,19 @@ func TestHandler_ListSubscriptions(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockSetup()
 			c, w := getTestContextWithQuery("GET", "/subscriptions", tt.query)
+			if tt.admin {
+				c.Request.Header.Set("X-Admin-Token", "secret")
+				middleware.AdminAuth("secret")(c)
+			}
 			h.ListSubscriptions(c)
 
 			assert.Equal(t, tt.wantStatus, w.Code)
 			if tt.wantStatus == http.StatusOK {
-				var resp []models.Subscription
+				var resp models.SubscriptionPage
 				err := json.Unmarshal(w.Body.Bytes(), &resp)
 				assert.NoError(t, err)
-				assert.Len(t, resp, tt.wantLen)
+				assert.Len(t, resp.Items, tt.wantLen)
+				assert.Equal(t, page.NextCursor, resp.NextCursor)
 			}
 		})
 	}
@@ -196,24 +407,46 @@ func TestHandler_GetSubscription(t *testing.T) {
 		paramID    string
 		mockSetup  func()
 		wantStatus int
+		wantCode   string
 	}{
 		{
 			name:    "success",
 			paramID: "sub1",
 			mockSetup: func() {
-				mockRepo.EXPECT().GetSubscriptionByID("sub1").
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").
 					Return(sub, nil)
 			},
 			wantStatus: http.StatusOK,
 		},
+		{
+			name:    "timeout",
+			paramID: "sub1",
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").
+					Return(models.Subscription{}, context.DeadlineExceeded)
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   models.CodeTimeout,
+		},
 		{
 			name:    "not found",
 			paramID: "missing",
 			mockSetup: func() {
-				mockRepo.EXPECT().GetSubscriptionByID("missing").
-					Return(models.Subscription{}, errors.New("not found"))
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "missing").
+					Return(models.Subscription{}, repo.ErrNotFound)
 			},
 			wantStatus: http.StatusNotFound,
+			wantCode:   models.CodeNotFound,
+		},
+		{
+			name:    "internal error",
+			paramID: "sub1",
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").
+					Return(models.Subscription{}, errors.New("db error"))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   models.CodeInternal,
 		},
 	}
 
@@ -225,6 +458,12 @@ func TestHandler_GetSubscription(t *testing.T) {
 			h.GetSubscription(c)
 
 			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantCode != "" {
+				var resp models.ErrorResponse
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantCode, resp.Code)
+			}
 		})
 	}
 }
@@ -239,7 +478,7 @@ func TestHandler_UpdateSubscription(t *testing.T) {
 	validSub := models.Subscription{
 		ServiceName: "Netflix",
 		Price:       1299,
-		UserID:      "user-123",
+		UserID:      "987e6543-e21b-12d3-a456-426614174999",
 		StartDate:   "01-2024",
 	}
 
@@ -255,7 +494,7 @@ func TestHandler_UpdateSubscription(t *testing.T) {
 			paramID: "sub1",
 			reqBody: validSub,
 			mockSetup: func() {
-				mockRepo.EXPECT().UpdateSubscription(gomock.AssignableToTypeOf(models.Subscription{})).
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), gomock.AssignableToTypeOf(models.Subscription{})).
 					Return(validSub, nil)
 			},
 			wantStatus: http.StatusOK,
@@ -267,12 +506,44 @@ func TestHandler_UpdateSubscription(t *testing.T) {
 			mockSetup:  func() {},
 			wantStatus: http.StatusBadRequest,
 		},
+		{
+			name:    "validation failed",
+			paramID: "sub1",
+			reqBody: models.Subscription{
+				ServiceName: "Netflix",
+				Price:       1299,
+				UserID:      "987e6543-e21b-12d3-a456-426614174999",
+				StartDate:   "2024-01",
+			},
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "not found",
+			paramID: "missing",
+			reqBody: validSub,
+			mockSetup: func() {
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), gomock.AssignableToTypeOf(models.Subscription{})).
+					Return(models.Subscription{}, repo.ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:    "constraint violation",
+			paramID: "sub1",
+			reqBody: validSub,
+			mockSetup: func() {
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), gomock.AssignableToTypeOf(models.Subscription{})).
+					Return(models.Subscription{}, fmt.Errorf("%w: price", repo.ErrConstraint))
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
 		{
 			name:    "internal error",
 			paramID: "sub1",
 			reqBody: validSub,
 			mockSetup: func() {
-				mockRepo.EXPECT().UpdateSubscription(gomock.AssignableToTypeOf(models.Subscription{})).
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), gomock.AssignableToTypeOf(models.Subscription{})).
 					Return(models.Subscription{}, errors.New("db error"))
 			},
 			wantStatus: http.StatusInternalServerError,
@@ -298,6 +569,199 @@ func TestHandler_UpdateSubscription(t *testing.T) {
 	}
 }
 
+func TestHandler_PatchSubscription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	end := "2024-12-31"
+	current := models.Subscription{
+		ID:          "sub1",
+		ServiceName: "Netflix",
+		Price:       1299,
+		Currency:    "USD",
+		UserID:      "987e6543-e21b-12d3-a456-426614174999",
+		StartDate:   "2024-01-01",
+		EndDate:     &end,
+		Tags:        []string{"family"},
+		Version:     2,
+	}
+	hasPrice := func(price int, end *string) gomock.Matcher {
+		return gomock.Cond(func(x any) bool {
+			s := x.(models.Subscription)
+			return s.ID == "sub1" && s.Price == price && s.ServiceName == "Netflix" &&
+				assert.ObjectsAreEqual(end, s.EndDate) && assert.ObjectsAreEqual([]string{"family"}, s.Tags)
+		})
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		ifMatch     string
+		body        string
+		mockSetup   func()
+		wantStatus  int
+		wantCode    string
+	}{
+		{
+			name:        "merge patch keeps absent fields",
+			contentType: "application/merge-patch+json",
+			body:        `{"price": 1499}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil)
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), hasPrice(1499, &end)).Return(current, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "merge patch null clears field",
+			contentType: "application/json",
+			body:        `{"end_date": null}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil)
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), hasPrice(1299, nil)).Return(current, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "json patch",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/price", "value": 1299}, {"op": "replace", "path": "/price", "value": 1499}]`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil)
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), hasPrice(1499, &end)).Return(current, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "json patch replaces the whole document",
+			contentType: "application/json-patch+json",
+			body: `[{"op": "replace", "path": "", "value": {"service_name": "Netflix", "price": 1499, "user_id": "987e6543-e21b-12d3-a456-426614174999",` +
+				` "start_date": "2024-01-01", "end_date": "2024-12-31", "tags": ["family"]}}]`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil)
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), hasPrice(1499, &end)).Return(current, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "json patch replaces the document with an invalid one",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "replace", "path": "", "value": {"price": 1499}}]`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil)
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   models.CodeValidation,
+		},
+		{
+			name:        "json patch test failed",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/price", "value": 999}]`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil)
+			},
+			wantStatus: http.StatusConflict,
+			wantCode:   models.CodeConflict,
+		},
+		{
+			name:        "json patch missing path",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "remove", "path": "/nope"}]`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.CodeInvalidInput,
+		},
+		{
+			name:        "merged result invalid",
+			contentType: "application/merge-patch+json",
+			body:        `{"start_date": null}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil)
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   models.CodeValidation,
+		},
+		{
+			name:        "wrong type",
+			contentType: "application/merge-patch+json",
+			body:        `{"price": "cheap"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.CodeInvalidInput,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        `price=1499`,
+			mockSetup:   func() {},
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantCode:    models.CodeInvalidInput,
+		},
+		{
+			name:        "stale if-match",
+			contentType: "application/merge-patch+json",
+			ifMatch:     `"1"`,
+			body:        `{"price": 1499}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil)
+			},
+			wantStatus: http.StatusPreconditionFailed,
+			wantCode:   models.CodePreconditionFailed,
+		},
+		{
+			name:        "concurrent change is retried",
+			contentType: "application/merge-patch+json",
+			body:        `{"price": 1499}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(current, nil).Times(2)
+				gomock.InOrder(
+					mockRepo.EXPECT().UpdateSubscription(gomock.Any(), hasPrice(1499, &end)).
+						Return(models.Subscription{}, repo.ErrVersionMismatch),
+					mockRepo.EXPECT().UpdateSubscription(gomock.Any(), hasPrice(1499, &end)).Return(current, nil),
+				)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "not found",
+			contentType: "application/merge-patch+json",
+			body:        `{"price": 1499}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(models.Subscription{}, repo.ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+			wantCode:   models.CodeNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			c, w := getTestContext("PATCH", "/subscriptions/sub1", []byte(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+			if tt.ifMatch != "" {
+				c.Request.Header.Set("If-Match", tt.ifMatch)
+			}
+			c.Params = gin.Params{{Key: "id", Value: "sub1"}}
+			h.PatchSubscription(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantCode != "" {
+				var resp models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+			}
+		})
+	}
+}
+
 func TestHandler_DeleteSubscription(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -315,15 +779,23 @@ func TestHandler_DeleteSubscription(t *testing.T) {
 			name:    "success",
 			paramID: "sub1",
 			mockSetup: func() {
-				mockRepo.EXPECT().DeleteSubscription("sub1").Return(nil)
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), "sub1").Return(nil)
 			},
 			wantStatus: http.StatusNoContent,
 		},
+		{
+			name:    "not found",
+			paramID: "missing",
+			mockSetup: func() {
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), "missing").Return(repo.ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
 		{
 			name:    "internal error",
 			paramID: "sub1",
 			mockSetup: func() {
-				mockRepo.EXPECT().DeleteSubscription("sub1").Return(errors.New("db error"))
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), "sub1").Return(errors.New("db error"))
 			},
 			wantStatus: http.StatusInternalServerError,
 		},
@@ -344,60 +816,1244 @@ func TestHandler_DeleteSubscription(t *testing.T) {
 	}
 }
 
-func TestHandler_SumSubscriptions(t *testing.T) {
+func TestHandler_RestoreSubscription(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockRepo := repo.NewMockRepository(ctrl)
 	h := &Handler{Repo: mockRepo}
 
+	sub := models.Subscription{ID: "sub1", ServiceName: "Netflix", Price: 1299, UserID: "user-123", StartDate: "2024-01-01"}
+
 	tests := []struct {
 		name       string
-		query      string
+		paramID    string
 		mockSetup  func()
 		wantStatus int
-		wantTotal  int
+		wantCode   string
 	}{
 		{
-			name:  "success",
-			query: "from=01-2024&to=12-2024",
+			name:    "success",
+			paramID: "sub1",
 			mockSetup: func() {
-				mockRepo.EXPECT().SumSubscriptions(gomock.AssignableToTypeOf(models.SubscriptionSumRequest{})).
-					Return(10000, nil)
+				mockRepo.EXPECT().RestoreSubscription(gomock.Any(), "sub1").Return(sub, nil)
 			},
 			wantStatus: http.StatusOK,
-			wantTotal:  10000,
 		},
 		{
-			name:       "bad request invalid query",
-			query:      "to=12-2024",
-			mockSetup:  func() {},
-			wantStatus: http.StatusBadRequest,
+			name:    "not deleted",
+			paramID: "sub1",
+			mockSetup: func() {
+				mockRepo.EXPECT().RestoreSubscription(gomock.Any(), "sub1").
+					Return(models.Subscription{}, fmt.Errorf("%w: subscription sub1 is not deleted", repo.ErrConflict))
+			},
+			wantStatus: http.StatusConflict,
+			wantCode:   models.CodeConflict,
 		},
 		{
-			name:  "internal error",
-			query: "from=01-2024&to=12-2024",
+			name:    "not found",
+			paramID: "missing",
 			mockSetup: func() {
-				mockRepo.EXPECT().SumSubscriptions(gomock.AssignableToTypeOf(models.SubscriptionSumRequest{})).
-					Return(0, errors.New("db error"))
+				mockRepo.EXPECT().RestoreSubscription(gomock.Any(), "missing").Return(models.Subscription{}, repo.ErrNotFound)
 			},
-			wantStatus: http.StatusInternalServerError,
+			wantStatus: http.StatusNotFound,
+			wantCode:   models.CodeNotFound,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockSetup()
-			c, w := getTestContextWithQuery("GET", "/subscriptions/summary", tt.query)
-			h.SumSubscriptions(c)
+			c, w := getTestContext("POST", "/subscriptions/"+tt.paramID+"/restore", nil)
+			c.Params = gin.Params{{Key: "id", Value: tt.paramID}}
+			h.RestoreSubscription(c)
 
 			assert.Equal(t, tt.wantStatus, w.Code)
-			if tt.wantStatus == http.StatusOK {
-				var resp map[string]int
-				err := json.Unmarshal(w.Body.Bytes(), &resp)
-				assert.NoError(t, err)
-				assert.Equal(t, tt.wantTotal, resp["total"])
-			}
+			var resp models.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantCode, resp.Code)
 		})
 	}
 }
+
+func TestHandler_Preconditions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+
+	sub := models.Subscription{
+		ID:          "sub1",
+		ServiceName: "Netflix",
+		Price:       1299,
+		UserID:      "987e6543-e21b-12d3-a456-426614174999",
+		StartDate:   "01-2024",
+		Version:     3,
+	}
+	body, _ := json.Marshal(sub)
+
+	tests := []struct {
+		name           string
+		method         string
+		header         string
+		value          string
+		requireIfMatch bool
+		mockSetup      func()
+		wantStatus     int
+		wantCode       string
+		wantETag       string
+	}{
+		{
+			name:   "get sets etag",
+			method: "GET",
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(sub, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantETag:   `"3"`,
+		},
+		{
+			name:   "get not modified",
+			method: "GET",
+			header: "If-None-Match",
+			value:  `"2", W/"3"`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(sub, nil)
+			},
+			wantStatus: http.StatusNotModified,
+			wantETag:   `"3"`,
+		},
+		{
+			name:   "get modified",
+			method: "GET",
+			header: "If-None-Match",
+			value:  `"2"`,
+			mockSetup: func() {
+				mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").Return(sub, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantETag:   `"3"`,
+		},
+		{
+			name:   "update stale version",
+			method: "PUT",
+			header: "If-Match",
+			value:  `"2"`,
+			mockSetup: func() {
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), gomock.AssignableToTypeOf(models.Subscription{})).
+					Return(models.Subscription{}, fmt.Errorf("%w: subscription sub1 is at version 3", repo.ErrVersionMismatch))
+			},
+			wantStatus: http.StatusPreconditionFailed,
+			wantCode:   models.CodePreconditionFailed,
+		},
+		{
+			name:   "update matching version",
+			method: "PUT",
+			header: "If-Match",
+			value:  `"3"`,
+			mockSetup: func() {
+				updated := sub
+				updated.Version = 4
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), gomock.AssignableToTypeOf(models.Subscription{})).
+					Return(updated, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantETag:   `"4"`,
+		},
+		{
+			name:       "update weak tag",
+			method:     "PUT",
+			header:     "If-Match",
+			value:      `W/"3"`,
+			mockSetup:  func() {},
+			wantStatus: http.StatusPreconditionFailed,
+			wantCode:   models.CodePreconditionFailed,
+		},
+		{
+			name:           "update without if-match",
+			method:         "PUT",
+			requireIfMatch: true,
+			mockSetup:      func() {},
+			wantStatus:     http.StatusPreconditionRequired,
+			wantCode:       models.CodePreconditionRequired,
+		},
+		{
+			name:           "update any version",
+			method:         "PUT",
+			header:         "If-Match",
+			value:          "*",
+			requireIfMatch: true,
+			mockSetup: func() {
+				mockRepo.EXPECT().UpdateSubscription(gomock.Any(), gomock.AssignableToTypeOf(models.Subscription{})).
+					Return(sub, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantETag:   `"3"`,
+		},
+		{
+			name:           "delete without if-match",
+			method:         "DELETE",
+			requireIfMatch: true,
+			mockSetup:      func() {},
+			wantStatus:     http.StatusPreconditionRequired,
+			wantCode:       models.CodePreconditionRequired,
+		},
+		{
+			name:   "delete stale version",
+			method: "DELETE",
+			header: "If-Match",
+			value:  `"2"`,
+			mockSetup: func() {
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), "sub1").
+					Return(fmt.Errorf("%w: subscription sub1 is at version 3", repo.ErrVersionMismatch))
+			},
+			wantStatus: http.StatusPreconditionFailed,
+			wantCode:   models.CodePreconditionFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{Repo: mockRepo, RequireIfMatch: tt.requireIfMatch}
+			tt.mockSetup()
+			var reqBody []byte
+			if tt.method == "PUT" {
+				reqBody = body
+			}
+			c, w := getTestContext(tt.method, "/subscriptions/sub1", reqBody)
+			c.Params = gin.Params{{Key: "id", Value: "sub1"}}
+			if tt.header != "" {
+				c.Request.Header.Set(tt.header, tt.value)
+			}
+			switch tt.method {
+			case "GET":
+				h.GetSubscription(c)
+			case "PUT":
+				h.UpdateSubscription(c)
+			case "DELETE":
+				h.DeleteSubscription(c)
+			}
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantETag, w.Header().Get("ETag"))
+			if tt.wantStatus == http.StatusNotModified {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+			if tt.wantCode != "" {
+				var resp models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_BatchSubscriptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	id := "123e4567-e89b-12d3-a456-426614174000"
+	ops := []models.BatchOperation{{Op: models.BatchDelete, ID: id}, {Op: models.BatchDelete, ID: id}}
+	inTransaction := func() {
+		mockRepo.EXPECT().InTransaction(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, fn func(tx repo.Repository) error) error {
+				return fn(mockRepo)
+			})
+	}
+
+	tests := []struct {
+		name           string
+		req            models.BatchRequest
+		requireIfMatch bool
+		mockSetup      func()
+		wantStatus     int
+		wantCode       string
+		wantResults    []int
+	}{
+		{
+			name: "all or nothing",
+			req:  models.BatchRequest{Operations: ops},
+			mockSetup: func() {
+				inTransaction()
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), id).Return(nil).Times(2)
+			},
+			wantStatus:  http.StatusOK,
+			wantResults: []int{http.StatusNoContent, http.StatusNoContent},
+		},
+		{
+			name: "all or nothing internal error",
+			req:  models.BatchRequest{Operations: ops},
+			mockSetup: func() {
+				inTransaction()
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), id).Return(errors.New("db error"))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   models.CodeInternal,
+		},
+		{
+			name: "all or nothing conflict",
+			req:  models.BatchRequest{Operations: ops},
+			mockSetup: func() {
+				inTransaction()
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), id).Return(nil)
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), id).Return(fmt.Errorf("%w: deleted", repo.ErrConflict))
+			},
+			wantStatus: http.StatusConflict,
+			wantCode:   models.CodeConflict,
+		},
+		{
+			name: "best effort",
+			req:  models.BatchRequest{Mode: models.BatchBestEffort, Operations: ops},
+			mockSetup: func() {
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), id).Return(errors.New("db error"))
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), id).Return(nil)
+			},
+			wantStatus:  http.StatusOK,
+			wantResults: []int{http.StatusInternalServerError, http.StatusNoContent},
+		},
+		{
+			name: "if_match expects the version",
+			req: models.BatchRequest{Operations: []models.BatchOperation{
+				{Op: models.BatchDelete, ID: id, IfMatch: `"3"`},
+			}},
+			requireIfMatch: true,
+			mockSetup: func() {
+				inTransaction()
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), id).
+					DoAndReturn(func(ctx context.Context, id string) error {
+						return fmt.Errorf("%w: expected version 3, found 4", repo.ErrVersionMismatch)
+					})
+			},
+			wantStatus: http.StatusPreconditionFailed,
+			wantCode:   models.CodePreconditionFailed,
+		},
+		{
+			name:           "if_match required",
+			req:            models.BatchRequest{Operations: ops},
+			requireIfMatch: true,
+			mockSetup:      func() {},
+			wantStatus:     http.StatusPreconditionRequired,
+			wantCode:       models.CodePreconditionRequired,
+		},
+		{
+			name: "if_match that cannot match",
+			req: models.BatchRequest{Operations: []models.BatchOperation{
+				{Op: models.BatchDelete, ID: id, IfMatch: "W/\"1\""},
+			}},
+			mockSetup:  func() {},
+			wantStatus: http.StatusPreconditionFailed,
+			wantCode:   models.CodePreconditionFailed,
+		},
+		{
+			name: "best effort if_match required",
+			req: models.BatchRequest{Mode: models.BatchBestEffort, Operations: []models.BatchOperation{
+				{Op: models.BatchDelete, ID: id},
+				{Op: models.BatchDelete, ID: id, IfMatch: "*"},
+			}},
+			requireIfMatch: true,
+			mockSetup: func() {
+				mockRepo.EXPECT().DeleteSubscription(gomock.Any(), id).Return(nil)
+			},
+			wantStatus:  http.StatusOK,
+			wantResults: []int{http.StatusPreconditionRequired, http.StatusNoContent},
+		},
+		{
+			name: "too many operations",
+			req: models.BatchRequest{
+				Operations: make([]models.BatchOperation, models.MaxBatchOperations+1),
+			},
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   models.CodeValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			h.RequireIfMatch = tt.requireIfMatch
+			body, _ := json.Marshal(tt.req)
+			c, w := getTestContext("POST", "/subscriptions/batch", body)
+			h.BatchSubscriptions(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantCode != "" {
+				var resp models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+				return
+			}
+			var resp models.BatchResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			var statuses []int
+			for _, res := range resp.Results {
+				statuses = append(statuses, res.Status)
+			}
+			assert.Equal(t, tt.wantResults, statuses)
+		})
+	}
+}
+
+func TestHandler_ImportSubscriptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	userID := "987e6543-e21b-12d3-a456-426614174999"
+	csv := "service_name,price,start_date\nNetflix,1000,01-2024\nSpotify,500,02-2024\n"
+	inTransaction := func() {
+		mockRepo.EXPECT().InTransaction(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, fn func(tx repo.Repository) error) error {
+				return fn(mockRepo)
+			})
+	}
+	created := func(times int) {
+		mockRepo.EXPECT().CreateSubscription(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, s models.Subscription) (models.Subscription, error) {
+				return s, nil
+			}).Times(times)
+	}
+
+	tests := []struct {
+		name         string
+		query        string
+		body         string
+		mockSetup    func()
+		wantStatus   int
+		wantCode     string
+		wantStatuses []string
+	}{
+		{
+			name:         "created",
+			query:        "user_id=" + userID,
+			body:         csv,
+			mockSetup:    func() { inTransaction(); created(2) },
+			wantStatus:   http.StatusOK,
+			wantStatuses: []string{models.ImportCreated, models.ImportCreated},
+		},
+		{
+			name:         "dry run",
+			query:        "dry_run=true&user_id=" + userID,
+			body:         csv,
+			mockSetup:    func() { inTransaction(); created(2) },
+			wantStatus:   http.StatusOK,
+			wantStatuses: []string{models.ImportWouldCreate, models.ImportWouldCreate},
+		},
+		{
+			name:  "dry run fails like the import",
+			query: "dry_run=true&user_id=" + userID,
+			body:  csv,
+			mockSetup: func() {
+				inTransaction()
+				mockRepo.EXPECT().CreateSubscription(gomock.Any(), gomock.Any()).Return(models.Subscription{}, repo.ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+			wantCode:   models.CodeNotFound,
+		},
+		{
+			name:         "invalid rows are skipped",
+			query:        "delimiter=%3B&user_id=" + userID,
+			body:         "service_name;price;start_date\nNetflix;ten;01-2024\n;;\nSpotify;500;02-2024\n",
+			mockSetup:    func() { inTransaction(); created(1) },
+			wantStatus:   http.StatusOK,
+			wantStatuses: []string{models.ImportInvalid, models.ImportCreated},
+		},
+		{
+			name:  "conflict rolls back",
+			query: "user_id=" + userID,
+			body:  csv,
+			mockSetup: func() {
+				inTransaction()
+				created(1)
+				mockRepo.EXPECT().CreateSubscription(gomock.Any(), gomock.Any()).Return(models.Subscription{}, repo.ErrConflict)
+			},
+			wantStatus: http.StatusConflict,
+			wantCode:   models.CodeConflict,
+		},
+		{
+			name:       "unknown field in mapping",
+			query:      "column=cost:Price",
+			body:       csv,
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.CodeInvalidQuery,
+		},
+		{
+			name:       "mapped column missing",
+			query:      "column=price:Cost",
+			body:       csv,
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.CodeInvalidInput,
+		},
+		{
+			name:       "too many rows",
+			body:       "service_name\n" + strings.Repeat("Netflix\n", models.MaxImportRows+1),
+			mockSetup:  func() {},
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   models.CodeInvalidInput,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			c, w := getTestContext("POST", "/subscriptions/import?"+tt.query, []byte(tt.body))
+			c.Request.Header.Set("Content-Type", "text/csv")
+			h.ImportSubscriptions(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantCode != "" {
+				var resp models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+				return
+			}
+			var resp models.ImportResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			var statuses []string
+			for _, row := range resp.Rows {
+				statuses = append(statuses, row.Status)
+			}
+			assert.Equal(t, tt.wantStatuses, statuses)
+		})
+	}
+}
+
+func TestHandler_ExportSubscriptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	userID := "987e6543-e21b-12d3-a456-426614174999"
+	end := "2024-12-31"
+	subs := []models.Subscription{
+		{ID: "1", ServiceName: "Netflix", Price: 1000, Currency: "USD", UserID: userID, StartDate: "2024-01-01", EndDate: &end},
+		{ID: "2", ServiceName: "Spotify, Premium", Price: 500, Currency: "USD", UserID: userID, StartDate: "2024-02-01", Tags: []string{"music", "family"}},
+		{ID: "3", ServiceName: "=HYPERLINK(\"http://x\")", Price: 100, Currency: "USD", UserID: userID, StartDate: "2024-03-01", Category: "@sum", Tags: []string{"-1"}},
+	}
+	each := func(ctx context.Context, filter models.SubscriptionListRequest, fn func(models.Subscription) error) error {
+		for _, s := range subs {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		mockSetup  func()
+		wantStatus int
+		wantCode   string
+		wantType   string
+		wantBody   string
+	}{
+		{
+			name:  "csv",
+			query: "user_id=" + userID,
+			mockSetup: func() {
+				mockRepo.EXPECT().EachSubscription(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(each)
+			},
+			wantStatus: http.StatusOK,
+			wantType:   "text/csv; charset=utf-8",
+			wantBody: "id,service_id,service_name,price,currency,user_id,start_date,end_date,billing_period,billing_months,trial_end_date,intro_price,intro_months,category,tags,deleted_at\n" +
+				"1,,Netflix,1000,USD," + userID + ",01-2024,12-2024,,,,,,,,\n" +
+				"2,,\"Spotify, Premium\",500,USD," + userID + ",02-2024,,,,,,,,\"music,family\",\n" +
+				"3,,\"'=HYPERLINK(\"\"http://x\"\")\",100,USD," + userID + ",03-2024,,,,,,,'@sum,'-1,\n",
+		},
+		{
+			name:  "jsonl",
+			query: "format=jsonl&date_format=iso&user_id=" + userID,
+			mockSetup: func() {
+				mockRepo.EXPECT().EachSubscription(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(each)
+			},
+			wantStatus: http.StatusOK,
+			wantType:   "application/x-ndjson",
+			wantBody: `{"id":"1","service_name":"Netflix","price":1000,"currency":"USD","user_id":"` + userID +
+				`","start_date":"2024-01-01","end_date":"2024-12-31","billing_period":"","category":""}` + "\n" +
+				`{"id":"2","service_name":"Spotify, Premium","price":500,"currency":"USD","user_id":"` + userID +
+				`","start_date":"2024-02-01","billing_period":"","category":"","tags":["music","family"]}` + "\n" +
+				`{"id":"3","service_name":"=HYPERLINK(\"http://x\")","price":100,"currency":"USD","user_id":"` + userID +
+				`","start_date":"2024-03-01","billing_period":"","category":"@sum","tags":["-1"]}` + "\n",
+		},
+		{
+			name:  "nothing to export",
+			query: "user_id=" + userID,
+			mockSetup: func() {
+				mockRepo.EXPECT().EachSubscription(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+			wantType:   "text/csv; charset=utf-8",
+			wantBody:   "id,service_id,service_name,price,currency,user_id,start_date,end_date,billing_period,billing_months,trial_end_date,intro_price,intro_months,category,tags,deleted_at\n",
+		},
+		{
+			name:  "invalid sort",
+			query: "sort=user_id&user_id=" + userID,
+			mockSetup: func() {
+				mockRepo.EXPECT().EachSubscription(gomock.Any(), gomock.Any(), gomock.Any()).Return(repo.ErrInvalidSort)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.CodeInvalidSort,
+		},
+		{
+			name:       "invalid format",
+			query:      "format=pdf&user_id=" + userID,
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.CodeInvalidQuery,
+		},
+		{
+			name:       "missing user_id",
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   models.CodeInvalidQuery,
+		},
+	}
+
+	t.Run("failure after the download started", func(t *testing.T) {
+		mockRepo.EXPECT().EachSubscription(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, filter models.SubscriptionListRequest, fn func(models.Subscription) error) error {
+				assert.NoError(t, fn(subs[0]))
+				return context.DeadlineExceeded
+			})
+		c, _ := getTestContextWithQuery("GET", "/subscriptions/export", "user_id="+userID)
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() { h.ExportSubscriptions(c) })
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			c, w := getTestContextWithQuery("GET", "/subscriptions/export", tt.query)
+			h.ExportSubscriptions(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantCode != "" {
+				var resp models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.wantCode, resp.Code)
+				return
+			}
+			assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestHandler_SumSubscriptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	summary := models.SubscriptionSummary{
+		Total: 10000,
+		Months: []models.MonthlyCost{
+			{Month: "01-2024", Total: 5000},
+			{Month: "02-2024", Total: 5000},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		mockSetup  func()
+		wantStatus int
+		wantTotal  int
+	}{
+		{
+			name:  "success",
+			query: "from=01-2024&to=12-2024",
+			mockSetup: func() {
+				mockRepo.EXPECT().SumSubscriptions(gomock.Any(), gomock.AssignableToTypeOf(models.SubscriptionSumRequest{})).
+					Return(summary, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantTotal:  summary.Total,
+		},
+		{
+			name:       "bad request invalid query",
+			query:      "to=12-2024",
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "success grouped",
+			query: "from=01-2024&to=12-2024&group_by=service_name,month&group_by=service_name",
+			mockSetup: func() {
+				mockRepo.EXPECT().SumSubscriptions(gomock.Any(), models.SubscriptionSumRequest{
+					From:    "01-2024",
+					To:      "12-2024",
+					GroupBy: []string{models.GroupByServiceName, models.GroupByMonth},
+				}).Return(summary, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantTotal:  summary.Total,
+		},
+		{
+			name:  "success grouped by category and tag",
+			query: "from=01-2024&to=12-2024&group_by=category,tag&tag=family",
+			mockSetup: func() {
+				mockRepo.EXPECT().SumSubscriptions(gomock.Any(), models.SubscriptionSumRequest{
+					From:    "01-2024",
+					To:      "12-2024",
+					Tags:    []string{"family"},
+					GroupBy: []string{models.GroupByCategory, models.GroupByTag},
+				}).Return(summary, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantTotal:  summary.Total,
+		},
+		{
+			name:  "bad request invalid date",
+			query: "from=12-2024&to=01-2024",
+			mockSetup: func() {
+				mockRepo.EXPECT().SumSubscriptions(gomock.Any(), gomock.AssignableToTypeOf(models.SubscriptionSumRequest{})).
+					Return(models.SubscriptionSummary{}, fmt.Errorf("%w: from must not be after to", repo.ErrInvalidDate))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "bad request invalid group_by",
+			query:      "from=01-2024&to=12-2024&group_by=price",
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "success converted",
+			query: "from=01-2024&to=12-2024&currency=EUR",
+			mockSetup: func() {
+				currency := "EUR"
+				mockRepo.EXPECT().SumSubscriptions(gomock.Any(), models.SubscriptionSumRequest{
+					From:     "01-2024",
+					To:       "12-2024",
+					Currency: &currency,
+				}).Return(summary, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantTotal:  summary.Total,
+		},
+		{
+			name:       "bad request invalid currency",
+			query:      "from=01-2024&to=12-2024&currency=euro",
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "missing exchange rate",
+			query: "from=01-2024&to=12-2024&currency=EUR",
+			mockSetup: func() {
+				mockRepo.EXPECT().SumSubscriptions(gomock.Any(), gomock.AssignableToTypeOf(models.SubscriptionSumRequest{})).
+					Return(models.SubscriptionSummary{}, fmt.Errorf("%w: RUB in 01-2024", repo.ErrNoRate))
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "internal error",
+			query: "from=01-2024&to=12-2024",
+			mockSetup: func() {
+				mockRepo.EXPECT().SumSubscriptions(gomock.Any(), gomock.AssignableToTypeOf(models.SubscriptionSumRequest{})).
+					Return(models.SubscriptionSummary{}, errors.New("db error"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			c, w := getTestContextWithQuery("GET", "/subscriptions/summary", tt.query)
+			h.SumSubscriptions(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				var resp models.SubscriptionSummary
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantTotal, resp.Total)
+				assert.Equal(t, summary.Months, resp.Months)
+			}
+		})
+	}
+}
+
+func TestHandler_AddPriceChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	change := models.PriceChange{EffectiveFrom: "2024-06-01", Price: 1499}
+
+	tests := []struct {
+		name       string
+		body       string
+		mockSetup  func()
+		wantStatus int
+	}{
+		{
+			name: "success",
+			body: `{"effective_from":"2024-06-01","price":1499}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddPriceChange(gomock.Any(), "sub1", change).Return(change, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "bad request invalid json",
+			body:       `{invalid json`,
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "validation failed",
+			body:       `{"effective_from":"June","price":0}`,
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "not found",
+			body: `{"effective_from":"2024-06-01","price":1499}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddPriceChange(gomock.Any(), "sub1", change).Return(change, repo.ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "duplicate change",
+			body: `{"effective_from":"2024-06-01","price":1499}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().AddPriceChange(gomock.Any(), "sub1", change).Return(change, repo.ErrConflict)
+			},
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			c, w := getTestContext("POST", "/subscriptions/sub1/prices?date_format=iso", []byte(tt.body))
+			c.Params = gin.Params{{Key: "id", Value: "sub1"}}
+			h.AddPriceChange(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				var resp models.PriceChange
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, change, resp)
+			}
+		})
+	}
+}
+
+func TestHandler_PauseSubscription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	to := "2024-08-31"
+	pause := models.Pause{From: "2024-06-01", To: &to}
+	sub := models.Subscription{ID: "sub1", StartDate: "2024-01-01", Pauses: []models.Pause{pause}}
+
+	tests := []struct {
+		name       string
+		body       string
+		mockSetup  func()
+		wantStatus int
+	}{
+		{
+			name: "success",
+			body: `{"from":"2024-06-01","to":"2024-08-31"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().PauseSubscription(gomock.Any(), "sub1", pause).Return(sub, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "bad request invalid json",
+			body:       `{invalid json`,
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "validation failed",
+			body:       `{"from":"2024-06-01","to":"2024-05-31"}`,
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "overlapping pause",
+			body: `{"from":"2024-06-01","to":"2024-08-31"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().PauseSubscription(gomock.Any(), "sub1", pause).Return(models.Subscription{}, repo.ErrConflict)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "outside the subscription",
+			body: `{"from":"2024-06-01","to":"2024-08-31"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().PauseSubscription(gomock.Any(), "sub1", pause).Return(models.Subscription{}, repo.ErrInvalidInput)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			c, w := getTestContext("POST", "/subscriptions/sub1/pause?date_format=iso", []byte(tt.body))
+			c.Params = gin.Params{{Key: "id", Value: "sub1"}}
+			h.PauseSubscription(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				var resp models.Subscription
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, sub, resp)
+			}
+		})
+	}
+}
+
+func TestHandler_ResumeSubscription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	tests := []struct {
+		name       string
+		body       string
+		mockSetup  func()
+		wantStatus int
+	}{
+		{
+			name: "success",
+			body: `{"on":"2024-09-01"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ResumeSubscription(gomock.Any(), "sub1", "2024-09-01").Return(models.Subscription{ID: "sub1"}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "validation failed",
+			body:       `{}`,
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "not paused",
+			body: `{"on":"2024-09-01"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ResumeSubscription(gomock.Any(), "sub1", "2024-09-01").Return(models.Subscription{}, repo.ErrConflict)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "not found",
+			body: `{"on":"2024-09-01"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ResumeSubscription(gomock.Any(), "sub1", "2024-09-01").Return(models.Subscription{}, repo.ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			c, w := getTestContext("POST", "/subscriptions/sub1/resume", []byte(tt.body))
+			c.Params = gin.Params{{Key: "id", Value: "sub1"}}
+			h.ResumeSubscription(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestHandler_SetExchangeRates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	rates := []models.ExchangeRate{
+		{Currency: "EUR", Month: "01-2024", Rate: 0.9},
+		{Currency: "RUB", Month: "01-2024", Rate: 90},
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		mockSetup   func()
+		wantStatus  int
+		wantFields  []string
+	}{
+		{
+			name:        "success json",
+			contentType: "application/json",
+			body:        `[{"currency":"EUR","month":"01-2024","rate":0.9},{"currency":"RUB","month":"01-2024","rate":90}]`,
+			mockSetup: func() {
+				mockRepo.EXPECT().SetExchangeRates(gomock.Any(), rates).Return(nil)
+				mockRepo.EXPECT().ListExchangeRates(gomock.Any()).Return(rates, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "success csv",
+			contentType: "text/csv",
+			body:        "month,currency,rate\n01-2024,EUR,0.9\n01-2024,RUB,90\n",
+			mockSetup: func() {
+				mockRepo.EXPECT().SetExchangeRates(gomock.Any(), rates).Return(nil)
+				mockRepo.EXPECT().ListExchangeRates(gomock.Any()).Return(rates, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "bad request invalid csv",
+			contentType: "text/csv",
+			body:        "currency,month\nEUR,01-2024\n",
+			mockSetup:   func() {},
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "validation failed",
+			contentType: "application/json",
+			body:        `[{"currency":"EUR","month":"01-2024","rate":0.9},{"currency":"euro","month":"2024-01","rate":0}]`,
+			mockSetup:   func() {},
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantFields:  []string{"[1].currency", "[1].month", "[1].rate"},
+		},
+		{
+			name:        "internal error",
+			contentType: "application/json",
+			body:        `[{"currency":"EUR","month":"01-2024","rate":0.9}]`,
+			mockSetup: func() {
+				mockRepo.EXPECT().SetExchangeRates(gomock.Any(), gomock.Any()).Return(errors.New("db error"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			c, w := getTestContext("PUT", "/exchange-rates", []byte(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+			h.SetExchangeRates(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				var resp []models.ExchangeRate
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, rates, resp)
+			}
+			if tt.wantFields != nil {
+				var resp models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				fields := make([]string, 0, len(resp.Fields))
+				for _, f := range resp.Fields {
+					fields = append(fields, f.Field)
+				}
+				assert.ElementsMatch(t, tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestHandler_CreateService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	defaultPrice := 1299
+	svc := models.Service{
+		Name:            "Netflix",
+		Aliases:         []string{"NFLX"},
+		Category:        "video",
+		DefaultPrice:    &defaultPrice,
+		DefaultCurrency: "EUR",
+	}
+	created := svc
+	created.ID = "123e4567-e89b-12d3-a456-426614174000"
+
+	tests := []struct {
+		name       string
+		body       string
+		mockSetup  func()
+		wantStatus int
+		wantFields []string
+	}{
+		{
+			name: "success",
+			body: `{"name":"Netflix","aliases":["NFLX"],"category":"video","default_price":1299,"default_currency":"EUR"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().CreateService(gomock.Any(), svc).Return(created, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "bad request invalid json",
+			body:       `{invalid json`,
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "validation failed",
+			body:       `{"name":" ","aliases":[""],"default_price":0,"default_currency":"euro","homepage":"netflix"}`,
+			mockSetup:  func() {},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"name", "aliases[0]", "default_price", "default_currency", "homepage"},
+		},
+		{
+			name: "conflict",
+			body: `{"name":"Netflix"}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().CreateService(gomock.Any(), gomock.Any()).
+					Return(models.Service{}, repo.ErrConflict)
+			},
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			c, w := getTestContext("POST", "/services", []byte(tt.body))
+			h.CreateService(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				var resp models.Service
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, created, resp)
+			}
+			if tt.wantFields != nil {
+				var resp models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				fields := make([]string, 0, len(resp.Fields))
+				for _, f := range resp.Fields {
+					fields = append(fields, f.Field)
+				}
+				assert.ElementsMatch(t, tt.wantFields, fields)
+			}
+		})
+	}
+}
+
+func TestHandler_ListAuditEntries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo}
+
+	page := models.AuditPage{
+		Items: []models.AuditEntry{{
+			ID:             2,
+			SubscriptionID: "123e4567-e89b-12d3-a456-426614174000",
+			Action:         models.AuditUpdate,
+			Actor:          "admin",
+			At:             time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+			Changes:        map[string]models.FieldChange{"price": {Before: []byte("1000"), After: []byte("1200")}},
+		}},
+		Limit: models.DefaultListLimit,
+	}
+	action := models.AuditUpdate
+	from := "2024-06-01"
+
+	tests := []struct {
+		name       string
+		query      string
+		mockSetup  func()
+		wantStatus int
+	}{
+		{
+			name:  "success",
+			query: "action=update&from=2024-06-01&limit=1000",
+			mockSetup: func() {
+				mockRepo.EXPECT().ListAuditEntries(gomock.Any(), models.AuditListRequest{
+					Action: &action,
+					From:   &from,
+					Limit:  models.MaxListLimit,
+				}).Return(page, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "bad request invalid date",
+			query:      "to=2024-13-01",
+			mockSetup:  func() {},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "bad request invalid cursor",
+			query: "cursor=abc",
+			mockSetup: func() {
+				mockRepo.EXPECT().ListAuditEntries(gomock.Any(), gomock.Any()).Return(models.AuditPage{}, repo.ErrInvalidCursor)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "internal error",
+			query: "",
+			mockSetup: func() {
+				mockRepo.EXPECT().ListAuditEntries(gomock.Any(), gomock.Any()).Return(models.AuditPage{}, errors.New("db error"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			c, w := getTestContextWithQuery("GET", "/audit", tt.query)
+			h.ListAuditEntries(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				var resp models.AuditPage
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, page, resp)
+			}
+		})
+	}
+}
+
+func TestHandler_QueryTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := repo.NewMockRepository(ctrl)
+	h := &Handler{Repo: mockRepo, QueryTimeout: 10 * time.Millisecond}
+
+	mockRepo.EXPECT().GetSubscriptionByID(gomock.Any(), "sub1").
+		DoAndReturn(func(ctx context.Context, _ string) (models.Subscription, error) {
+			<-ctx.Done()
+			return models.Subscription{}, ctx.Err()
+		})
+
+	c, w := getTestContext("GET", "/subscriptions/sub1", nil)
+	c.Params = gin.Params{{Key: "id", Value: "sub1"}}
+	h.GetSubscription(c)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// withIdempotencyKey attaches the Idempotency-Key header of a create request
+// to ctx, together with a hash of the subscription s it asks for, so that a
+// retry gets the response of the first attempt. Without the header, or with
+// IdempotencyTTL unset, ctx is returned as is. It responds with 400 and
+// returns false for a malformed key.
+func (h *Handler) withIdempotencyKey(ctx context.Context, c *gin.Context, s models.Subscription) (context.Context, bool) {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" || h.IdempotencyTTL <= 0 {
+		return ctx, true
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Idempotency-Key is too long")
+		return ctx, false
+	}
+	// Hashing the bound subscription rather than the raw body lets a retry
+	// differ in formatting.
+	body, err := json.Marshal(s)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return ctx, false
+	}
+	hash := sha256.Sum256(body)
+	return repo.WithIdempotencyKey(ctx, repo.IdempotencyKey{
+		Key:       key,
+		Hash:      hex.EncodeToString(hash[:]),
+		ExpiresAt: time.Now().Add(h.IdempotencyTTL),
+	}), true
+}
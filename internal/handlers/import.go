@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/repo"
+	"github.com/MosinFAM/subs-app/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize bounds the size of an imported file in bytes.
+const maxImportSize = 10 << 20
+
+var errTooManyRows = fmt.Errorf("more than %d rows", models.MaxImportRows)
+
+// errDryRun rolls back the transaction of a dry-run import.
+var errDryRun = errors.New("dry run")
+
+// importFields stores a cell of an imported file in the subscription field
+// its column holds, reporting cells that do not fit the field.
+var importFields = map[string]func(s *models.Subscription, value string) error{
+	"service_id":     func(s *models.Subscription, v string) error { s.ServiceID = &v; return nil },
+	"service_name":   func(s *models.Subscription, v string) error { s.ServiceName = v; return nil },
+	"price":          importInt(func(s *models.Subscription, n int) { s.Price = n }),
+	"currency":       func(s *models.Subscription, v string) error { s.Currency = v; return nil },
+	"user_id":        func(s *models.Subscription, v string) error { s.UserID = v; return nil },
+	"start_date":     func(s *models.Subscription, v string) error { s.StartDate = v; return nil },
+	"end_date":       func(s *models.Subscription, v string) error { s.EndDate = &v; return nil },
+	"billing_period": func(s *models.Subscription, v string) error { s.BillingPeriod = v; return nil },
+	"billing_months": importInt(func(s *models.Subscription, n int) { s.BillingMonths = &n }),
+	"trial_end_date": func(s *models.Subscription, v string) error { s.TrialEndDate = &v; return nil },
+	"intro_price":    importInt(func(s *models.Subscription, n int) { s.IntroPrice = &n }),
+	"intro_months":   importInt(func(s *models.Subscription, n int) { s.IntroMonths = &n }),
+	"category":       func(s *models.Subscription, v string) error { s.Category = v; return nil },
+	"tags":           func(s *models.Subscription, v string) error { s.Tags = splitTags([]string{v}); return nil },
+}
+
+func importInt(set func(s *models.Subscription, n int)) func(s *models.Subscription, value string) error {
+	return func(s *models.Subscription, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		set(s, n)
+		return nil
+	}
+}
+
+// csvImport describes how the rows of an imported file become subscriptions.
+type csvImport struct {
+	// columns maps subscription fields to the headers of the columns holding
+	// them. Other fields are read from columns named like them.
+	columns   map[string]string
+	delimiter rune
+	// userID is used for rows without a user_id of their own.
+	userID string
+}
+
+// @Summary Import subscriptions from CSV
+// @Description Creates subscriptions from the rows of a CSV file, sent as the file field of a multipart form or as the request body. The first row holds the column headers.
+// @Description Columns are matched to subscription fields by name, ignoring case, unless the column parameter maps a field to another header, like price:Cost. Tags are comma-separated within their cell, and rows without a user_id get the one given as a parameter. The ' an export puts before text that would start a formula is dropped.
+// @Description Every row is validated like a created subscription. The valid rows are created in one transaction, and if any of them fails none is; the invalid ones are reported along with the errors. With dry_run the transaction is rolled back, so the response shows what would be created, or the error the import would fail with, and nothing is kept.
+// @Tags subscriptions
+// @Accept mpfd
+// @Accept text/csv
+// @Accept plain
+// @Produce json
+// @Param file formData file false "CSV file, for multipart requests"
+// @Param column query []string false "Header of the column holding a field, as field:header (repeat or comma-separate)" collectionFormat(csv)
+// @Param delimiter query string false "Field delimiter, a single character" default(,)
+// @Param user_id query string false "User of the rows without a user_id"
+// @Param dry_run query bool false "Only validate the rows"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Success 200 {object} models.ImportResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /subscriptions/import [post]
+func (h *Handler) ImportSubscriptions(c *gin.Context) {
+	dryRun := false
+	if v := c.Query("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid dry_run")
+			return
+		}
+	}
+	columns, ok := parseColumnMapping(c.QueryArray("column"))
+	if !ok {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid column")
+		return
+	}
+	sep := c.DefaultQuery("delimiter", ",")
+	delimiter, size := utf8.DecodeRuneInString(sep)
+	if size != len(sep) || delimiter == utf8.RuneError ||
+		delimiter == '"' || delimiter == '\r' || delimiter == '\n' {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid delimiter")
+		return
+	}
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+
+	src, err := importSource(c)
+	if err != nil {
+		respondImportError(c, err)
+		return
+	}
+	defer src.Close()
+	rows, err := readImport(src, csvImport{columns: columns, delimiter: delimiter, userID: c.Query("user_id")})
+	if err != nil {
+		respondImportError(c, err)
+		return
+	}
+
+	resp := models.ImportResponse{DryRun: dryRun, Rows: rows}
+	for _, row := range rows {
+		if row.Status == models.ImportInvalid {
+			resp.Invalid++
+		} else {
+			resp.Valid++
+		}
+	}
+	if resp.Valid > 0 {
+		ctx, cancel := h.requestContext(c)
+		defer cancel()
+
+		if line, err := h.createImportRows(ctx, rows, dryRun); err != nil {
+			if m, ok := lookupError(ctx, err); ok {
+				respondError(c, m.status, m.code, fmt.Sprintf("Line %d: %s", line, m.message))
+				return
+			}
+			handleError(ctx, c, err, "Import failed")
+			return
+		}
+		if !dryRun {
+			resp.Created = resp.Valid
+		}
+	}
+
+	for _, row := range rows {
+		if row.Subscription != nil {
+			formatDates(row.Subscription, format)
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// createImportRows creates the subscriptions of the valid rows in one
+// transaction. A dry run rolls it back, so that it fails wherever the import
+// would. It returns the line of the row that failed along with the error.
+func (h *Handler) createImportRows(ctx context.Context, rows []models.ImportRow, dryRun bool) (int, error) {
+	line := 0
+	err := h.Repo.InTransaction(ctx, func(tx repo.Repository) error {
+		for i := range rows {
+			if rows[i].Status == models.ImportInvalid {
+				continue
+			}
+			sub, err := tx.CreateSubscription(ctx, *rows[i].Subscription)
+			if err != nil {
+				line = rows[i].Line
+				return err
+			}
+			if dryRun {
+				// The subscription is not kept, and neither is its ID.
+				sub.ID = ""
+			} else {
+				rows[i].Status = models.ImportCreated
+			}
+			rows[i].Subscription = &sub
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return 0, nil
+	}
+	return line, err
+}
+
+// parseColumnMapping reads field:header pairs, given as repeated parameters
+// or as a comma-separated list.
+func parseColumnMapping(values []string) (map[string]string, bool) {
+	columns := make(map[string]string)
+	for _, v := range values {
+		for _, pair := range strings.Split(v, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			field, header, ok := strings.Cut(pair, ":")
+			field, header = strings.TrimSpace(field), strings.TrimSpace(header)
+			if _, known := importFields[field]; !ok || !known || header == "" {
+				return nil, false
+			}
+			columns[field] = header
+		}
+	}
+	return columns, true
+}
+
+// importSource returns the CSV sent as the file field of a multipart form or
+// as the request body, limited to maxImportSize.
+func importSource(c *gin.Context) (io.ReadCloser, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	if c.ContentType() != "multipart/form-data" {
+		return c.Request.Body, nil
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	return file.Open()
+}
+
+func respondImportError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || errors.Is(err, errTooManyRows) {
+		respondError(c, http.StatusRequestEntityTooLarge, models.CodeInvalidInput,
+			fmt.Sprintf("At most %d rows and %d bytes can be imported at once", models.MaxImportRows, maxImportSize))
+		return
+	}
+	respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid CSV: "+err.Error())
+}
+
+// importColumn is a column of an imported file holding a subscription field.
+type importColumn struct {
+	field string
+	index int
+}
+
+// readImport reads the subscriptions in the rows of r and validates them.
+// Rows with every cell blank are skipped.
+func readImport(r io.Reader, opts csvImport) ([]models.ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = opts.delimiter
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns, err := opts.columnsOf(header)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []models.ImportRow{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if blankRecord(record) {
+			continue
+		}
+		if len(rows) == models.MaxImportRows {
+			return nil, errTooManyRows
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, opts.row(line, record, columns))
+	}
+}
+
+// columnsOf finds the columns holding subscription fields in header.
+func (opts csvImport) columnsOf(header []string) ([]importColumn, error) {
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	var columns []importColumn
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		for field := range importFields {
+			want, mapped := opts.columns[field]
+			if !mapped {
+				want = field
+			}
+			if strings.EqualFold(name, want) {
+				columns = append(columns, importColumn{field: field, index: i})
+			}
+		}
+	}
+	for field, want := range opts.columns {
+		found := false
+		for _, col := range columns {
+			found = found || col.field == field
+		}
+		if !found {
+			return nil, fmt.Errorf("no column %q for %s", want, field)
+		}
+	}
+	if columns == nil {
+		return nil, errors.New("no column holds a subscription field")
+	}
+	return columns, nil
+}
+
+// row turns the record on line into a subscription and validates it.
+func (opts csvImport) row(line int, record []string, columns []importColumn) models.ImportRow {
+	var s models.Subscription
+	var errs []models.FieldError
+	failed := make(map[string]bool)
+	for _, col := range columns {
+		if col.index >= len(record) {
+			continue
+		}
+		value := importedText(strings.TrimSpace(record[col.index]))
+		if value == "" {
+			continue
+		}
+		if err := importFields[col.field](&s, value); err != nil {
+			errs = append(errs, models.FieldError{Field: col.field, Code: "integer", Message: err.Error()})
+			failed[col.field] = true
+		}
+	}
+	if s.UserID == "" {
+		s.UserID = opts.userID
+	}
+	// A cell that could not be read is reported once, not again as missing.
+	for _, fe := range validation.Struct(s) {
+		if !failed[fe.Field] {
+			errs = append(errs, fe)
+		}
+	}
+	if errs != nil {
+		return models.ImportRow{Line: line, Status: models.ImportInvalid, Errors: errs}
+	}
+	return models.ImportRow{Line: line, Status: models.ImportWouldCreate, Subscription: &s}
+}
+
+func blankRecord(record []string) bool {
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Pause a subscription
+// @Description Records a pause from from to to, both included; without to the subscription stays paused until it is resumed.
+// @Description Paused days are not charged in summaries, and a subscription paused throughout a day or month is not listed as active on it.
+// @Description A pause must lie within the subscription and must not overlap another one; a pause starting the day after another ends is merged with it.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param input body models.Pause true "Pause"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "New version of the subscription"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/pause [post]
+func (h *Handler) PauseSubscription(c *gin.Context) {
+	var p models.Pause
+	if err := c.ShouldBindJSON(&p); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return
+	}
+	if fields := validation.Struct(p); fields != nil {
+		respondValidation(c, fields)
+		return
+	}
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	sub, err := h.Repo.PauseSubscription(ctx, c.Param("id"), p)
+	if err != nil {
+		handleError(ctx, c, err, "Could not pause subscription")
+		return
+	}
+	formatDates(&sub, format)
+	setETag(c, sub)
+	c.JSON(http.StatusOK, sub)
+}
+
+// @Summary Resume a subscription
+// @Description Ends the pause that the day on falls in, so the subscription is charged again from that day. A pause starting on that day is removed.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param input body models.ResumeRequest true "First day to charge again"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "New version of the subscription"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse "The subscription is not paused on that day"
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/resume [post]
+func (h *Handler) ResumeSubscription(c *gin.Context) {
+	var req models.ResumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return
+	}
+	if fields := validation.Struct(req); fields != nil {
+		respondValidation(c, fields)
+		return
+	}
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	sub, err := h.Repo.ResumeSubscription(ctx, c.Param("id"), req.On)
+	if err != nil {
+		handleError(ctx, c, err, "Could not resume subscription")
+		return
+	}
+	formatDates(&sub, format)
+	setETag(c, sub)
+	c.JSON(http.StatusOK, sub)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/MosinFAM/subs-app/internal/dates"
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Add a price change
+// @Description Sets a new price of the subscription from effective_from on, so summaries charge every month at the price in effect.
+// @Description The change must take effect after start_date and no later than end_date.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param input body models.PriceChange true "Price change"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Success 200 {object} models.PriceChange
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/prices [post]
+func (h *Handler) AddPriceChange(c *gin.Context) {
+	var p models.PriceChange
+	if err := c.ShouldBindJSON(&p); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return
+	}
+	if fields := validation.Struct(p); fields != nil {
+		respondValidation(c, fields)
+		return
+	}
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	added, err := h.Repo.AddPriceChange(ctx, c.Param("id"), p)
+	if err != nil {
+		handleError(ctx, c, err, "Could not add price change")
+		return
+	}
+	added.EffectiveFrom = dates.Reformat(added.EffectiveFrom, format)
+	c.JSON(http.StatusOK, added)
+}
+
+// @Summary List price changes
+// @Description Returns the price changes of the subscription ordered by date. Before the first change the subscription's own price applies.
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param date_format query string false "Format of dates in the response: month (MM-YYYY) or iso (YYYY-MM-DD); also read from the date-format parameter of the Accept header" Enums(month, iso)
+// @Success 200 {array} models.PriceChange
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/prices [get]
+func (h *Handler) ListPriceChanges(c *gin.Context) {
+	format, ok := dateFormat(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	changes, err := h.Repo.ListPriceChanges(ctx, c.Param("id"))
+	if err != nil {
+		handleError(ctx, c, err, "Could not fetch price changes")
+		return
+	}
+	for i := range changes {
+		changes[i].EffectiveFrom = dates.Reformat(changes[i].EffectiveFrom, format)
+	}
+	c.JSON(http.StatusOK, changes)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"github.com/MosinFAM/subs-app/internal/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes mounts the subscription, service catalog, audit log and
+// exchange rate endpoints on r.
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	subscriptions := r.Group("/subscriptions")
+	{
+		subscriptions.POST("", h.CreateSubscription)
+		subscriptions.GET("", h.ListSubscriptions)
+		subscriptions.GET(":id", h.GetSubscription)
+		subscriptions.PUT(":id", h.UpdateSubscription)
+		subscriptions.PATCH(":id", h.PatchSubscription)
+		subscriptions.DELETE(":id", h.DeleteSubscription)
+		subscriptions.POST(":id/restore", h.RestoreSubscription)
+		subscriptions.POST(":id/prices", h.AddPriceChange)
+		subscriptions.GET(":id/prices", h.ListPriceChanges)
+		subscriptions.POST(":id/pause", h.PauseSubscription)
+		subscriptions.POST(":id/resume", h.ResumeSubscription)
+		subscriptions.GET(":id/history", h.GetSubscriptionHistory)
+		subscriptions.POST("/batch", h.BatchSubscriptions)
+		subscriptions.POST("/import", h.ImportSubscriptions)
+		subscriptions.GET("/export", h.ExportSubscriptions)
+		subscriptions.GET("/summary", h.SumSubscriptions)
+	}
+
+	services := r.Group("/services")
+	{
+		services.GET("", h.ListServices)
+		services.POST("", middleware.RequireAdmin(), h.CreateService)
+		services.GET(":id", h.GetService)
+		services.PUT(":id", middleware.RequireAdmin(), h.UpdateService)
+		services.DELETE(":id", middleware.RequireAdmin(), h.DeleteService)
+	}
+
+	r.GET("/audit", middleware.RequireAdmin(), h.ListAuditEntries)
+
+	rates := r.Group("/exchange-rates")
+	{
+		rates.GET("", h.ListExchangeRates)
+		rates.PUT("", middleware.RequireAdmin(), h.SetExchangeRates)
+		rates.DELETE(":currency/:month", middleware.RequireAdmin(), h.DeleteExchangeRate)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/MosinFAM/subs-app/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Add a catalog service
+// @Description Adds a service to the catalog. Admin only.
+// @Description Subscriptions whose service_name matches the name or an alias, ignoring case and extra spaces, are linked to the service and take its name.
+// @Description A name or alias already used by another service is rejected with 409.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param input body models.Service true "Service"
+// @Param X-Admin-Token header string true "Admin token"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /services [post]
+func (h *Handler) CreateService(c *gin.Context) {
+	var svc models.Service
+	if err := c.ShouldBindJSON(&svc); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return
+	}
+	if fields := validation.Struct(svc); fields != nil {
+		respondValidation(c, fields)
+		return
+	}
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	created, err := h.Repo.CreateService(ctx, svc)
+	if err != nil {
+		handleError(ctx, c, err, "Could not create service")
+		return
+	}
+	c.JSON(http.StatusOK, created)
+}
+
+// @Summary List catalog services
+// @Description Returns every catalog service ordered by name.
+// @Tags services
+// @Produce json
+// @Success 200 {array} models.Service
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /services [get]
+func (h *Handler) ListServices(c *gin.Context) {
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	services, err := h.Repo.ListServices(ctx)
+	if err != nil {
+		handleError(ctx, c, err, "Could not fetch services")
+		return
+	}
+	c.JSON(http.StatusOK, services)
+}
+
+// @Summary Get catalog service by ID
+// @Description Returns the catalog service with the specified ID
+// @Tags services
+// @Produce json
+// @Param id path string true "Service ID"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /services/{id} [get]
+func (h *Handler) GetService(c *gin.Context) {
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	svc, err := h.Repo.GetServiceByID(ctx, c.Param("id"))
+	if err != nil {
+		handleError(ctx, c, err, "Could not fetch service")
+		return
+	}
+	c.JSON(http.StatusOK, svc)
+}
+
+// @Summary Update a catalog service
+// @Description Replaces the catalog service with the specified ID and renames the subscriptions linked to it, except deleted ones, which keep their name. Admin only.
+// @Tags services
+// @Accept json
+// @Produce json
+// @Param id path string true "Service ID"
+// @Param input body models.Service true "Service"
+// @Param X-Admin-Token header string true "Admin token"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /services/{id} [put]
+func (h *Handler) UpdateService(c *gin.Context) {
+	var svc models.Service
+	if err := c.ShouldBindJSON(&svc); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidInput, "Invalid input")
+		return
+	}
+	if fields := validation.Struct(svc); fields != nil {
+		respondValidation(c, fields)
+		return
+	}
+	svc.ID = c.Param("id")
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	updated, err := h.Repo.UpdateService(ctx, svc)
+	if err != nil {
+		handleError(ctx, c, err, "Could not update service")
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// @Summary Delete a catalog service
+// @Description Deletes the catalog service with the specified ID. Linked subscriptions, deleted ones included, keep their service name but lose their service_id. Admin only.
+// @Tags services
+// @Produce json
+// @Param id path string true "Service ID"
+// @Param X-Admin-Token header string true "Admin token"
+// @Success 204 "No Content"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /services/{id} [delete]
+func (h *Handler) DeleteService(c *gin.Context) {
+	ctx, cancel := h.requestContext(c)
+	defer cancel()
+
+	if err := h.Repo.DeleteService(ctx, c.Param("id")); err != nil {
+		handleError(ctx, c, err, "Could not delete service")
+		return
+	}
+	c.Status(http.StatusNoContent)
+	c.Writer.WriteHeaderNow()
+}
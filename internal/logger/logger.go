@@ -6,7 +6,7 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-var Logger *logrus.Logger
+var Logger = logrus.New()
 
 func Init() {
 	Logger = logrus.New()
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const adminKey = "is_admin"
+
+// AdminAuth marks requests that carry the configured token in the
+// X-Admin-Token header as coming from an administrator. An empty token
+// disables admin access entirely.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader("X-Admin-Token")
+		if token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			c.Set(adminKey, true)
+		}
+		c.Next()
+	}
+}
+
+// IsAdmin reports whether AdminAuth accepted the request's admin token.
+func IsAdmin(c *gin.Context) bool {
+	return c.GetBool(adminKey)
+}
+
+// RequireAdmin rejects requests that AdminAuth did not mark as coming from an
+// administrator.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+				Error: "Admin token required",
+				Code:  models.CodeForbidden,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -19,10 +19,11 @@ func GinLogger() gin.HandlerFunc {
 		status := c.Writer.Status()
 
 		logger.LogInfo("HTTP Request", map[string]interface{}{
-			"method":   method,
-			"path":     path,
-			"status":   status,
-			"duration": duration.String(),
+			"method":     method,
+			"path":       path,
+			"status":     status,
+			"duration":   duration.String(),
+			"request_id": RequestIDOf(c),
 		})
 	}
 }
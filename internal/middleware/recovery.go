@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/MosinFAM/subs-app/internal/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery responds with 500 to requests whose handler panicked, like gin's
+// own recovery, but lets http.ErrAbortHandler through to net/http, which
+// then aborts a response that has already started instead of finishing it.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+			logger.LogError("Panic recovered", fmt.Errorf("%v", rec), map[string]interface{}{
+				"method":     c.Request.Method,
+				"path":       c.Request.URL.Path,
+				"request_id": RequestIDOf(c),
+				"stack":      string(debug.Stack()),
+			})
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
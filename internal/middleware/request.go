@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDKey    = "request_id"
+	requestIDHeader = "X-Request-ID"
+)
+
+// RequestID tags every request with the ID from the X-Request-ID header, or
+// a new one when the client sent none, and echoes it in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// RequestIDOf returns the ID RequestID assigned to the request, or an empty
+// string without the middleware.
+func RequestIDOf(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// Actor names who is making the request for the audit log: "admin" for
+// requests AdminAuth accepted, otherwise the X-User-ID header or
+// "anonymous".
+func Actor(c *gin.Context) string {
+	if IsAdmin(c) {
+		return "admin"
+	}
+	if user := c.GetHeader("X-User-ID"); user != "" && len(user) <= 128 {
+		return "user:" + user
+	}
+	return "anonymous"
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit actions, one per kind of subscription mutation.
+const (
+	AuditCreate      = "create"
+	AuditUpdate      = "update"
+	AuditDelete      = "delete"
+	AuditPriceChange = "price_change"
+	AuditPause       = "pause"
+	AuditResume      = "resume"
+	AuditRestore     = "restore"
+	AuditPurge       = "purge"
+)
+
+// AuditEntry records one mutation of a subscription. Entries are only ever
+// appended and outlive the subscription they describe.
+type AuditEntry struct {
+	ID             int64  `json:"id" example:"42"`
+	SubscriptionID string `json:"subscription_id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	// create, update, delete, price_change, pause, resume, restore или purge
+	Action    string    `json:"action" example:"update"`
+	Actor     string    `json:"actor" example:"admin"`
+	RequestID string    `json:"request_id,omitempty" example:"7d0e1f2a-3b4c-4d5e-8f90-a1b2c3d4e5f6"`
+	At        time.Time `json:"at" example:"2024-06-01T12:00:00Z"`
+	// Изменённые поля подписки: значения до и после
+	Changes map[string]FieldChange `json:"changes"`
+}
+
+// FieldChange holds the JSON values of a field before and after a mutation.
+// A value is absent when the field was not set.
+type FieldChange struct {
+	Before json.RawMessage `json:"before,omitempty" swaggertype:"object"`
+	After  json.RawMessage `json:"after,omitempty" swaggertype:"object"`
+}
+
+type AuditListRequest struct {
+	SubscriptionID *string `form:"subscription_id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Actor          *string `form:"actor" example:"admin"`
+	Action         *string `form:"action" example:"update"`
+	RequestID      *string `form:"request_id" example:"7d0e1f2a-3b4c-4d5e-8f90-a1b2c3d4e5f6"`
+	From           *string `form:"from" example:"2024-06-01"` // YYYY-MM-DD или MM-YYYY, включительно
+	To             *string `form:"to" example:"2024-06-30"`   // YYYY-MM-DD или MM-YYYY, включительно
+	Cursor         string  `form:"cursor"`
+	Limit          int     `form:"limit" example:"20"`
+}
+
+// AuditPage is a page of audit entries, newest first.
+type AuditPage struct {
+	Items []AuditEntry `json:"items"`
+	// Курсор следующей страницы, отсутствует на последней странице
+	NextCursor *string `json:"next_cursor,omitempty" example:"41"`
+	Limit      int     `json:"limit" example:"20"`
+	HasMore    bool    `json:"has_more" example:"true"`
+}
@@ -0,0 +1,51 @@
+package models
+
+// Batch modes.
+const (
+	BatchAllOrNothing = "all_or_nothing"
+	BatchBestEffort   = "best_effort"
+)
+
+// Batch operations.
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// MaxBatchOperations bounds the operations of a single batch.
+const MaxBatchOperations = 100
+
+type BatchRequest struct {
+	// all_or_nothing (по умолчанию) — все операции в одной транзакции, при первой ошибке ни одна не применяется;
+	// best_effort — каждая операция выполняется отдельно
+	Mode       string           `json:"mode" example:"best_effort" validate:"omitempty,oneof=all_or_nothing best_effort"`
+	Operations []BatchOperation `json:"operations" validate:"required,min=1,max=100"`
+}
+
+// BatchOperation is one create, update or delete of a batch, with the same
+// meaning as the corresponding single request.
+type BatchOperation struct {
+	// create, update или delete
+	Op string `json:"op" example:"update" validate:"required,oneof=create update delete"`
+	// Подписка для update и delete
+	ID string `json:"id,omitempty" example:"123e4567-e89b-12d3-a456-426614174000" validate:"omitempty,uuid"`
+	// Данные подписки для create и update
+	Subscription *Subscription `json:"subscription,omitempty"`
+	// ETag подписки для update и delete, как в заголовке If-Match; при REQUIRE_IF_MATCH без него операция завершается с 428
+	IfMatch string `json:"if_match,omitempty" example:"\"3\""`
+}
+
+// BatchResult is the outcome of one operation, in the order of the request.
+type BatchResult struct {
+	// HTTP-статус, с которым завершился бы отдельный запрос
+	Status       int            `json:"status" example:"200"`
+	Subscription *Subscription  `json:"subscription,omitempty"` // после create и update
+	Error        *ErrorResponse `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results   []BatchResult `json:"results"`
+	Succeeded int           `json:"succeeded" example:"2"`
+	Failed    int           `json:"failed" example:"1"`
+}
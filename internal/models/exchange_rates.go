@@ -0,0 +1,12 @@
+package models
+
+// BaseCurrency is the currency all exchange rates are quoted against.
+const BaseCurrency = "USD"
+
+// ExchangeRate is the price of one BaseCurrency unit in Currency, effective
+// from Month until the next rate for the same currency.
+type ExchangeRate struct {
+	Currency string  `json:"currency" example:"EUR" validate:"required,iso4217"`
+	Month    string  `json:"month" example:"01-2024" validate:"required,month_year"` // формат: MM-YYYY
+	Rate     float64 `json:"rate" example:"0.92" validate:"gt=0"`
+}
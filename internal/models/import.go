@@ -0,0 +1,28 @@
+package models
+
+// Statuses of imported rows.
+const (
+	ImportCreated     = "created"
+	ImportWouldCreate = "would_create"
+	ImportInvalid     = "invalid"
+)
+
+// MaxImportRows bounds the data rows of a single import.
+const MaxImportRows = 1000
+
+// ImportRow reports what became of one data row of an imported file.
+type ImportRow struct {
+	Line int `json:"line" example:"2"` // номер строки в файле; строка заголовка — 1
+	// created, would_create (при dry_run) или invalid
+	Status       string        `json:"status" example:"created"`
+	Subscription *Subscription `json:"subscription,omitempty"` // созданная подписка или, при dry_run, подписка без id, какой она была бы создана
+	Errors       []FieldError  `json:"errors,omitempty"`
+}
+
+type ImportResponse struct {
+	DryRun  bool        `json:"dry_run" example:"false"`
+	Created int         `json:"created" example:"11"` // при dry_run всегда 0
+	Valid   int         `json:"valid" example:"11"`
+	Invalid int         `json:"invalid" example:"1"`
+	Rows    []ImportRow `json:"rows"`
+}
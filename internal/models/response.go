@@ -1,5 +1,33 @@
 package models
 
+// Machine-readable error codes returned in ErrorResponse.Code.
+const (
+	CodeInvalidInput         = "invalid_input"
+	CodeValidation           = "validation_failed"
+	CodeInvalidQuery         = "invalid_query"
+	CodeInvalidDate          = "invalid_date"
+	CodeInvalidSort          = "invalid_sort"
+	CodeInvalidCursor        = "invalid_cursor"
+	CodeConstraint           = "constraint_violation"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeForbidden            = "forbidden"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeNoRate               = "no_exchange_rate"
+	CodeTimeout              = "timeout"
+	CodeInternal             = "internal"
+)
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field" example:"start_date"`
+	Code    string `json:"code" example:"date"`
+	Message string `json:"message" example:"must be a date in YYYY-MM-DD or MM-YYYY format"`
+}
+
 type ErrorResponse struct {
-	Error string `json:"error" example:"Invalid input"`
+	Error  string       `json:"error" example:"Invalid input"`
+	Code   string       `json:"code" example:"invalid_input"`
+	Fields []FieldError `json:"fields,omitempty"`
 }
@@ -0,0 +1,15 @@
+package models
+
+// Service is a catalog entry subscriptions can refer to. Service names of
+// incoming subscriptions that match its name or one of its aliases, ignoring
+// case and extra spaces, are replaced with the canonical name.
+type Service struct {
+	ID       string   `json:"id" example:"5b2c6a0e-8f0a-4c57-9a4e-1d2f3b4c5d6e"`
+	Name     string   `json:"name" example:"Netflix" validate:"notblank,max=255"`
+	Aliases  []string `json:"aliases" example:"Netflix Premium,NFLX" validate:"max=50,dive,notblank,max=255"`
+	Category string   `json:"category,omitempty" example:"video" validate:"max=100"`
+	// Цена и валюта по умолчанию для связанных подписок; цену можно опустить только при service_id
+	DefaultPrice    *int   `json:"default_price,omitempty" example:"1299" validate:"omitempty,gt=0"`
+	DefaultCurrency string `json:"default_currency,omitempty" example:"USD" validate:"omitempty,iso4217"`
+	Homepage        string `json:"homepage,omitempty" example:"https://www.netflix.com" validate:"omitempty,url,max=2048"`
+}
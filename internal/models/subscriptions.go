@@ -1,17 +1,141 @@
 package models
 
+import "time"
+
 type Subscription struct {
 	ID          string  `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
-	ServiceName string  `json:"service_name" example:"Netflix"`
-	Price       int     `json:"price" example:"1299"` // Цена в центах
-	UserID      string  `json:"user_id" example:"987e6543-e21b-12d3-a456-426614174999"`
-	StartDate   string  `json:"start_date" example:"01-2024"`         // формат: MM-YYYY
-	EndDate     *string `json:"end_date,omitempty" example:"12-2024"` // формат: MM-YYYY
+	ServiceID   *string `json:"service_id,omitempty" example:"5b2c6a0e-8f0a-4c57-9a4e-1d2f3b4c5d6e" validate:"omitempty,uuid"` // сервис из каталога
+	ServiceName string  `json:"service_name" example:"Netflix" validate:"omitempty,notblank,max=255"`                          // при service_id берётся из каталога
+	Price       int     `json:"price" example:"1299" validate:"omitempty,gt=0"`                                                // Цена в сотых долях валюты за один период оплаты
+	Currency    string  `json:"currency" example:"EUR" validate:"omitempty,iso4217"`                                           // ISO 4217, по умолчанию USD
+	UserID      string  `json:"user_id" example:"987e6543-e21b-12d3-a456-426614174999" validate:"required,uuid"`
+	StartDate   string  `json:"start_date" example:"2024-01-20" validate:"required,date"`          // формат: YYYY-MM-DD или MM-YYYY
+	EndDate     *string `json:"end_date,omitempty" example:"2024-12-31" validate:"omitempty,date"` // включительно; месяц MM-YYYY — до его конца
+	// Период оплаты: weekly, monthly (по умолчанию), quarterly, yearly или custom
+	BillingPeriod string `json:"billing_period" example:"yearly" validate:"omitempty,oneof=weekly monthly quarterly yearly custom"`
+	// Длина периода в месяцах, задаётся только для custom
+	BillingMonths *int `json:"billing_months,omitempty" example:"6" validate:"omitempty,gt=0,lte=120"`
+	// Последний день бесплатного пробного периода, включительно; месяц MM-YYYY — до его конца
+	TrialEndDate *string `json:"trial_end_date,omitempty" example:"2024-02-19" validate:"omitempty,date"`
+	// Вводная цена за период оплаты, действует intro_months месяцев после пробного периода
+	IntroPrice  *int `json:"intro_price,omitempty" example:"499" validate:"omitempty,gte=0"`
+	IntroMonths *int `json:"intro_months,omitempty" example:"3" validate:"omitempty,gt=0,lte=120"`
+	// Категория; если не задана, берётся из каталога или из списка известных сервисов
+	Category string `json:"category" example:"streaming" validate:"max=100"`
+	// Произвольные метки без запятых; хранятся в нижнем регистре без повторов
+	Tags []string `json:"tags,omitempty" example:"family,work" validate:"max=20,dive,notblank,max=50,excludesall=0x2C"`
+	// Паузы по порядку дат; задаются через /pause и /resume и в теле запроса игнорируются
+	Pauses []Pause `json:"pauses,omitempty"`
+	// Время удаления; есть только у удалённых подписок, видимых с include_deleted, и в теле запроса игнорируется
+	DeletedAt *time.Time `json:"deleted_at,omitempty" example:"2024-06-01T12:00:00Z"`
+	// Версия; растёт с каждым изменением подписки и передаётся в ETag, а не в теле
+	Version int `json:"-"`
 }
 
-type SubscriptionSumRequest struct {
+const (
+	BillingWeekly    = "weekly"
+	BillingMonthly   = "monthly"
+	BillingQuarterly = "quarterly"
+	BillingYearly    = "yearly"
+	BillingCustom    = "custom"
+)
+
+type SubscriptionListRequest struct {
+	// Без user_id список по всем пользователям доступен только администратору
 	UserID      *string `form:"user_id" example:"987e6543-e21b-12d3-a456-426614174999"`
-	ServiceName *string `form:"service_name" example:"Netflix"`
-	From        string  `form:"from" example:"01-2024"` // формат: MM-YYYY
-	To          string  `form:"to" example:"12-2024"`   // формат: MM-YYYY
+	ServiceID   *string `form:"service_id" example:"5b2c6a0e-8f0a-4c57-9a4e-1d2f3b4c5d6e"`
+	ServiceName *string `form:"service_name" example:"Netflix"` // поиск по подстроке
+	MinPrice    *int    `form:"min_price" example:"500"`
+	MaxPrice    *int    `form:"max_price" example:"2000"`
+	ActiveOn    *string `form:"active_on" example:"2024-06-15"` // день YYYY-MM-DD или весь месяц MM-YYYY
+	HasEndDate  *bool   `form:"has_end_date" example:"false"`
+	Category    *string `form:"category" example:"streaming"`
+	// Только подписки, пробный период которых заканчивается в ближайшие N дней (считая сегодня)
+	TrialEndsWithin *int `form:"trial_ends_within" example:"7"`
+	// Только подписки со всеми указанными метками
+	Tags []string `form:"tag" example:"family"`
+	// Поле сортировки: price, start_date, service_name; префикс "-" — по убыванию
+	Sort   string `form:"sort" example:"-price"`
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" example:"20"`
+}
+
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+type SubscriptionPage struct {
+	Items []Subscription `json:"items"`
+	// Курсор следующей страницы, отсутствует на последней странице
+	NextCursor *string `json:"next_cursor,omitempty" example:"eyJzIjoicHJpY2UiLCJ2IjoiMTI5OSIsImlkIjoiMTIzIn0"`
+	Limit      int     `json:"limit" example:"20"`
+	HasMore    bool    `json:"has_more" example:"true"`
+}
+
+type SubscriptionSumRequest struct {
+	UserID      *string  `form:"user_id" example:"987e6543-e21b-12d3-a456-426614174999"`
+	ServiceID   *string  `form:"service_id" example:"5b2c6a0e-8f0a-4c57-9a4e-1d2f3b4c5d6e"`
+	ServiceName *string  `form:"service_name" example:"Netflix"`
+	Category    *string  `form:"category" example:"streaming"`
+	Tags        []string `form:"tag" example:"family"`   // только подписки со всеми указанными метками
+	From        string   `form:"from" example:"01-2024"` // YYYY-MM-DD или MM-YYYY (с первого дня месяца)
+	To          string   `form:"to" example:"12-2024"`   // YYYY-MM-DD или MM-YYYY (по последний день месяца)
+	// Поля группировки: service_name, user_id, currency, month, category, tag (можно комбинировать)
+	GroupBy []string `form:"group_by" example:"service_name,month"`
+	// Валюта итогов, ISO 4217; без неё суммы складываются без пересчёта
+	Currency *string `form:"currency" example:"EUR"`
+}
+
+const (
+	GroupByServiceName = "service_name"
+	GroupByUserID      = "user_id"
+	GroupByCurrency    = "currency"
+	GroupByMonth       = "month"
+	GroupByCategory    = "category"
+	GroupByTag         = "tag"
+)
+
+type MonthlyCost struct {
+	Month string `json:"month" example:"01-2024"` // формат: MM-YYYY
+	Total int    `json:"total" example:"1299"`
+}
+
+// SummaryGroup holds the subtotal for one combination of group_by values.
+// Only the fields that were grouped by are set. A subscription with several
+// tags counts towards the group of each of them.
+type SummaryGroup struct {
+	ServiceName *string `json:"service_name,omitempty" example:"Netflix"`
+	UserID      *string `json:"user_id,omitempty" example:"987e6543-e21b-12d3-a456-426614174999"`
+	Currency    *string `json:"currency,omitempty" example:"EUR"`       // исходная валюта подписок
+	Month       *string `json:"month,omitempty" example:"01-2024"`      // формат: MM-YYYY
+	Category    *string `json:"category,omitempty" example:"streaming"` // пустая у подписок без категории
+	Tag         *string `json:"tag,omitempty" example:"family"`         // пустая у подписок без меток
+	Total       int     `json:"total" example:"1299"`
+}
+
+type SubscriptionSummary struct {
+	Total  int            `json:"total" example:"15588"`
+	Months []MonthlyCost  `json:"months"`
+	Groups []SummaryGroup `json:"groups,omitempty"`
+	// Валюта, в которую пересчитаны суммы, если она была запрошена
+	Currency *string `json:"currency,omitempty" example:"EUR"`
+}
+
+// PriceChange sets a new price of a subscription from EffectiveFrom on.
+// Until the first change the subscription's own price applies.
+type PriceChange struct {
+	EffectiveFrom string `json:"effective_from" example:"2024-06-01" validate:"required,date"` // формат: YYYY-MM-DD или MM-YYYY
+	Price         int    `json:"price" example:"1499" validate:"gt=0"`
+}
+
+// Pause is a span of days the subscription is not billed for. A pause
+// without To lasts until the subscription is resumed.
+type Pause struct {
+	From string  `json:"from" example:"2024-06-01" validate:"required,date"`          // формат: YYYY-MM-DD или MM-YYYY
+	To   *string `json:"to,omitempty" example:"2024-08-31" validate:"omitempty,date"` // включительно; месяц MM-YYYY — до его конца
+}
+
+type ResumeRequest struct {
+	On string `json:"on" example:"2024-09-01" validate:"required,date"` // первый оплачиваемый день после паузы
 }
@@ -0,0 +1,102 @@
+// Package rates reads exchange-rate tables from CSV and JSON files.
+package rates
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// Supported file formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// csvColumns are the header names a CSV table must have, in any order.
+var csvColumns = []string{"currency", "month", "rate"}
+
+// Parse reads rates in the given format. CSV input starts with a header row
+// naming the currency, month and rate columns; JSON input is an array of
+// models.ExchangeRate.
+func Parse(r io.Reader, format string) ([]models.ExchangeRate, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatJSON:
+		var rates []models.ExchangeRate
+		if err := json.NewDecoder(r).Decode(&rates); err != nil {
+			return nil, fmt.Errorf("decode json: %w", err)
+		}
+		return rates, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// LoadFile reads the rates stored at path, choosing the format by the file
+// extension.
+func LoadFile(path string) ([]models.ExchangeRate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	rates, err := Parse(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rates, nil
+}
+
+func parseCSV(r io.Reader) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv: missing header")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("csv: missing column %q", name)
+		}
+	}
+
+	var rates []models.ExchangeRate
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rates, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[index["rate"]]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("csv: line %d: invalid rate %q", line, record[index["rate"]])
+		}
+		rates = append(rates, models.ExchangeRate{
+			Currency: strings.TrimSpace(record[index["currency"]]),
+			Month:    strings.TrimSpace(record[index["month"]]),
+			Rate:     value,
+		})
+	}
+}
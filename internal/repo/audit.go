@@ -0,0 +1,174 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// SystemActor is the actor recorded for changes made without AuditInfo,
+// such as those of background jobs.
+const SystemActor = "system"
+
+// AuditInfo identifies who makes the changes recorded in the audit log.
+type AuditInfo struct {
+	Actor     string
+	RequestID string
+}
+
+type auditInfoKey struct{}
+
+// WithAuditInfo returns a context under which mutations are recorded in the
+// audit log as made by info.
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+func auditInfo(ctx context.Context) AuditInfo {
+	info, _ := ctx.Value(auditInfoKey{}).(AuditInfo)
+	if info.Actor == "" {
+		info.Actor = SystemActor
+	}
+	return info
+}
+
+// newAuditEntry describes action on subscription id by the actor of ctx. Its
+// changes are the top-level JSON fields that differ between before and
+// after, either of which may be nil.
+func newAuditEntry(ctx context.Context, id, action string, before, after interface{}) (models.AuditEntry, error) {
+	changes, err := diffFields(before, after)
+	if err != nil {
+		return models.AuditEntry{}, err
+	}
+	info := auditInfo(ctx)
+	return models.AuditEntry{
+		SubscriptionID: id,
+		Action:         action,
+		Actor:          info.Actor,
+		RequestID:      info.RequestID,
+		// PostgreSQL keeps microseconds.
+		At:      time.Now().UTC().Truncate(time.Microsecond),
+		Changes: changes,
+	}, nil
+}
+
+func diffFields(before, after interface{}) (map[string]models.FieldChange, error) {
+	old, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]models.FieldChange)
+	for name, value := range old {
+		if !bytes.Equal(value, updated[name]) {
+			changes[name] = models.FieldChange{Before: value, After: updated[name]}
+		}
+	}
+	for name, value := range updated {
+		if _, ok := old[name]; !ok {
+			changes[name] = models.FieldChange{After: value}
+		}
+	}
+	return changes, nil
+}
+
+// jsonFields splits the JSON encoding of the object v into its fields.
+func jsonFields(v interface{}) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// auditFilter is the parsed form of an AuditListRequest.
+type auditFilter struct {
+	models.AuditListRequest
+	// from and to bound the entry times, to excluded.
+	from, to *time.Time
+	// after is the ID of the last entry of the previous page, or zero.
+	after int64
+	limit int
+}
+
+func parseAuditFilter(req models.AuditListRequest) (auditFilter, error) {
+	f := auditFilter{AuditListRequest: req, limit: req.Limit}
+	if f.limit <= 0 || f.limit > models.MaxListLimit {
+		f.limit = models.DefaultListLimit
+	}
+	if req.SubscriptionID != nil {
+		if err := checkID(*req.SubscriptionID); err != nil {
+			return f, err
+		}
+	}
+	if req.From != nil {
+		r, err := parseRange(*req.From)
+		if err != nil {
+			return f, err
+		}
+		f.from = &r.from
+	}
+	if req.To != nil {
+		r, err := parseRange(*req.To)
+		if err != nil {
+			return f, err
+		}
+		to := r.to.AddDate(0, 0, 1)
+		f.to = &to
+	}
+	if req.Cursor != "" {
+		after, err := strconv.ParseInt(req.Cursor, 10, 64)
+		if err != nil || after <= 0 {
+			return f, ErrInvalidCursor
+		}
+		f.after = after
+	}
+	return f, nil
+}
+
+// matches reports whether e passes the filter, ignoring the cursor.
+func (f auditFilter) matches(e models.AuditEntry) bool {
+	switch {
+	case f.SubscriptionID != nil && e.SubscriptionID != *f.SubscriptionID:
+		return false
+	case f.Actor != nil && e.Actor != *f.Actor:
+		return false
+	case f.Action != nil && e.Action != *f.Action:
+		return false
+	case f.RequestID != nil && e.RequestID != *f.RequestID:
+		return false
+	case f.from != nil && e.At.Before(*f.from):
+		return false
+	case f.to != nil && !e.At.Before(*f.to):
+		return false
+	}
+	return true
+}
+
+// auditPage builds a page from up to limit+1 entries, newest first.
+func auditPage(entries []models.AuditEntry, limit int) models.AuditPage {
+	page := models.AuditPage{Items: entries, Limit: limit}
+	if len(entries) > limit {
+		page.Items = entries[:limit]
+		page.HasMore = true
+		next := strconv.FormatInt(entries[limit-1].ID, 10)
+		page.NextCursor = &next
+	}
+	if page.Items == nil {
+		page.Items = []models.AuditEntry{}
+	}
+	return page
+}
@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"fmt"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// monthlyRate is the share of one price that falls on a single month,
+// expressed as the fraction num/den.
+type monthlyRate struct {
+	num, den int
+}
+
+// billingRates holds the monthly share of the fixed billing periods. A week
+// is counted as 1/52 of a year.
+var billingRates = map[string]monthlyRate{
+	models.BillingWeekly:    {52, 12},
+	models.BillingMonthly:   {1, 1},
+	models.BillingQuarterly: {1, 3},
+	models.BillingYearly:    {1, 12},
+}
+
+// normalizeBilling defaults the billing period to monthly and checks that
+// billing_months is given exactly for custom periods.
+func normalizeBilling(s *models.Subscription) error {
+	if s.BillingPeriod == "" {
+		s.BillingPeriod = models.BillingMonthly
+	}
+	if s.BillingPeriod == models.BillingCustom {
+		if s.BillingMonths == nil || *s.BillingMonths <= 0 {
+			return fmt.Errorf("%w: custom billing period needs positive billing_months", ErrInvalidInput)
+		}
+		return nil
+	}
+	if _, ok := billingRates[s.BillingPeriod]; !ok {
+		return fmt.Errorf("%w: unknown billing_period %q", ErrInvalidInput, s.BillingPeriod)
+	}
+	if s.BillingMonths != nil {
+		return fmt.Errorf("%w: billing_months is only allowed for custom billing periods", ErrInvalidInput)
+	}
+	return nil
+}
+
+// billingRate returns the monthly rate of a normalized billing period.
+func billingRate(period string, months *int) monthlyRate {
+	if period == models.BillingCustom && months != nil {
+		return monthlyRate{1, *months}
+	}
+	if rate, ok := billingRates[period]; ok {
+		return rate
+	}
+	return billingRates[models.BillingMonthly]
+}
+
+// charge returns the cost of the n-th month (counting from 0) of a
+// subscription. Rounding is spread over the months so that every whole
+// billing period adds up to exactly its price.
+func (r monthlyRate) charge(price, n int) int {
+	return price*r.num*(n+1)/r.den - price*r.num*n/r.den
+}
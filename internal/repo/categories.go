@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"sort"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// defaultCategories maps well-known services, by alias key, to the category
+// their subscriptions get unless the subscription or its catalog entry names
+// one.
+var defaultCategories = map[string]string{
+	"netflix":                "streaming",
+	"disney+":                "streaming",
+	"hbo max":                "streaming",
+	"hulu":                   "streaming",
+	"amazon prime video":     "streaming",
+	"apple tv+":              "streaming",
+	"youtube premium":        "streaming",
+	"twitch":                 "streaming",
+	"kinopoisk":              "streaming",
+	"ivi":                    "streaming",
+	"okko":                   "streaming",
+	"spotify":                "music",
+	"apple music":            "music",
+	"yandex music":           "music",
+	"deezer":                 "music",
+	"tidal":                  "music",
+	"microsoft 365":          "productivity",
+	"google workspace":       "productivity",
+	"notion":                 "productivity",
+	"slack":                  "productivity",
+	"zoom":                   "productivity",
+	"todoist":                "productivity",
+	"evernote":               "productivity",
+	"1password":              "productivity",
+	"adobe creative cloud":   "productivity",
+	"figma":                  "productivity",
+	"github":                 "development",
+	"jetbrains":              "development",
+	"dropbox":                "cloud storage",
+	"google one":             "cloud storage",
+	"icloud+":                "cloud storage",
+	"yandex disk":            "cloud storage",
+	"xbox game pass":         "gaming",
+	"playstation plus":       "gaming",
+	"nintendo switch online": "gaming",
+}
+
+// foldLabel normalizes a category or tag the way service names are folded
+// for catalog matching.
+func foldLabel(label string) string {
+	return aliasKey(label)
+}
+
+// categorize folds the category of s or, when it has none, fills in the one
+// of its catalog entry svc or the default for a well-known service.
+func categorize(s *models.Subscription, svc *models.Service) {
+	s.Category = foldLabel(s.Category)
+	if s.Category == "" && svc != nil {
+		s.Category = foldLabel(svc.Category)
+	}
+	if s.Category == "" {
+		s.Category = defaultCategories[aliasKey(s.ServiceName)]
+	}
+}
+
+// normalizeTags folds tags and sorts them, dropping empty ones and
+// duplicates. It returns nil when no tag is left.
+func normalizeTags(tags []string) []string {
+	var folded []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = foldLabel(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		folded = append(folded, tag)
+	}
+	sort.Strings(folded)
+	return folded
+}
+
+// hasTags reports whether the sorted tags include every tag of want.
+func hasTags(tags, want []string) bool {
+	for _, w := range want {
+		i := sort.SearchStrings(tags, w)
+		if i == len(tags) || tags[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// foldLabelFilter folds the category and tags a list or summary is filtered
+// by.
+func foldLabelFilter(category *string, tags []string) (*string, []string) {
+	if category != nil {
+		folded := foldLabel(*category)
+		category = &folded
+	}
+	return category, normalizeTags(tags)
+}
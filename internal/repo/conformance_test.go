@@ -0,0 +1,1579 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/dates"
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// repoFactory returns an empty repository for a single test.
+type repoFactory func(t *testing.T) Repository
+
+// runConformance checks that a Repository implementation behaves like the
+// Postgres one. Every backend should run it from its own test.
+func runConformance(t *testing.T, newRepo repoFactory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, r Repository)
+	}{
+		{"CRUD", testCRUD},
+		{"NotFound", testNotFound},
+		{"InvalidInput", testInvalidInput},
+		{"ListFilters", testListFilters},
+		{"ListUnicode", testListUnicode},
+		{"ListPagination", testListPagination},
+		{"ListInvalidParams", testListInvalidParams},
+		{"EachSubscription", testEachSubscription},
+		{"SummaryOverlap", testSummaryOverlap},
+		{"SummaryGroups", testSummaryGroups},
+		{"SummaryBillingPeriods", testSummaryBillingPeriods},
+		{"DayPrecision", testDayPrecision},
+		{"PriceHistory", testPriceHistory},
+		{"Pauses", testPauses},
+		{"Trials", testTrials},
+		{"Services", testServices},
+		{"ServiceAudit", testServiceAudit},
+		{"CategoriesAndTags", testCategoriesAndTags},
+		{"AuditLog", testAuditLog},
+		{"SoftDelete", testSoftDelete},
+		{"Versions", testVersions},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"Transactions", testTransactions},
+		{"ExchangeRates", testExchangeRates},
+		{"SummaryCurrency", testSummaryCurrency},
+		{"Concurrency", testConcurrency},
+		{"CanceledContext", testCanceledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t))
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func newSub(userID, service string, price int, start string, end *string) models.Subscription {
+	return models.Subscription{
+		ServiceName: service,
+		Price:       price,
+		UserID:      userID,
+		StartDate:   start,
+		EndDate:     end,
+	}
+}
+
+func mustCreate(t *testing.T, r Repository, s models.Subscription) models.Subscription {
+	t.Helper()
+	created, err := r.CreateSubscription(context.Background(), s)
+	require.NoError(t, err)
+	return created
+}
+
+func testCRUD(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	created := mustCreate(t, r, newSub(userID, "netflix", 1299, "01-2024", ptr("12-2024")))
+	require.NotEmpty(t, created.ID)
+	_, err := uuid.Parse(created.ID)
+	require.NoError(t, err)
+
+	got, err := r.GetSubscriptionByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created, got)
+	assert.Equal(t, models.BillingMonthly, got.BillingPeriod)
+	assert.Equal(t, models.BaseCurrency, got.Currency)
+
+	created.Price = 1499
+	created.EndDate = nil
+	updated, err := r.UpdateSubscription(ctx, created)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	created.Version = updated.Version
+	assert.Equal(t, created, updated)
+
+	got, err = r.GetSubscriptionByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1499, got.Price)
+	assert.Nil(t, got.EndDate)
+
+	require.NoError(t, r.DeleteSubscription(ctx, created.ID))
+	_, err = r.GetSubscriptionByID(ctx, created.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func testNotFound(t *testing.T, r Repository) {
+	ctx := context.Background()
+	missing := uuid.NewString()
+
+	_, err := r.GetSubscriptionByID(ctx, missing)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	s := newSub(uuid.NewString(), "netflix", 100, "01-2024", nil)
+	s.ID = missing
+	_, err = r.UpdateSubscription(ctx, s)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.ErrorIs(t, r.DeleteSubscription(ctx, missing), ErrNotFound)
+
+	_, err = r.GetSubscriptionByID(ctx, "not-a-uuid")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.ErrorIs(t, r.DeleteSubscription(ctx, "not-a-uuid"), ErrInvalidInput)
+}
+
+func testInvalidInput(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	_, err := r.CreateSubscription(ctx, newSub(userID, "netflix", 100, "13-2024", nil))
+	assert.ErrorIs(t, err, ErrInvalidDate)
+
+	_, err = r.CreateSubscription(ctx, newSub(userID, "netflix", 100, "01-2024", ptr("2024-12")))
+	assert.ErrorIs(t, err, ErrInvalidDate)
+
+	_, err = r.CreateSubscription(ctx, newSub(userID, "netflix", 0, "01-2024", nil))
+	assert.ErrorIs(t, err, ErrConstraint)
+
+	_, err = r.CreateSubscription(ctx, newSub("user-123", "netflix", 100, "01-2024", nil))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	s := newSub(userID, "netflix", 100, "01-2024", nil)
+	s.BillingPeriod = "daily"
+	_, err = r.CreateSubscription(ctx, s)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	s.BillingPeriod = models.BillingCustom
+	_, err = r.CreateSubscription(ctx, s)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	s.BillingPeriod, s.BillingMonths = models.BillingYearly, ptr(12)
+	_, err = r.CreateSubscription(ctx, s)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	s = newSub(userID, "netflix", 100, "01-2024", nil)
+	s.Currency = "eur"
+	_, err = r.CreateSubscription(ctx, s)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	created := mustCreate(t, r, newSub(userID, "netflix", 100, "01-2024", nil))
+	created.Price = -1
+	_, err = r.UpdateSubscription(ctx, created)
+	assert.ErrorIs(t, err, ErrConstraint)
+
+	got, err := r.GetSubscriptionByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 100, got.Price)
+}
+
+func listIDs(page models.SubscriptionPage) []string {
+	ids := make([]string, 0, len(page.Items))
+	for _, s := range page.Items {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func testListFilters(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	netflix := mustCreate(t, r, newSub(userID, "Netflix Premium", 1500, "01-2024", ptr("06-2024")))
+	spotify := mustCreate(t, r, newSub(userID, "spotify", 500, "03-2024", nil))
+	youtube := mustCreate(t, r, newSub(userID, "youtube", 900, "07-2024", nil))
+	other := mustCreate(t, r, newSub(uuid.NewString(), "netflix", 1000, "01-2024", nil))
+
+	tests := []struct {
+		name   string
+		filter models.SubscriptionListRequest
+		want   []string
+	}{
+		{"by user", models.SubscriptionListRequest{UserID: &userID}, []string{netflix.ID, spotify.ID, youtube.ID}},
+		{"service substring ignores case", models.SubscriptionListRequest{UserID: &userID, ServiceName: ptr("NETFLIX")}, []string{netflix.ID}},
+		{"min price", models.SubscriptionListRequest{UserID: &userID, MinPrice: ptr(900)}, []string{netflix.ID, youtube.ID}},
+		{"max price", models.SubscriptionListRequest{UserID: &userID, MaxPrice: ptr(900)}, []string{spotify.ID, youtube.ID}},
+		{"active on", models.SubscriptionListRequest{UserID: &userID, ActiveOn: ptr("06-2024")}, []string{netflix.ID, spotify.ID}},
+		{"has end date", models.SubscriptionListRequest{UserID: &userID, HasEndDate: ptr(true)}, []string{netflix.ID}},
+		{"has no end date", models.SubscriptionListRequest{UserID: &userID, HasEndDate: ptr(false)}, []string{spotify.ID, youtube.ID}},
+		{"sort by price desc", models.SubscriptionListRequest{UserID: &userID, Sort: "-price"}, []string{netflix.ID, youtube.ID, spotify.ID}},
+		{"sort by service name", models.SubscriptionListRequest{UserID: &userID, ServiceName: ptr("t"), Sort: "service_name"}, []string{netflix.ID, spotify.ID, youtube.ID}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := r.ListSubscriptions(ctx, tt.filter)
+			require.NoError(t, err)
+			if tt.filter.Sort == "" {
+				assert.ElementsMatch(t, tt.want, listIDs(page))
+			} else {
+				assert.Equal(t, tt.want, listIDs(page))
+			}
+			assert.False(t, page.HasMore)
+			assert.Nil(t, page.NextCursor)
+		})
+	}
+
+	page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{})
+	require.NoError(t, err)
+	assert.Subset(t, listIDs(page), []string{netflix.ID, spotify.ID, youtube.ID, other.ID})
+}
+
+func testListUnicode(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	kinopoisk := mustCreate(t, r, newSub(userID, "Кинопоиск", 300, "01-2024", nil))
+	okko := mustCreate(t, r, newSub(userID, "оККО Кино", 400, "01-2024", nil))
+	apple := mustCreate(t, r, newSub(userID, "apple tv", 500, "01-2024", nil))
+	zoom := mustCreate(t, r, newSub(userID, "Zoom", 600, "01-2024", nil))
+
+	// Case is ignored beyond ASCII.
+	page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, ServiceName: ptr("кИНО")})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{kinopoisk.ID, okko.ID}, listIDs(page))
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, ServiceName: ptr("КИНОПОИСК"), From: "01-2024", To: "01-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, 300, summary.Total)
+
+	// Service names are ordered by their bytes whatever the database
+	// collation, capitals first, and so are the cursors.
+	for sort, want := range map[string][]string{
+		"service_name":  {zoom.ID, apple.ID, kinopoisk.ID, okko.ID},
+		"-service_name": {okko.ID, kinopoisk.ID, apple.ID, zoom.ID},
+	} {
+		t.Run(sort, func(t *testing.T) {
+			var paged []string
+			filter := models.SubscriptionListRequest{UserID: &userID, Sort: sort, Limit: 1}
+			for {
+				page, err := r.ListSubscriptions(ctx, filter)
+				require.NoError(t, err)
+				paged = append(paged, listIDs(page)...)
+				if !page.HasMore {
+					break
+				}
+				filter.Cursor = *page.NextCursor
+			}
+			assert.Equal(t, want, paged)
+		})
+	}
+}
+
+func testListPagination(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	// Equal prices make the id tie-breaker matter.
+	prices := []int{300, 100, 200, 100, 300, 100, 500}
+	for i, price := range prices {
+		mustCreate(t, r, newSub(userID, fmt.Sprintf("service %d", i), price, fmt.Sprintf("%02d-2024", i+1), nil))
+	}
+
+	for _, sort := range []string{"price", "-price", "start_date", "-start_date", "service_name", "-service_name"} {
+		t.Run(sort, func(t *testing.T) {
+			full, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, Sort: sort})
+			require.NoError(t, err)
+			require.Len(t, full.Items, len(prices))
+
+			var paged []string
+			filter := models.SubscriptionListRequest{UserID: &userID, Sort: sort, Limit: 2}
+			for {
+				page, err := r.ListSubscriptions(ctx, filter)
+				require.NoError(t, err)
+				assert.Equal(t, 2, page.Limit)
+				paged = append(paged, listIDs(page)...)
+				if !page.HasMore {
+					assert.Nil(t, page.NextCursor)
+					break
+				}
+				require.NotNil(t, page.NextCursor)
+				require.Len(t, page.Items, 2)
+				filter.Cursor = *page.NextCursor
+			}
+			assert.Equal(t, listIDs(full), paged)
+		})
+	}
+}
+
+func testEachSubscription(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+	mustCreate(t, r, newSub(uuid.NewString(), "other user", 100, "01-2024", nil))
+
+	// More than one batch, so the iteration has to follow the cursor.
+	count := exportBatch + 3
+	for i := 0; i < count; i++ {
+		mustCreate(t, r, newSub(userID, fmt.Sprintf("service %d", i), 100+i%7, "01-2024", nil))
+	}
+	paused := mustCreate(t, r, newSub(userID, "paused", 50, "01-2024", nil))
+	_, err := r.PauseSubscription(ctx, paused.ID, models.Pause{From: "02-2024"})
+	require.NoError(t, err)
+
+	filter := models.SubscriptionListRequest{UserID: &userID, Sort: "-price", Limit: 1, Cursor: "ignored"}
+	var seen []models.Subscription
+	require.NoError(t, r.EachSubscription(ctx, filter, func(s models.Subscription) error {
+		seen = append(seen, s)
+		return nil
+	}))
+	require.Len(t, seen, count+1)
+	ids := make(map[string]bool)
+	for i, s := range seen {
+		assert.Equal(t, userID, s.UserID)
+		ids[s.ID] = true
+		if i > 0 {
+			assert.LessOrEqual(t, s.Price, seen[i-1].Price)
+		}
+	}
+	assert.Len(t, ids, count+1)
+	assert.Equal(t, paused.ID, seen[count].ID)
+	assert.Len(t, seen[count].Pauses, 1)
+
+	stop := errors.New("stop")
+	calls := 0
+	err = r.EachSubscription(ctx, filter, func(models.Subscription) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+
+	err = r.EachSubscription(ctx, models.SubscriptionListRequest{Sort: "user_id"}, func(models.Subscription) error { return nil })
+	assert.ErrorIs(t, err, ErrInvalidSort)
+}
+
+func testListInvalidParams(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+	mustCreate(t, r, newSub(userID, "netflix", 100, "01-2024", nil))
+	mustCreate(t, r, newSub(userID, "spotify", 200, "01-2024", nil))
+
+	_, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, Sort: "user_id"})
+	assert.ErrorIs(t, err, ErrInvalidSort)
+
+	_, err = r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, Cursor: "bogus"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, Sort: "price", Limit: 1})
+	require.NoError(t, err)
+	require.NotNil(t, page.NextCursor)
+	_, err = r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, Sort: "-price", Cursor: *page.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, ActiveOn: ptr("2024")})
+	assert.ErrorIs(t, err, ErrInvalidDate)
+}
+
+func testSummaryOverlap(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	mustCreate(t, r, newSub(userID, "inside", 100, "03-2024", ptr("04-2024")))
+	mustCreate(t, r, newSub(userID, "started before", 10, "06-2023", ptr("02-2024")))
+	mustCreate(t, r, newSub(userID, "open ended", 1000, "05-2024", nil))
+	mustCreate(t, r, newSub(userID, "ended before", 5, "01-2023", ptr("12-2023")))
+	mustCreate(t, r, newSub(userID, "starts after", 7, "07-2024", nil))
+	mustCreate(t, r, newSub(uuid.NewString(), "other user", 3, "01-2024", nil))
+
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2024", To: "06-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.MonthlyCost{
+		{Month: "01-2024", Total: 10},
+		{Month: "02-2024", Total: 10},
+		{Month: "03-2024", Total: 100},
+		{Month: "04-2024", Total: 100},
+		{Month: "05-2024", Total: 1000},
+		{Month: "06-2024", Total: 1000},
+	}, summary.Months)
+	assert.Equal(t, 2*10+2*100+2*1000, summary.Total)
+	assert.Nil(t, summary.Groups)
+
+	summary, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, ServiceName: ptr("OPEN"), From: "05-2024", To: "05-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, 1000, summary.Total)
+
+	summary, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2020", To: "02-2020"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, summary.Total)
+	assert.Len(t, summary.Months, 2)
+
+	_, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{From: "06-2024", To: "01-2024"})
+	assert.ErrorIs(t, err, ErrInvalidDate)
+
+	_, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{From: "2024-01", To: "06-2024"})
+	assert.ErrorIs(t, err, ErrInvalidDate)
+}
+
+func testSummaryGroups(t *testing.T, r Repository) {
+	ctx := context.Background()
+	alice, bob := uuid.NewString(), uuid.NewString()
+	service := "grouping-" + uuid.NewString()
+
+	mustCreate(t, r, newSub(alice, service+"-a", 100, "01-2024", ptr("02-2024")))
+	mustCreate(t, r, newSub(alice, service+"-b", 50, "02-2024", nil))
+	mustCreate(t, r, newSub(bob, service+"-a", 20, "01-2024", nil))
+
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{
+		ServiceName: &service,
+		From:        "01-2024",
+		To:          "02-2024",
+		GroupBy:     []string{models.GroupByServiceName},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 100*2+50+20*2, summary.Total)
+	assert.Equal(t, []models.SummaryGroup{
+		{ServiceName: ptr(service + "-a"), Total: 100*2 + 20*2},
+		{ServiceName: ptr(service + "-b"), Total: 50},
+	}, summary.Groups)
+
+	summary, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{
+		UserID:  &alice,
+		From:    "01-2024",
+		To:      "02-2024",
+		GroupBy: []string{models.GroupByMonth, models.GroupByServiceName},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.SummaryGroup{
+		{ServiceName: ptr(service + "-a"), Month: ptr("01-2024"), Total: 100},
+		{ServiceName: ptr(service + "-a"), Month: ptr("02-2024"), Total: 100},
+		{ServiceName: ptr(service + "-b"), Month: ptr("02-2024"), Total: 50},
+	}, summary.Groups)
+}
+
+func testSummaryBillingPeriods(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	withPeriod := func(s models.Subscription, period string, months *int) models.Subscription {
+		s.BillingPeriod, s.BillingMonths = period, months
+		return s
+	}
+	yearly := mustCreate(t, r, withPeriod(newSub(userID, "adobe", 23988, "01-2024", nil), models.BillingYearly, nil))
+	assert.Equal(t, models.BillingYearly, yearly.BillingPeriod)
+	mustCreate(t, r, withPeriod(newSub(userID, "quarterly", 1000, "03-2024", nil), models.BillingQuarterly, nil))
+	mustCreate(t, r, withPeriod(newSub(userID, "weekly", 100, "03-2024", ptr("05-2024")), models.BillingWeekly, nil))
+	custom := mustCreate(t, r, withPeriod(newSub(userID, "half-year", 600, "04-2024", nil), models.BillingCustom, ptr(6)))
+
+	got, err := r.GetSubscriptionByID(ctx, custom.ID)
+	require.NoError(t, err)
+	assert.Equal(t, custom, got)
+	require.NotNil(t, got.BillingMonths)
+	assert.Equal(t, 6, *got.BillingMonths)
+
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{
+		UserID:  &userID,
+		From:    "03-2024",
+		To:      "05-2024",
+		GroupBy: []string{models.GroupByServiceName},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.SummaryGroup{
+		{ServiceName: ptr("adobe"), Total: 3 * 1999},
+		{ServiceName: ptr("half-year"), Total: 2 * 100},
+		// Rounding is carried over so a full quarter costs exactly its price.
+		{ServiceName: ptr("quarterly"), Total: 1000},
+		// 100 a week is 433.33 a month.
+		{ServiceName: ptr("weekly"), Total: 1300},
+	}, summary.Groups)
+	assert.Equal(t, []models.MonthlyCost{
+		{Month: "03-2024", Total: 1999 + 333 + 433},
+		{Month: "04-2024", Total: 1999 + 100 + 333 + 433},
+		{Month: "05-2024", Total: 1999 + 100 + 334 + 434},
+	}, summary.Months)
+
+	summary, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, ServiceName: ptr("adobe"), From: "01-2024", To: "12-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, 23988, summary.Total)
+}
+
+func testDayPrecision(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	monthly := mustCreate(t, r, newSub(userID, "monthly", 1000, "01-2024", ptr("02-2024")))
+	assert.Equal(t, "2024-01-01", monthly.StartDate)
+	assert.Equal(t, ptr("2024-02-29"), monthly.EndDate)
+
+	daily := mustCreate(t, r, newSub(userID, "daily", 3100, "2024-01-20", ptr("2024-03-10T00:00:00Z")))
+	got, err := r.GetSubscriptionByID(ctx, daily.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-20", got.StartDate)
+	assert.Equal(t, ptr("2024-03-10"), got.EndDate)
+
+	for on, want := range map[string][]string{
+		"2024-01-19": {monthly.ID},
+		"2024-01-20": {monthly.ID, daily.ID},
+		"01-2024":    {monthly.ID, daily.ID},
+		"2024-03-10": {daily.ID},
+		"2024-03-11": {},
+	} {
+		page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, ActiveOn: ptr(on)})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, want, listIDs(page), on)
+	}
+
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, ServiceName: ptr("daily"), From: "01-2024", To: "04-2024"})
+	require.NoError(t, err)
+	// 12 of 31 days in January, all of February, 10 of 31 days in March.
+	assert.Equal(t, []models.MonthlyCost{
+		{Month: "01-2024", Total: 1200},
+		{Month: "02-2024", Total: 3100},
+		{Month: "03-2024", Total: 1000},
+		{Month: "04-2024", Total: 0},
+	}, summary.Months)
+
+	// The period itself may start or end mid-month.
+	summary, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "2024-02-15", To: "2024-03-05"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.MonthlyCost{
+		{Month: "02-2024", Total: 517 + 1603},
+		{Month: "03-2024", Total: 500},
+	}, summary.Months)
+
+	_, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{From: "2024-02-15", To: "2024-02-14"})
+	assert.ErrorIs(t, err, ErrInvalidDate)
+}
+
+func testPriceHistory(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	sub := mustCreate(t, r, newSub(userID, "netflix", 1000, "01-2024", ptr("06-2024")))
+
+	changes, err := r.ListPriceChanges(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	added, err := r.AddPriceChange(ctx, sub.ID, models.PriceChange{EffectiveFrom: "04-2024", Price: 2000})
+	require.NoError(t, err)
+	assert.Equal(t, models.PriceChange{EffectiveFrom: "2024-04-01", Price: 2000}, added)
+	_, err = r.AddPriceChange(ctx, sub.ID, models.PriceChange{EffectiveFrom: "2024-02-16", Price: 1500})
+	require.NoError(t, err)
+
+	changes, err = r.ListPriceChanges(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []models.PriceChange{
+		{EffectiveFrom: "2024-02-16", Price: 1500},
+		{EffectiveFrom: "2024-04-01", Price: 2000},
+	}, changes)
+
+	// Updating the subscription keeps its price history.
+	sub.ServiceName = "netflix premium"
+	_, err = r.UpdateSubscription(ctx, sub)
+	require.NoError(t, err)
+
+	// Its dates cannot move past a change they would leave outside.
+	for name, dates := range map[string][2]string{
+		"start on a change":    {"2024-02-16", "06-2024"},
+		"start after a change": {"03-2024", "06-2024"},
+		"end before a change":  {"01-2024", "03-2024"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			moved := sub
+			moved.StartDate, moved.EndDate = dates[0], ptr(dates[1])
+			_, err := r.UpdateSubscription(ctx, moved)
+			assert.ErrorIs(t, err, ErrInvalidInput)
+		})
+	}
+	got, err := r.GetSubscriptionByID(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-01", got.StartDate)
+
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2024", To: "06-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.MonthlyCost{
+		{Month: "01-2024", Total: 1000},
+		// 15 of 29 days at the old price, 14 at the new one.
+		{Month: "02-2024", Total: 517 + 724},
+		{Month: "03-2024", Total: 1500},
+		{Month: "04-2024", Total: 2000},
+		{Month: "05-2024", Total: 2000},
+		{Month: "06-2024", Total: 2000},
+	}, summary.Months)
+
+	tests := []struct {
+		name   string
+		id     string
+		change models.PriceChange
+		want   error
+	}{
+		{"duplicate day", sub.ID, models.PriceChange{EffectiveFrom: "2024-04-01", Price: 3000}, ErrConflict},
+		{"on start date", sub.ID, models.PriceChange{EffectiveFrom: "2024-01-01", Price: 3000}, ErrInvalidInput},
+		{"after end date", sub.ID, models.PriceChange{EffectiveFrom: "2024-07-01", Price: 3000}, ErrInvalidInput},
+		{"invalid date", sub.ID, models.PriceChange{EffectiveFrom: "2024-13-01", Price: 3000}, ErrInvalidDate},
+		{"non-positive price", sub.ID, models.PriceChange{EffectiveFrom: "2024-05-01", Price: 0}, ErrConstraint},
+		{"unknown subscription", uuid.NewString(), models.PriceChange{EffectiveFrom: "2024-05-01", Price: 3000}, ErrNotFound},
+		{"invalid id", "not-a-uuid", models.PriceChange{EffectiveFrom: "2024-05-01", Price: 3000}, ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.AddPriceChange(ctx, tt.id, tt.change)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	require.NoError(t, r.DeleteSubscription(ctx, sub.ID))
+	_, err = r.ListPriceChanges(ctx, sub.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func testPauses(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	sub := mustCreate(t, r, newSub(userID, "netflix", 1000, "01-2024", ptr("12-2024")))
+
+	paused, err := r.PauseSubscription(ctx, sub.ID, models.Pause{From: "03-2024", To: ptr("04-2024")})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Pause{{From: "2024-03-01", To: ptr("2024-04-30")}}, paused.Pauses)
+
+	_, err = r.PauseSubscription(ctx, sub.ID, models.Pause{From: "2024-06-16"})
+	require.NoError(t, err)
+	resumed, err := r.ResumeSubscription(ctx, sub.ID, "08-2024")
+	require.NoError(t, err)
+	assert.Equal(t, []models.Pause{
+		{From: "2024-03-01", To: ptr("2024-04-30")},
+		{From: "2024-06-16", To: ptr("2024-07-31")},
+	}, resumed.Pauses)
+
+	// A pause starting right after another one ends extends it.
+	_, err = r.PauseSubscription(ctx, sub.ID, models.Pause{From: "2024-05-01", To: ptr("2024-05-10")})
+	require.NoError(t, err)
+
+	// Updating the subscription keeps its pauses.
+	sub.ServiceName = "netflix premium"
+	_, err = r.UpdateSubscription(ctx, sub)
+	require.NoError(t, err)
+
+	// Its dates cannot move past a pause they would leave outside.
+	for name, dates := range map[string][2]string{
+		"start after a pause starts": {"2024-03-02", "12-2024"},
+		"end before a pause":         {"01-2024", "02-2024"},
+		"end within a pause":         {"01-2024", "2024-07-15"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			moved := sub
+			moved.StartDate, moved.EndDate = dates[0], ptr(dates[1])
+			_, err := r.UpdateSubscription(ctx, moved)
+			assert.ErrorIs(t, err, ErrInvalidInput)
+		})
+	}
+
+	got, err := r.GetSubscriptionByID(ctx, sub.ID)
+	require.NoError(t, err)
+	want := []models.Pause{
+		{From: "2024-03-01", To: ptr("2024-05-10")},
+		{From: "2024-06-16", To: ptr("2024-07-31")},
+	}
+	assert.Equal(t, want, got.Pauses)
+
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2024", To: "08-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.MonthlyCost{
+		{Month: "01-2024", Total: 1000},
+		{Month: "02-2024", Total: 1000},
+		{Month: "03-2024", Total: 0},
+		{Month: "04-2024", Total: 0},
+		{Month: "05-2024", Total: 677}, // 21 of 31 days
+		{Month: "06-2024", Total: 500}, // 15 of 30 days
+		{Month: "07-2024", Total: 0},
+		{Month: "08-2024", Total: 1000},
+	}, summary.Months)
+
+	for on, active := range map[string]bool{
+		"2024-03-15": false,
+		"05-2024":    true,
+		"2024-05-10": false,
+		"06-2024":    true,
+		"07-2024":    false,
+		"2024-08-01": true,
+	} {
+		page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, ActiveOn: ptr(on)})
+		require.NoError(t, err)
+		if active {
+			require.Len(t, page.Items, 1, "active on %s", on)
+			assert.Equal(t, want, page.Items[0].Pauses)
+		} else {
+			assert.Empty(t, page.Items, "active on %s", on)
+		}
+	}
+
+	pauseTests := []struct {
+		name  string
+		id    string
+		pause models.Pause
+		want  error
+	}{
+		{"overlapping", sub.ID, models.Pause{From: "2024-07-01", To: ptr("2024-08-15")}, ErrConflict},
+		{"open-ended overlapping", sub.ID, models.Pause{From: "2024-02-01"}, ErrConflict},
+		{"before start date", sub.ID, models.Pause{From: "12-2023", To: ptr("01-2024")}, ErrInvalidInput},
+		{"after end date", sub.ID, models.Pause{From: "12-2024", To: ptr("01-2025")}, ErrInvalidInput},
+		{"ends before it starts", sub.ID, models.Pause{From: "2024-10-10", To: ptr("2024-10-01")}, ErrInvalidInput},
+		{"invalid date", sub.ID, models.Pause{From: "2024-13-01"}, ErrInvalidDate},
+		{"unknown subscription", uuid.NewString(), models.Pause{From: "10-2024"}, ErrNotFound},
+		{"invalid id", "not-a-uuid", models.Pause{From: "10-2024"}, ErrInvalidInput},
+	}
+	for _, tt := range pauseTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.PauseSubscription(ctx, tt.id, tt.pause)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	resumeTests := []struct {
+		name string
+		id   string
+		on   string
+		want error
+	}{
+		{"not paused", sub.ID, "2024-02-01", ErrConflict},
+		{"invalid date", sub.ID, "2024-02-30", ErrInvalidDate},
+		{"unknown subscription", uuid.NewString(), "2024-04-01", ErrNotFound},
+	}
+	for _, tt := range resumeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.ResumeSubscription(ctx, tt.id, tt.on)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	// Resuming on the first day of a pause cancels it.
+	resumed, err = r.ResumeSubscription(ctx, sub.ID, "2024-06-16")
+	require.NoError(t, err)
+	assert.Equal(t, want[:1], resumed.Pauses)
+}
+
+func testTrials(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	s := newSub(userID, "netflix", 1000, "2024-01-01", nil)
+	s.TrialEndDate = ptr("2024-01-14")
+	s.IntroPrice, s.IntroMonths = ptr(500), ptr(2)
+	sub := mustCreate(t, r, s)
+	assert.Equal(t, ptr("2024-01-14"), sub.TrialEndDate)
+
+	got, err := r.GetSubscriptionByID(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, sub, got)
+
+	// The intro price applies from January 15 through March 14.
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2024", To: "04-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.MonthlyCost{
+		{Month: "01-2024", Total: 274},       // 17 of 31 days at 500
+		{Month: "02-2024", Total: 500},       // intro price
+		{Month: "03-2024", Total: 226 + 548}, // 14 days at 500, 17 at 1000
+		{Month: "04-2024", Total: 1000},
+	}, summary.Months)
+
+	// A trial month lasts until its end.
+	sub.TrialEndDate = ptr("02-2024")
+	sub.IntroPrice, sub.IntroMonths = nil, nil
+	updated, err := r.UpdateSubscription(ctx, sub)
+	require.NoError(t, err)
+	assert.Equal(t, ptr("2024-02-29"), updated.TrialEndDate)
+	summary, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2024", To: "03-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, 1000, summary.Total)
+
+	today := dates.Today()
+	day := func(offset int) string { return today.AddDate(0, 0, offset).Format(dates.DayLayout) }
+	ending := map[int]string{}
+	for _, offset := range []int{-1, 0, 3, 10} {
+		s := newSub(userID, fmt.Sprintf("trial %d", offset), 1000, day(-30), nil)
+		s.TrialEndDate = ptr(day(offset))
+		ending[offset] = mustCreate(t, r, s).ID
+	}
+	for days, want := range map[int][]string{
+		0:  {ending[0]},
+		7:  {ending[0], ending[3]},
+		10: {ending[0], ending[3], ending[10]},
+	} {
+		page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, TrialEndsWithin: ptr(days)})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, want, listIDs(page), "trials ending within %d days", days)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(s *models.Subscription)
+		want   error
+	}{
+		{"trial ends before start", func(s *models.Subscription) { s.TrialEndDate = ptr("2023-12-31") }, ErrInvalidInput},
+		{"invalid trial end date", func(s *models.Subscription) { s.TrialEndDate = ptr("2024-02-30") }, ErrInvalidDate},
+		{"intro price without months", func(s *models.Subscription) { s.IntroPrice = ptr(500) }, ErrInvalidInput},
+		{"negative intro price", func(s *models.Subscription) { s.IntroPrice, s.IntroMonths = ptr(-1), ptr(1) }, ErrInvalidInput},
+		{"zero intro months", func(s *models.Subscription) { s.IntroPrice, s.IntroMonths = ptr(500), ptr(0) }, ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSub(userID, "netflix", 1000, "2024-01-01", nil)
+			tt.modify(&s)
+			_, err := r.CreateSubscription(ctx, s)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func testServices(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	services, err := r.ListServices(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, services)
+
+	netflix, err := r.CreateService(ctx, models.Service{
+		Name:            " Netflix ",
+		Aliases:         []string{"Netflix  Premium", "netflix", "", "NFLX", "nflx"},
+		Category:        "video",
+		DefaultPrice:    ptr(1299),
+		DefaultCurrency: "EUR",
+		Homepage:        "https://www.netflix.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Netflix", netflix.Name)
+	assert.Equal(t, []string{"Netflix  Premium", "NFLX"}, netflix.Aliases)
+
+	spotify, err := r.CreateService(ctx, models.Service{Name: "Spotify"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, spotify.Aliases)
+
+	got, err := r.GetServiceByID(ctx, netflix.ID)
+	require.NoError(t, err)
+	assert.Equal(t, netflix, got)
+	services, err = r.ListServices(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Service{netflix, spotify}, services)
+
+	// Free-text names are matched by alias, ignoring case and extra spaces.
+	byAlias := mustCreate(t, r, newSub(userID, "  netflix premium ", 999, "01-2024", nil))
+	require.NotNil(t, byAlias.ServiceID)
+	assert.Equal(t, netflix.ID, *byAlias.ServiceID)
+	assert.Equal(t, "Netflix", byAlias.ServiceName)
+	assert.Equal(t, 999, byAlias.Price)
+	assert.Equal(t, "EUR", byAlias.Currency)
+
+	// A service_id supplies the name and the default price.
+	byID := mustCreate(t, r, models.Subscription{ServiceID: &netflix.ID, UserID: userID, StartDate: "01-2024"})
+	assert.Equal(t, "Netflix", byID.ServiceName)
+	assert.Equal(t, 1299, byID.Price)
+
+	unknown := mustCreate(t, r, newSub(userID, " Kinopoisk ", 500, "01-2024", nil))
+	assert.Nil(t, unknown.ServiceID)
+	assert.Equal(t, "Kinopoisk", unknown.ServiceName)
+
+	page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, ServiceID: &netflix.ID})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{byAlias.ID, byID.ID}, listIDs(page))
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, ServiceID: &netflix.ID, From: "01-2024", To: "01-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, 999+1299, summary.Total)
+
+	// Renaming a service renames its subscriptions.
+	netflix.Name = "Netflix Standard"
+	netflix.Aliases = []string{"Netflix"}
+	updated, err := r.UpdateService(ctx, netflix)
+	require.NoError(t, err)
+	assert.Equal(t, netflix, updated)
+	sub, err := r.GetSubscriptionByID(ctx, byAlias.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Netflix Standard", sub.ServiceName)
+
+	// The dropped alias no longer matches.
+	other := mustCreate(t, r, newSub(userID, "NFLX", 500, "01-2024", nil))
+	assert.Nil(t, other.ServiceID)
+
+	_, err = r.CreateService(ctx, models.Service{Name: "Music", Aliases: []string{" SPOTIFY"}})
+	assert.ErrorIs(t, err, ErrConflict)
+	spotify.Aliases = []string{"netflix"}
+	_, err = r.UpdateService(ctx, spotify)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = r.CreateSubscription(ctx, models.Subscription{ServiceID: ptr(uuid.NewString()), UserID: userID, StartDate: "01-2024"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = r.CreateSubscription(ctx, models.Subscription{ServiceID: &spotify.ID, UserID: userID, StartDate: "01-2024"})
+	assert.ErrorIs(t, err, ErrConstraint, "no price and no default price")
+	_, err = r.CreateService(ctx, models.Service{Name: " "})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = r.UpdateService(ctx, models.Service{ID: uuid.NewString(), Name: "Gone"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Deleting a service keeps the names of its subscriptions.
+	require.NoError(t, r.DeleteService(ctx, netflix.ID))
+	sub, err = r.GetSubscriptionByID(ctx, byID.ID)
+	require.NoError(t, err)
+	assert.Nil(t, sub.ServiceID)
+	assert.Equal(t, "Netflix Standard", sub.ServiceName)
+	_, err = r.GetServiceByID(ctx, netflix.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, r.DeleteService(ctx, netflix.ID), ErrNotFound)
+}
+
+func testServiceAudit(t *testing.T, r Repository) {
+	ctx := WithAuditInfo(context.Background(), AuditInfo{Actor: "admin", RequestID: "req-1"})
+	svc, err := r.CreateService(ctx, models.Service{Name: "Netflix"})
+	require.NoError(t, err)
+	// Its tags must not show up among the changes made by the catalog.
+	linked := mustCreate(t, r, models.Subscription{ServiceID: &svc.ID, Price: 999, UserID: uuid.NewString(), StartDate: "01-2024", Tags: []string{"video"}})
+	deleted := mustCreate(t, r, models.Subscription{ServiceID: &svc.ID, Price: 999, UserID: uuid.NewString(), StartDate: "01-2024"})
+	require.NoError(t, r.DeleteSubscription(ctx, deleted.ID))
+	deleted, err = r.GetSubscriptionByID(WithDeleted(ctx), deleted.ID)
+	require.NoError(t, err)
+	lastEntry := func() models.AuditEntry {
+		history, err := r.ListSubscriptionHistory(ctx, linked.ID)
+		require.NoError(t, err)
+		return history[len(history)-1]
+	}
+
+	// Renaming the service is an update of the subscriptions it renames.
+	svc.Name = "Netflix Standard"
+	_, err = r.UpdateService(ctx, svc)
+	require.NoError(t, err)
+	e := lastEntry()
+	assert.Equal(t, models.AuditUpdate, e.Action)
+	assert.Equal(t, "admin", e.Actor)
+	assert.Equal(t, "req-1", e.RequestID)
+	assert.Equal(t, map[string]models.FieldChange{
+		"service_name": {Before: json.RawMessage(`"Netflix"`), After: json.RawMessage(`"Netflix Standard"`)},
+	}, e.Changes)
+	got, err := r.GetSubscriptionByID(ctx, linked.ID)
+	require.NoError(t, err)
+	assert.Equal(t, linked.Version+1, got.Version)
+	// Deleted subscriptions cannot change, so they keep the old name.
+	got, err = r.GetSubscriptionByID(WithDeleted(ctx), deleted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Netflix", got.ServiceName)
+	assert.Equal(t, deleted.Version, got.Version)
+
+	// So is unlinking them when it is deleted.
+	require.NoError(t, r.DeleteService(ctx, svc.ID))
+	e = lastEntry()
+	assert.Equal(t, models.AuditUpdate, e.Action)
+	assert.Equal(t, map[string]models.FieldChange{
+		"service_id": {Before: json.RawMessage(`"` + svc.ID + `"`)},
+	}, e.Changes)
+	got, err = r.GetSubscriptionByID(ctx, linked.ID)
+	require.NoError(t, err)
+	assert.Equal(t, linked.Version+2, got.Version)
+	// Deleted ones are unlinked too, as they cannot refer to a missing entry.
+	got, err = r.GetSubscriptionByID(WithDeleted(ctx), deleted.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.ServiceID)
+	assert.Equal(t, deleted.Version+1, got.Version)
+}
+
+func testCategoriesAndTags(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	netflix := newSub(userID, " netflix ", 1000, "01-2024", nil)
+	netflix.Tags = []string{"Family", " family ", "shared  account", ""}
+	netflix = mustCreate(t, r, netflix)
+	assert.Equal(t, "streaming", netflix.Category, "default for a well-known service")
+	assert.Equal(t, []string{"family", "shared account"}, netflix.Tags)
+
+	got, err := r.GetSubscriptionByID(ctx, netflix.ID)
+	require.NoError(t, err)
+	assert.Equal(t, netflix, got)
+
+	notion := newSub(userID, "Notion", 800, "01-2024", nil)
+	notion.Category = " Work "
+	notion.Tags = []string{"work"}
+	notion = mustCreate(t, r, notion)
+	assert.Equal(t, "work", notion.Category, "overridden")
+
+	svc, err := r.CreateService(ctx, models.Service{Name: "Kinopoisk", Category: "Cinema"})
+	require.NoError(t, err)
+	kinopoisk := mustCreate(t, r, newSub(userID, "kinopoisk", 300, "01-2024", nil))
+	assert.Equal(t, "cinema", kinopoisk.Category, "catalog category precedes the built-in one")
+	assert.Nil(t, kinopoisk.Tags)
+
+	unknown := mustCreate(t, r, newSub(userID, "Local Gym", 2000, "01-2024", ptr("01-2024")))
+	assert.Equal(t, "", unknown.Category)
+
+	for _, tc := range []struct {
+		name     string
+		category *string
+		tags     []string
+		want     []string
+	}{
+		{"category", ptr("Streaming"), nil, []string{netflix.ID}},
+		{"tag", nil, []string{"FAMILY"}, []string{netflix.ID}},
+		{"all tags", nil, []string{"family", "work"}, nil},
+		{"category and tag", ptr("work"), []string{"work"}, []string{notion.ID}},
+		{"uncategorized", ptr(""), nil, []string{unknown.ID}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, Category: tc.category, Tags: tc.tags})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tc.want, listIDs(page))
+		})
+	}
+
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{
+		UserID: &userID, From: "01-2024", To: "02-2024", GroupBy: []string{models.GroupByCategory},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.SummaryGroup{
+		{Category: ptr(""), Total: 2000},
+		{Category: ptr("cinema"), Total: 2 * 300},
+		{Category: ptr("streaming"), Total: 2 * 1000},
+		{Category: ptr("work"), Total: 2 * 800},
+	}, summary.Groups)
+
+	summary, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{
+		UserID: &userID, From: "01-2024", To: "01-2024", Tags: []string{"family"}, GroupBy: []string{models.GroupByTag},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1000, summary.Total)
+	assert.Equal(t, []models.SummaryGroup{
+		{Tag: ptr("family"), Total: 1000},
+		{Tag: ptr("shared account"), Total: 1000},
+	}, summary.Groups, "a subscription counts towards each of its tags")
+
+	summary, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{
+		UserID: &userID, From: "01-2024", To: "01-2024", Category: ptr("work"), GroupBy: []string{models.GroupByTag},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.SummaryGroup{{Tag: ptr("work"), Total: 800}}, summary.Groups)
+
+	// Updates replace the tags, and an empty category falls back to the default.
+	notion.Category = ""
+	notion.Tags = []string{"Team"}
+	updated, err := r.UpdateSubscription(ctx, notion)
+	require.NoError(t, err)
+	assert.Equal(t, "productivity", updated.Category)
+	assert.Equal(t, []string{"team"}, updated.Tags)
+	got, err = r.GetSubscriptionByID(ctx, notion.ID)
+	require.NoError(t, err)
+	assert.Equal(t, updated, got)
+
+	require.NoError(t, r.DeleteService(ctx, svc.ID))
+	require.NoError(t, r.DeleteSubscription(ctx, netflix.ID))
+	page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, Tags: []string{"family"}})
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+}
+
+func testAuditLog(t *testing.T, r Repository) {
+	ctx := WithAuditInfo(context.Background(), AuditInfo{Actor: "admin", RequestID: "req-1"})
+	userID := uuid.NewString()
+
+	created, err := r.CreateSubscription(ctx, newSub(userID, "Netflix", 1000, "01-2024", nil))
+	require.NoError(t, err)
+	other := mustCreate(t, r, newSub(userID, "Spotify", 500, "01-2024", nil))
+
+	updated := created
+	updated.Price = 1200
+	updated.EndDate = ptr("12-2024")
+	userCtx := WithAuditInfo(context.Background(), AuditInfo{Actor: "user:" + userID, RequestID: "req-2"})
+	updated, err = r.UpdateSubscription(userCtx, updated)
+	require.NoError(t, err)
+	_, err = r.AddPriceChange(userCtx, created.ID, models.PriceChange{EffectiveFrom: "06-2024", Price: 1500})
+	require.NoError(t, err)
+	_, err = r.PauseSubscription(userCtx, created.ID, models.Pause{From: "2024-03-01", To: ptr("2024-03-31")})
+	require.NoError(t, err)
+	_, err = r.ResumeSubscription(userCtx, created.ID, "2024-03-15")
+	require.NoError(t, err)
+	require.NoError(t, r.DeleteSubscription(ctx, created.ID))
+
+	// Failed mutations leave no trace.
+	_, err = r.PauseSubscription(ctx, other.ID, models.Pause{From: "2023-01-01"})
+	require.ErrorIs(t, err, ErrInvalidInput)
+	require.ErrorIs(t, r.DeleteSubscription(ctx, created.ID), ErrNotFound)
+
+	history, err := r.ListSubscriptionHistory(ctx, created.ID)
+	require.NoError(t, err, "history outlives the subscription")
+	actions := make([]string, len(history))
+	for i, e := range history {
+		actions[i] = e.Action
+		assert.Equal(t, created.ID, e.SubscriptionID)
+		assert.WithinDuration(t, time.Now(), e.At, time.Minute)
+		if i > 0 {
+			assert.Greater(t, e.ID, history[i-1].ID)
+		}
+	}
+	require.Equal(t, []string{
+		models.AuditCreate, models.AuditUpdate, models.AuditPriceChange, models.AuditPause, models.AuditResume, models.AuditDelete,
+	}, actions)
+
+	create := history[0]
+	assert.Equal(t, "admin", create.Actor)
+	assert.Equal(t, "req-1", create.RequestID)
+	require.Contains(t, create.Changes, "service_name")
+	assert.Nil(t, create.Changes["service_name"].Before)
+	assert.JSONEq(t, `"Netflix"`, string(create.Changes["service_name"].After))
+
+	update := history[1]
+	assert.Equal(t, "user:"+userID, update.Actor)
+	assert.Equal(t, "req-2", update.RequestID)
+	assert.Len(t, update.Changes, 2, "only changed fields")
+	assert.JSONEq(t, `1000`, string(update.Changes["price"].Before))
+	assert.JSONEq(t, `1200`, string(update.Changes["price"].After))
+	assert.Nil(t, update.Changes["end_date"].Before)
+	assert.JSONEq(t, `"2024-12-31"`, string(update.Changes["end_date"].After))
+
+	assert.JSONEq(t, `"2024-06-01"`, string(history[2].Changes["effective_from"].After))
+	assert.JSONEq(t, `[{"from":"2024-03-01","to":"2024-03-31"}]`, string(history[3].Changes["pauses"].After))
+	assert.JSONEq(t, `[{"from":"2024-03-01","to":"2024-03-14"}]`, string(history[4].Changes["pauses"].After))
+
+	del := history[5]
+	assert.JSONEq(t, `"Netflix"`, string(del.Changes["service_name"].Before))
+	assert.Nil(t, del.Changes["service_name"].After)
+
+	_, err = r.ListSubscriptionHistory(ctx, uuid.NewString())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// The whole log, newest first, filtered and paged.
+	page, err := r.ListAuditEntries(ctx, models.AuditListRequest{Limit: 4})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 4)
+	assert.True(t, page.HasMore)
+	assert.Equal(t, models.AuditDelete, page.Items[0].Action)
+	require.NotNil(t, page.NextCursor)
+	page, err = r.ListAuditEntries(ctx, models.AuditListRequest{Limit: 4, Cursor: *page.NextCursor})
+	require.NoError(t, err)
+	assert.False(t, page.HasMore)
+	require.Len(t, page.Items, 3)
+	assert.Equal(t, models.AuditCreate, page.Items[2].Action)
+	assert.Equal(t, other.ID, page.Items[1].SubscriptionID)
+	assert.Equal(t, SystemActor, page.Items[1].Actor, "no audit info")
+
+	for _, tc := range []struct {
+		name   string
+		filter models.AuditListRequest
+		want   int
+	}{
+		{"subscription", models.AuditListRequest{SubscriptionID: &other.ID}, 1},
+		{"actor", models.AuditListRequest{Actor: ptr("user:" + userID)}, 4},
+		{"action", models.AuditListRequest{Action: ptr(models.AuditPause)}, 1},
+		{"request", models.AuditListRequest{RequestID: ptr("req-1")}, 2},
+		{"today", models.AuditListRequest{From: ptr(time.Now().UTC().Format("2006-01-02")), To: ptr(time.Now().UTC().Format("2006-01-02"))}, 7},
+		{"before", models.AuditListRequest{To: ptr("2020-01-01")}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := r.ListAuditEntries(ctx, tc.filter)
+			require.NoError(t, err)
+			assert.Len(t, page.Items, tc.want)
+		})
+	}
+
+	_, err = r.ListAuditEntries(ctx, models.AuditListRequest{Cursor: "abc"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = r.ListAuditEntries(ctx, models.AuditListRequest{From: ptr("2024-13-01")})
+	assert.ErrorIs(t, err, ErrInvalidDate)
+}
+
+func testSoftDelete(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	kept := mustCreate(t, r, newSub(userID, "Spotify", 500, "01-2024", nil))
+	deleted := mustCreate(t, r, newSub(userID, "Netflix", 1000, "01-2024", nil))
+	_, err := r.AddPriceChange(ctx, deleted.ID, models.PriceChange{EffectiveFrom: "03-2024", Price: 1500})
+	require.NoError(t, err)
+	require.NoError(t, r.DeleteSubscription(ctx, deleted.ID))
+
+	// Deleted subscriptions are hidden from reads and cannot be changed.
+	_, err = r.GetSubscriptionByID(ctx, deleted.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID})
+	require.NoError(t, err)
+	assert.Equal(t, []string{kept.ID}, listIDs(page))
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2024", To: "01-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, 500, summary.Total)
+
+	assert.ErrorIs(t, r.DeleteSubscription(ctx, deleted.ID), ErrNotFound)
+	_, err = r.UpdateSubscription(ctx, deleted)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.AddPriceChange(ctx, deleted.ID, models.PriceChange{EffectiveFrom: "04-2024", Price: 1600})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.PauseSubscription(ctx, deleted.ID, models.Pause{From: "2024-02-01"})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.ListPriceChanges(ctx, deleted.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Unless the reader asks for them.
+	all := WithDeleted(ctx)
+	got, err := r.GetSubscriptionByID(all, deleted.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.DeletedAt)
+	assert.WithinDuration(t, time.Now(), *got.DeletedAt, time.Minute)
+	assert.Equal(t, time.UTC, got.DeletedAt.Location())
+	page, err = r.ListSubscriptions(all, models.SubscriptionListRequest{UserID: &userID})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{kept.ID, deleted.ID}, listIDs(page))
+	summary, err = r.SumSubscriptions(all, models.SubscriptionSumRequest{UserID: &userID, From: "03-2024", To: "03-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, 2000, summary.Total)
+
+	// Restoring brings back the subscription with its price history.
+	restored, err := r.RestoreSubscription(ctx, deleted.ID)
+	require.NoError(t, err)
+	deleted.Version = 4 // after the price change, deletion and restore
+	assert.Equal(t, deleted, restored)
+	got, err = r.GetSubscriptionByID(ctx, deleted.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.DeletedAt)
+	changes, err := r.ListPriceChanges(ctx, deleted.ID)
+	require.NoError(t, err)
+	assert.Len(t, changes, 1)
+
+	_, err = r.RestoreSubscription(ctx, deleted.ID)
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = r.RestoreSubscription(ctx, uuid.NewString())
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.RestoreSubscription(ctx, "not-a-uuid")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	// The purge removes only what was deleted before the cutoff.
+	require.NoError(t, r.DeleteSubscription(ctx, deleted.ID))
+	n, err := r.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	n, err = r.PurgeDeleted(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = r.GetSubscriptionByID(all, deleted.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.RestoreSubscription(ctx, deleted.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.GetSubscriptionByID(ctx, kept.ID)
+	assert.NoError(t, err)
+
+	history, err := r.ListSubscriptionHistory(ctx, deleted.ID)
+	require.NoError(t, err, "history outlives the purge")
+	actions := make([]string, len(history))
+	for i, e := range history {
+		actions[i] = e.Action
+	}
+	assert.Equal(t, []string{
+		models.AuditCreate, models.AuditPriceChange, models.AuditDelete, models.AuditRestore, models.AuditDelete, models.AuditPurge,
+	}, actions)
+	assert.JSONEq(t, `"Netflix"`, string(history[3].Changes["service_name"].After))
+	assert.Empty(t, history[5].Changes)
+}
+
+func testVersions(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	created := mustCreate(t, r, newSub(userID, "Netflix", 1000, "01-2024", nil))
+	assert.Equal(t, 1, created.Version)
+
+	created.Price = 1200
+	updated, err := r.UpdateSubscription(WithExpectedVersion(ctx, 1), created)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+
+	// A stale version is rejected without changing anything.
+	created.Price = 1500
+	_, err = r.UpdateSubscription(WithExpectedVersion(ctx, 1), created)
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	assert.ErrorIs(t, r.DeleteSubscription(WithExpectedVersion(ctx, 1), created.ID), ErrVersionMismatch)
+	got, err := r.GetSubscriptionByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1200, got.Price)
+	assert.Equal(t, 2, got.Version)
+
+	// Every other change counts as well.
+	_, err = r.AddPriceChange(ctx, created.ID, models.PriceChange{EffectiveFrom: "06-2024", Price: 1300})
+	require.NoError(t, err)
+	paused, err := r.PauseSubscription(ctx, created.ID, models.Pause{From: "2024-03-01"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, paused.Version)
+
+	svc, err := r.CreateService(ctx, models.Service{Name: "Disney+"})
+	require.NoError(t, err)
+	linked := mustCreate(t, r, newSub(userID, "Disney+", 800, "01-2024", nil))
+	svc.Name = "Disney Plus"
+	_, err = r.UpdateService(ctx, svc)
+	require.NoError(t, err)
+	got, err = r.GetSubscriptionByID(ctx, linked.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.Version, "renamed by the catalog")
+
+	require.NoError(t, r.DeleteSubscription(WithExpectedVersion(ctx, 4), created.ID))
+	_, err = r.UpdateSubscription(WithExpectedVersion(ctx, 5), updated)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func testIdempotencyKeys(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+	key := IdempotencyKey{Key: uuid.NewString(), Hash: "a", ExpiresAt: time.Now().Add(time.Hour)}
+
+	created, err := r.CreateSubscription(WithIdempotencyKey(ctx, key), newSub(userID, "Netflix", 1000, "01-2024", nil))
+	require.NoError(t, err)
+	// The original response is replayed even after the subscription changed.
+	changed := created
+	changed.Price = 1200
+	_, err = r.UpdateSubscription(ctx, changed)
+	require.NoError(t, err)
+	replayed, err := r.CreateSubscription(WithIdempotencyKey(ctx, key), newSub(userID, "Netflix", 1000, "01-2024", nil))
+	require.NoError(t, err)
+	assert.Equal(t, created, replayed)
+
+	other := key
+	other.Hash = "b"
+	_, err = r.CreateSubscription(WithIdempotencyKey(ctx, other), newSub(userID, "Netflix", 1500, "01-2024", nil))
+	assert.ErrorIs(t, err, ErrConflict)
+
+	page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	history, err := r.ListSubscriptionHistory(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	// An expired key names a new request.
+	expired := IdempotencyKey{Key: uuid.NewString(), Hash: "a", ExpiresAt: time.Now().Add(-time.Minute)}
+	first, err := r.CreateSubscription(WithIdempotencyKey(ctx, expired), newSub(userID, "Spotify", 500, "01-2024", nil))
+	require.NoError(t, err)
+	second, err := r.CreateSubscription(WithIdempotencyKey(ctx, expired), newSub(userID, "Spotify", 500, "01-2024", nil))
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	n, err := r.PurgeIdempotencyKeys(ctx, time.Now())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 1)
+	n, err = r.PurgeIdempotencyKeys(ctx, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 1)
+	again, err := r.CreateSubscription(WithIdempotencyKey(ctx, key), newSub(userID, "Netflix", 1000, "01-2024", nil))
+	require.NoError(t, err)
+	assert.NotEqual(t, created.ID, again.ID)
+}
+
+func testTransactions(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+	kept := mustCreate(t, r, newSub(userID, "Netflix", 1000, "01-2024", nil))
+
+	// A failure discards every change made before it, audit entries included.
+	var rolledBack models.Subscription
+	err := r.InTransaction(ctx, func(tx Repository) error {
+		var err error
+		rolledBack, err = tx.CreateSubscription(ctx, newSub(userID, "Spotify", 500, "01-2024", nil))
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteSubscription(ctx, kept.ID); err != nil {
+			return err
+		}
+		// The transaction sees its own changes.
+		if _, err := tx.GetSubscriptionByID(ctx, rolledBack.ID); err != nil {
+			return err
+		}
+		return tx.DeleteSubscription(ctx, uuid.NewString())
+	})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.GetSubscriptionByID(ctx, rolledBack.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = r.ListSubscriptionHistory(ctx, rolledBack.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	got, err := r.GetSubscriptionByID(ctx, kept.ID)
+	require.NoError(t, err)
+	assert.Equal(t, kept, got)
+
+	var created models.Subscription
+	require.NoError(t, r.InTransaction(ctx, func(tx Repository) error {
+		var err error
+		created, err = tx.CreateSubscription(ctx, newSub(userID, "Spotify", 500, "01-2024", nil))
+		if err != nil {
+			return err
+		}
+		return tx.DeleteSubscription(ctx, kept.ID)
+	}))
+	got, err = r.GetSubscriptionByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created, got)
+	_, err = r.GetSubscriptionByID(ctx, kept.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	history, err := r.ListSubscriptionHistory(ctx, kept.ID)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func testExchangeRates(t *testing.T, r Repository) {
+	ctx := context.Background()
+
+	rates, err := r.ListExchangeRates(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, rates)
+
+	require.NoError(t, r.SetExchangeRates(ctx, []models.ExchangeRate{
+		{Currency: "RUB", Month: "02-2024", Rate: 90},
+		{Currency: "EUR", Month: "01-2024", Rate: 0.9},
+		{Currency: "RUB", Month: "01-2024", Rate: 88.5},
+	}))
+	require.NoError(t, r.SetExchangeRates(ctx, []models.ExchangeRate{{Currency: "RUB", Month: "02-2024", Rate: 91}}))
+
+	rates, err = r.ListExchangeRates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ExchangeRate{
+		{Currency: "EUR", Month: "01-2024", Rate: 0.9},
+		{Currency: "RUB", Month: "01-2024", Rate: 88.5},
+		{Currency: "RUB", Month: "02-2024", Rate: 91},
+	}, rates)
+
+	// A bad rate rejects the whole batch.
+	err = r.SetExchangeRates(ctx, []models.ExchangeRate{
+		{Currency: "GBP", Month: "01-2024", Rate: 0.8},
+		{Currency: "GBP", Month: "02-2024", Rate: 0},
+	})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	err = r.SetExchangeRates(ctx, []models.ExchangeRate{{Currency: models.BaseCurrency, Month: "01-2024", Rate: 1}})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	err = r.SetExchangeRates(ctx, []models.ExchangeRate{{Currency: "GBP", Month: "2024-01", Rate: 0.8}})
+	assert.ErrorIs(t, err, ErrInvalidDate)
+
+	require.NoError(t, r.DeleteExchangeRate(ctx, "RUB", "01-2024"))
+	assert.ErrorIs(t, r.DeleteExchangeRate(ctx, "RUB", "01-2024"), ErrNotFound)
+	assert.ErrorIs(t, r.DeleteExchangeRate(ctx, "RUB", "January"), ErrInvalidDate)
+
+	rates, err = r.ListExchangeRates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ExchangeRate{
+		{Currency: "EUR", Month: "01-2024", Rate: 0.9},
+		{Currency: "RUB", Month: "02-2024", Rate: 91},
+	}, rates)
+}
+
+func testSummaryCurrency(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	withCurrency := func(s models.Subscription, currency string) models.Subscription {
+		s.Currency = currency
+		return s
+	}
+	mustCreate(t, r, withCurrency(newSub(userID, "netflix", 1000, "01-2024", nil), "USD"))
+	mustCreate(t, r, withCurrency(newSub(userID, "kinopoisk", 45000, "01-2024", nil), "RUB"))
+	mustCreate(t, r, withCurrency(newSub(userID, "spotify", 900, "02-2024", nil), "EUR"))
+
+	require.NoError(t, r.SetExchangeRates(ctx, []models.ExchangeRate{
+		{Currency: "RUB", Month: "12-2023", Rate: 90},
+		{Currency: "RUB", Month: "03-2024", Rate: 100},
+		{Currency: "EUR", Month: "01-2024", Rate: 0.9},
+	}))
+
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{
+		UserID:   &userID,
+		From:     "01-2024",
+		To:       "03-2024",
+		Currency: ptr("USD"),
+		GroupBy:  []string{models.GroupByCurrency},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ptr("USD"), summary.Currency)
+	// RUB is converted at the December rate until the March one takes over.
+	assert.Equal(t, []models.MonthlyCost{
+		{Month: "01-2024", Total: 1000 + 500},
+		{Month: "02-2024", Total: 1000 + 500 + 1000},
+		{Month: "03-2024", Total: 1000 + 450 + 1000},
+	}, summary.Months)
+	assert.Equal(t, []models.SummaryGroup{
+		{Currency: ptr("EUR"), Total: 2000},
+		{Currency: ptr("RUB"), Total: 1450},
+		{Currency: ptr("USD"), Total: 3000},
+	}, summary.Groups)
+
+	summary, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "02-2024", To: "02-2024", Currency: ptr("RUB")})
+	require.NoError(t, err)
+	assert.Equal(t, 90000+45000+90000, summary.Total)
+
+	// Without a currency the amounts are added up as they are.
+	summary, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "02-2024", To: "02-2024"})
+	require.NoError(t, err)
+	assert.Equal(t, 1000+45000+900, summary.Total)
+	assert.Nil(t, summary.Currency)
+
+	_, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2024", To: "01-2024", Currency: ptr("GBP")})
+	assert.ErrorIs(t, err, ErrNoRate)
+
+	_, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2024", To: "01-2024", Currency: ptr("usd")})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func testConcurrency(t *testing.T, r Repository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+	const workers = 20
+
+	var wg sync.WaitGroup
+	ids := make([]string, workers)
+	errs := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, err := r.CreateSubscription(ctx, newSub(userID, fmt.Sprintf("service %d", i), 100+i, "01-2024", nil))
+			ids[i], errs[i] = s.ID, err
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	page, err := r.ListSubscriptions(ctx, models.SubscriptionListRequest{UserID: &userID, Limit: workers})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, ids, listIDs(page))
+
+	// Concurrent writers and readers on the same rows must not fail.
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			s := newSub(userID, "updated", 1000+i, "02-2024", nil)
+			s.ID = ids[i%4]
+			_, errs[i] = r.UpdateSubscription(ctx, s)
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, _ = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2024", To: "12-2024"})
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	summary, err := r.SumSubscriptions(ctx, models.SubscriptionSumRequest{UserID: &userID, From: "01-2024", To: "01-2024"})
+	require.NoError(t, err)
+	expected := 0
+	for i := 4; i < workers; i++ {
+		expected += 100 + i
+	}
+	assert.Equal(t, expected, summary.Total)
+}
+
+func testCanceledContext(t *testing.T, r Repository) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := r.CreateSubscription(ctx, newSub(uuid.NewString(), "netflix", 100, "01-2024", nil))
+	assert.True(t, errors.Is(err, context.Canceled), "got %v", err)
+
+	_, err = r.ListSubscriptions(ctx, models.SubscriptionListRequest{})
+	assert.True(t, errors.Is(err, context.Canceled), "got %v", err)
+
+	_, err = r.SumSubscriptions(ctx, models.SubscriptionSumRequest{From: "01-2024", To: "12-2024"})
+	assert.True(t, errors.Is(err, context.Canceled), "got %v", err)
+}
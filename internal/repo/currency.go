@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// isCurrencyCode reports whether code looks like an ISO 4217 code.
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeCurrency defaults the currency to BaseCurrency and rejects codes
+// that are not ISO 4217.
+func normalizeCurrency(s *models.Subscription) error {
+	if s.Currency == "" {
+		s.Currency = models.BaseCurrency
+	}
+	if !isCurrencyCode(s.Currency) {
+		return fmt.Errorf("%w: currency %q is not an ISO 4217 code", ErrInvalidInput, s.Currency)
+	}
+	return nil
+}
+
+// parseExchangeRate checks a rate before it is stored and returns its month.
+func parseExchangeRate(rate models.ExchangeRate) (time.Time, error) {
+	if !isCurrencyCode(rate.Currency) {
+		return time.Time{}, fmt.Errorf("%w: currency %q is not an ISO 4217 code", ErrInvalidInput, rate.Currency)
+	}
+	if rate.Currency == models.BaseCurrency {
+		return time.Time{}, fmt.Errorf("%w: the rate of %s is always 1", ErrInvalidInput, models.BaseCurrency)
+	}
+	if !(rate.Rate > 0) || math.IsInf(rate.Rate, 0) {
+		return time.Time{}, fmt.Errorf("%w: rate must be positive", ErrInvalidInput)
+	}
+	return parseMonth(rate.Month)
+}
+
+type monthRate struct {
+	month int
+	rate  float64
+}
+
+// rateTable holds the exchange rates of every currency ordered by month.
+type rateTable map[string][]monthRate
+
+func newRateTable(rates []models.ExchangeRate) (rateTable, error) {
+	t := make(rateTable)
+	for _, r := range rates {
+		month, err := parseMonth(r.Month)
+		if err != nil {
+			return nil, err
+		}
+		t[r.Currency] = append(t[r.Currency], monthRate{month: monthIndex(month), rate: r.Rate})
+	}
+	for _, rates := range t {
+		sort.Slice(rates, func(i, j int) bool { return rates[i].month < rates[j].month })
+	}
+	return t, nil
+}
+
+// rate returns the latest rate of currency set on or before month.
+func (t rateTable) rate(currency string, month int) (float64, error) {
+	if currency == models.BaseCurrency {
+		return 1, nil
+	}
+	rates := t[currency]
+	i := sort.Search(len(rates), func(i int) bool { return rates[i].month > month })
+	if i == 0 {
+		return 0, fmt.Errorf("%w: %s in %s", ErrNoRate, currency, formatMonthIndex(month))
+	}
+	return rates[i-1].rate, nil
+}
+
+// converter turns amounts into the target currency at the rates effective in
+// the month they are charged for. A nil converter leaves amounts as they are.
+type converter struct {
+	target string
+	rates  rateTable
+}
+
+// newConverter builds a converter into target, or returns nil when no
+// conversion was requested.
+func newConverter(target *string, rates []models.ExchangeRate) (*converter, error) {
+	if target == nil {
+		return nil, nil
+	}
+	if !isCurrencyCode(*target) {
+		return nil, fmt.Errorf("%w: currency %q is not an ISO 4217 code", ErrInvalidInput, *target)
+	}
+	table, err := newRateTable(rates)
+	if err != nil {
+		return nil, err
+	}
+	return &converter{target: *target, rates: table}, nil
+}
+
+func (c *converter) convert(amount int, currency string, month int) (int, error) {
+	if c == nil || currency == c.target {
+		return amount, nil
+	}
+	from, err := c.rates.rate(currency, month)
+	if err != nil {
+		return 0, err
+	}
+	to, err := c.rates.rate(c.target, month)
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Round(float64(amount) * to / from)), nil
+}
@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// sortFields maps the public sort names to the columns used for keyset
+// pagination. Every sort is made unique by id as the tie-breaker.
+var sortFields = map[string]string{
+	"price":        "price",
+	"start_date":   "start_date",
+	"service_name": "service_name",
+}
+
+const defaultSort = "start_date"
+
+type listSort struct {
+	field string
+	desc  bool
+}
+
+func parseSort(s string) (listSort, error) {
+	if s == "" {
+		s = defaultSort
+	}
+	var ls listSort
+	if strings.HasPrefix(s, "-") {
+		ls.desc = true
+		s = s[1:]
+	}
+	if _, ok := sortFields[s]; !ok {
+		return ls, ErrInvalidSort
+	}
+	ls.field = s
+	return ls, nil
+}
+
+func (s listSort) String() string {
+	if s.desc {
+		return "-" + s.field
+	}
+	return s.field
+}
+
+// listCursor points just past the last item of a page. It records the sort it
+// was issued for so it cannot be replayed against a different ordering.
+type listCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(c listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, sort listSort) (listCursor, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	if c.Sort != sort.String() || c.ID == "" {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// cursorValue extracts the sort key of s in the form stored in a cursor.
+func cursorValue(field string, s models.Subscription, start time.Time) string {
+	switch field {
+	case "price":
+		return strconv.Itoa(s.Price)
+	case "start_date":
+		return start.Format(dateLayout)
+	default:
+		return s.ServiceName
+	}
+}
+
+// cursorArg converts a cursor value back into a query argument for field.
+func cursorArg(field, value string) (interface{}, error) {
+	switch field {
+	case "price":
+		price, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return price, nil
+	case "start_date":
+		start, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return start, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,31 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type includeDeletedKey struct{}
+
+// WithDeleted returns a context under which reads of subscriptions, such as
+// GetSubscriptionByID, ListSubscriptions and SumSubscriptions, also see the
+// deleted ones that have not been purged yet.
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDeletedKey{}, true)
+}
+
+func includeDeleted(ctx context.Context) bool {
+	include, _ := ctx.Value(includeDeletedKey{}).(bool)
+	return include
+}
+
+// deletionTime is the time a subscription deleted now is marked with.
+func deletionTime() time.Time {
+	// PostgreSQL keeps microseconds.
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func errNotDeleted(id string) error {
+	return fmt.Errorf("%w: subscription %s is not deleted", ErrConflict, id)
+}
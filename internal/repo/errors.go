@@ -0,0 +1,24 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Domain errors returned by every Repository implementation. Callers should
+// match them with errors.Is, since they are usually wrapped with details.
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrInvalidDate     = errors.New("invalid date")
+	ErrInvalidInput    = errors.New("invalid input")
+	ErrConstraint      = errors.New("constraint violation")
+	ErrConflict        = errors.New("conflict")
+	ErrInvalidSort     = errors.New("invalid sort field")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrNoRate          = errors.New("no exchange rate")
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+func invalidDate(value string) error {
+	return fmt.Errorf("%w: %q", ErrInvalidDate, value)
+}
@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// exportBatch is how many subscriptions EachSubscription reads per query.
+const exportBatch = 500
+
+type batchTimeoutKey struct{}
+
+// WithBatchTimeout returns a context under which EachSubscription gives each
+// batch it reads d to complete, rather than bounding the whole iteration.
+// Zero leaves the batches unbounded.
+func WithBatchTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, batchTimeoutKey{}, d)
+}
+
+// eachSubscription implements EachSubscription on top of list, following
+// the cursors of its pages so that only one page is held at a time.
+func eachSubscription(ctx context.Context, filter models.SubscriptionListRequest,
+	list func(ctx context.Context, filter models.SubscriptionListRequest, limit int) (models.SubscriptionPage, error),
+	fn func(models.Subscription) error) error {
+	filter.Cursor = ""
+	for {
+		page, err := listBatch(ctx, filter, list)
+		if err != nil {
+			return err
+		}
+		for _, s := range page.Items {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == nil {
+			return nil
+		}
+		filter.Cursor = *page.NextCursor
+	}
+}
+
+func listBatch(ctx context.Context, filter models.SubscriptionListRequest,
+	list func(ctx context.Context, filter models.SubscriptionListRequest, limit int) (models.SubscriptionPage, error),
+) (models.SubscriptionPage, error) {
+	if d, _ := ctx.Value(batchTimeoutKey{}).(time.Duration); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	return list(ctx, filter, exportBatch)
+}
@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEachSubscription_BatchTimeout(t *testing.T) {
+	const timeout = time.Hour
+	for _, tt := range []struct {
+		name     string
+		ctx      context.Context
+		deadline bool
+	}{
+		{"unbounded", context.Background(), false},
+		{"per batch", WithBatchTimeout(context.Background(), timeout), true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// The batch before the first one is over already.
+			prev, cancel := context.WithCancel(context.Background())
+			cancel()
+			calls := 0
+			list := func(ctx context.Context, filter models.SubscriptionListRequest, limit int) (models.SubscriptionPage, error) {
+				calls++
+				assert.Equal(t, exportBatch, limit)
+				deadline, ok := ctx.Deadline()
+				assert.Equal(t, tt.deadline, ok)
+				if ok {
+					// Each batch gets the whole timeout, and the previous
+					// one has released its own.
+					assert.WithinDuration(t, time.Now().Add(timeout), deadline, time.Minute)
+					assert.ErrorIs(t, prev.Err(), context.Canceled)
+				}
+				assert.NoError(t, ctx.Err())
+				prev = ctx
+				page := models.SubscriptionPage{Items: []models.Subscription{{ID: filter.Cursor}}}
+				if calls < 3 {
+					page.NextCursor = ptr("page")
+				}
+				return page, nil
+			}
+
+			items := 0
+			require.NoError(t, eachSubscription(tt.ctx, models.SubscriptionListRequest{}, list, func(models.Subscription) error {
+				items++
+				return nil
+			}))
+			assert.Equal(t, 3, calls)
+			assert.Equal(t, 3, items)
+		})
+	}
+}
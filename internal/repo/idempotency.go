@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// IdempotencyKey lets a client retry CreateSubscription without creating the
+// subscription twice.
+type IdempotencyKey struct {
+	// Key is chosen by the client and names one request.
+	Key string
+	// Hash identifies the content of the request, so that the key cannot be
+	// reused for a different one.
+	Hash string
+	// ExpiresAt is when the key is forgotten and may name a new request.
+	ExpiresAt time.Time
+}
+
+type idempotencyKeyKey struct{}
+
+// WithIdempotencyKey returns a context under which CreateSubscription stores
+// key along with the subscription it creates. A later call under the same
+// key returns that subscription as it was created instead of creating
+// another one, or fails with ErrConflict if the hash differs. Expired keys
+// are ignored and removed by PurgeIdempotencyKeys.
+func WithIdempotencyKey(ctx context.Context, key IdempotencyKey) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+func idempotencyKey(ctx context.Context) (IdempotencyKey, bool) {
+	key, ok := ctx.Value(idempotencyKeyKey{}).(IdempotencyKey)
+	return key, ok
+}
+
+// replayIdempotent returns the subscription stored under key if the request
+// hashed the same, and ErrConflict otherwise.
+func replayIdempotent(key IdempotencyKey, hash string, response []byte) (models.Subscription, error) {
+	var s models.Subscription
+	if hash != key.Hash {
+		return s, fmt.Errorf("%w: idempotency key %q was used for a different request", ErrConflict, key.Key)
+	}
+	if err := json.Unmarshal(response, &s); err != nil {
+		return s, err
+	}
+	// The version is not part of the JSON; the response was that of the
+	// creation.
+	s.Version = 1
+	return s, nil
+}
@@ -0,0 +1,1016 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/google/uuid"
+)
+
+// MemoryRepo keeps subscriptions in process memory. It mirrors the behavior
+// of PostgresRepo, including its errors, and is meant for local development
+// and tests. Service names are ordered bytewise rather than by a database
+// collation.
+type MemoryRepo struct {
+	mu    sync.RWMutex
+	subs  map[string]memoryRecord
+	rates map[rateKey]float64
+	// services holds the catalog and aliases the service each alias key
+	// belongs to, like the service_aliases table.
+	services map[string]serviceRecord
+	aliases  map[string]string
+	// audit is the audit log in the order of its IDs, which start at 1.
+	audit []models.AuditEntry
+	// idempotency holds the idempotency keys like the idempotency_keys table.
+	idempotency map[string]idempotencyRecord
+}
+
+// idempotencyRecord is a row of the idempotency_keys table.
+type idempotencyRecord struct {
+	hash      string
+	response  []byte
+	expiresAt time.Time
+}
+
+// serviceRecord stores a catalog entry together with its alias keys.
+type serviceRecord struct {
+	svc  models.Service
+	keys []string
+}
+
+// rateKey identifies an exchange rate the way the exchange_rates primary key
+// does.
+type rateKey struct {
+	currency string
+	month    time.Time
+}
+
+// memoryRecord stores a subscription together with its parsed dates, the
+// same way the database keeps them as DATE columns.
+type memoryRecord struct {
+	sub      models.Subscription
+	start    time.Time
+	end      *time.Time
+	trialEnd *time.Time
+	// deletedAt is set while the subscription is soft-deleted.
+	deletedAt *time.Time
+	// prices and pauses are replaced, never modified in place, so readers may
+	// keep them.
+	prices []priceChange
+	pauses []pause
+}
+
+func NewMemoryRepo() *MemoryRepo {
+	return &MemoryRepo{
+		subs:     make(map[string]memoryRecord),
+		rates:    make(map[rateKey]float64),
+		services: make(map[string]serviceRecord),
+		aliases:  make(map[string]string),
+
+		idempotency: make(map[string]idempotencyRecord),
+	}
+}
+
+// InTransaction runs fn on a copy of the repository and adopts its state if
+// fn succeeds. Other calls wait until fn returns.
+func (r *MemoryRepo) InTransaction(ctx context.Context, fn func(tx Repository) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Records are replaced rather than modified in place, so copying the
+	// maps is enough. Clipping the audit log makes the copy's appends
+	// reallocate instead of writing into the shared array.
+	tx := &MemoryRepo{
+		subs:        maps.Clone(r.subs),
+		rates:       maps.Clone(r.rates),
+		services:    maps.Clone(r.services),
+		aliases:     maps.Clone(r.aliases),
+		audit:       slices.Clip(r.audit),
+		idempotency: maps.Clone(r.idempotency),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	r.subs, r.rates, r.services, r.aliases = tx.subs, tx.rates, tx.services, tx.aliases
+	r.audit, r.idempotency = tx.audit, tx.idempotency
+	return nil
+}
+
+// newMemoryRecord applies the checks the subscriptions table enforces.
+func newMemoryRecord(s models.Subscription) (memoryRecord, error) {
+	start, end, err := normalizeDates(&s)
+	if err != nil {
+		return memoryRecord{}, err
+	}
+	if err := checkUserID(s.UserID); err != nil {
+		return memoryRecord{}, err
+	}
+	if err := normalizeCurrency(&s); err != nil {
+		return memoryRecord{}, err
+	}
+	if err := normalizeBilling(&s); err != nil {
+		return memoryRecord{}, err
+	}
+	trialEnd, err := normalizeTrial(&s, start)
+	if err != nil {
+		return memoryRecord{}, err
+	}
+	if s.Price <= 0 {
+		return memoryRecord{}, fmt.Errorf("%w: price must be positive", ErrConstraint)
+	}
+	s.Tags = normalizeTags(s.Tags)
+	s.Pauses = nil
+	s.DeletedAt = nil
+	return memoryRecord{sub: s, start: start, end: end, trialEnd: trialEnd}, nil
+}
+
+func (r *MemoryRepo) CreateSubscription(ctx context.Context, s models.Subscription) (models.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return s, err
+	}
+	s.ID = uuid.New().String()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, idempotent := idempotencyKey(ctx)
+	if idempotent {
+		stored, ok := r.idempotency[key.Key]
+		if ok && stored.expiresAt.After(time.Now()) {
+			return replayIdempotent(key, stored.hash, stored.response)
+		}
+	}
+	if err := r.resolveService(&s); err != nil {
+		return s, err
+	}
+	rec, err := newMemoryRecord(s)
+	if err != nil {
+		return s, err
+	}
+	rec.sub.Version = 1
+	var response []byte
+	if idempotent {
+		if response, err = json.Marshal(rec.sub); err != nil {
+			return s, err
+		}
+	}
+	if err := r.appendAudit(ctx, s.ID, models.AuditCreate, nil, rec.sub); err != nil {
+		return s, err
+	}
+	r.subs[s.ID] = rec
+	if idempotent {
+		r.idempotency[key.Key] = idempotencyRecord{hash: key.Hash, response: response, expiresAt: key.ExpiresAt}
+	}
+	return rec.sub, nil
+}
+
+// appendAudit adds an entry for action on subscription id to the audit log.
+// The caller must hold r.mu.
+func (r *MemoryRepo) appendAudit(ctx context.Context, id, action string, before, after interface{}) error {
+	e, err := newAuditEntry(ctx, id, action, before, after)
+	if err != nil {
+		return err
+	}
+	e.ID = int64(len(r.audit) + 1)
+	r.audit = append(r.audit, e)
+	return nil
+}
+
+// live returns the record of subscription id unless it is missing or
+// deleted. The caller must hold r.mu.
+func (r *MemoryRepo) live(id string) (memoryRecord, error) {
+	rec, ok := r.subs[id]
+	if !ok || rec.deletedAt != nil {
+		return rec, ErrNotFound
+	}
+	return rec, nil
+}
+
+// visible reports whether reads under ctx see the record.
+func (rec memoryRecord) visible(ctx context.Context) bool {
+	return rec.deletedAt == nil || includeDeleted(ctx)
+}
+
+// resolveService links s to its catalog entry: the one given by service_id,
+// or else the one whose name or an alias matches service_name. The caller
+// must hold r.mu.
+func (r *MemoryRepo) resolveService(s *models.Subscription) error {
+	id, ok := r.aliases[aliasKey(s.ServiceName)]
+	if s.ServiceID != nil {
+		if err := checkServiceID(*s.ServiceID); err != nil {
+			return err
+		}
+		id, ok = *s.ServiceID, true
+	}
+	if !ok {
+		linkService(s, nil)
+		return nil
+	}
+	rec, ok := r.services[id]
+	if !ok {
+		return errUnknownService(id)
+	}
+	linkService(s, &rec.svc)
+	return nil
+}
+
+func (r *MemoryRepo) ListSubscriptions(ctx context.Context, filter models.SubscriptionListRequest) (models.SubscriptionPage, error) {
+	limit := filter.Limit
+	if limit <= 0 || limit > models.MaxListLimit {
+		limit = models.DefaultListLimit
+	}
+	return r.listSubscriptions(ctx, filter, limit)
+}
+
+func (r *MemoryRepo) EachSubscription(ctx context.Context, filter models.SubscriptionListRequest, fn func(models.Subscription) error) error {
+	return eachSubscription(ctx, filter, r.listSubscriptions, fn)
+}
+
+// listSubscriptions returns the page of at most limit subscriptions matching
+// filter.
+func (r *MemoryRepo) listSubscriptions(ctx context.Context, filter models.SubscriptionListRequest, limit int) (models.SubscriptionPage, error) {
+	if err := ctx.Err(); err != nil {
+		return models.SubscriptionPage{}, err
+	}
+	order, err := parseSort(filter.Sort)
+	if err != nil {
+		return models.SubscriptionPage{}, err
+	}
+	if filter.ServiceID != nil {
+		if err := checkServiceID(*filter.ServiceID); err != nil {
+			return models.SubscriptionPage{}, err
+		}
+	}
+	filter.Category, filter.Tags = foldLabelFilter(filter.Category, filter.Tags)
+
+	var activeOn *dateRange
+	if filter.ActiveOn != nil {
+		on, err := parseRange(*filter.ActiveOn)
+		if err != nil {
+			return models.SubscriptionPage{}, err
+		}
+		activeOn = &on
+	}
+	trialEnds := trialWindow(filter.TrialEndsWithin)
+
+	var after *memoryRecord
+	if filter.Cursor != "" {
+		cur, err := decodeCursor(filter.Cursor, order)
+		if err != nil {
+			return models.SubscriptionPage{}, err
+		}
+		value, err := cursorArg(order.field, cur.Value)
+		if err != nil {
+			return models.SubscriptionPage{}, err
+		}
+		after = cursorRecord(order.field, value, cur.ID)
+	}
+
+	r.mu.RLock()
+	var matched []memoryRecord
+	for _, rec := range r.subs {
+		if rec.visible(ctx) && matchesList(rec, filter, activeOn, trialEnds) {
+			matched = append(matched, rec)
+		}
+	}
+	r.mu.RUnlock()
+
+	less := func(a, b memoryRecord) bool {
+		c := compareRecords(order.field, a, b)
+		if c == 0 {
+			c = strings.Compare(a.sub.ID, b.sub.ID)
+		}
+		if order.desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.Slice(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	page := models.SubscriptionPage{Items: []models.Subscription{}, Limit: limit}
+	var last listCursor
+	for _, rec := range matched {
+		if after != nil && !less(*after, rec) {
+			continue
+		}
+		if len(page.Items) == limit {
+			page.HasMore = true
+			break
+		}
+		page.Items = append(page.Items, rec.sub)
+		last = listCursor{Sort: order.String(), Value: cursorValue(order.field, rec.sub, rec.start), ID: rec.sub.ID}
+	}
+
+	if page.HasMore {
+		next := encodeCursor(last)
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
+func matchesList(rec memoryRecord, filter models.SubscriptionListRequest, activeOn, trialEnds *dateRange) bool {
+	s := rec.sub
+	switch {
+	case filter.UserID != nil && s.UserID != *filter.UserID:
+		return false
+	case filter.ServiceID != nil && (s.ServiceID == nil || *s.ServiceID != *filter.ServiceID):
+		return false
+	case filter.ServiceName != nil && !containsFold(s.ServiceName, *filter.ServiceName):
+		return false
+	case filter.Category != nil && s.Category != *filter.Category:
+		return false
+	case !hasTags(s.Tags, filter.Tags):
+		return false
+	case filter.MinPrice != nil && s.Price < *filter.MinPrice:
+		return false
+	case filter.MaxPrice != nil && s.Price > *filter.MaxPrice:
+		return false
+	case activeOn != nil && !rec.activeWithin(*activeOn):
+		return false
+	case filter.HasEndDate != nil && (rec.end != nil) != *filter.HasEndDate:
+		return false
+	case trialEnds != nil && (rec.trialEnd == nil || rec.trialEnd.Before(trialEnds.from) || rec.trialEnd.After(trialEnds.to)):
+		return false
+	}
+	return true
+}
+
+// overlaps reports whether the record is active on any day of r.
+func (rec memoryRecord) overlaps(r dateRange) bool {
+	return !rec.start.After(r.to) && (rec.end == nil || !rec.end.Before(r.from))
+}
+
+// activeWithin reports whether the record is active and not paused on any day
+// of r.
+func (rec memoryRecord) activeWithin(r dateRange) bool {
+	if !rec.overlaps(r) {
+		return false
+	}
+	to := r.to
+	if rec.end != nil {
+		to = earliest(to, *rec.end)
+	}
+	return !pausedThroughout(rec.pauses, latest(rec.start, r.from), to)
+}
+
+// containsFold is the in-memory equivalent of ILIKE '%substr%'.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// cursorRecord builds a stand-in record holding only the cursor's sort key.
+func cursorRecord(field string, value interface{}, id string) *memoryRecord {
+	rec := &memoryRecord{sub: models.Subscription{ID: id}}
+	switch field {
+	case "price":
+		rec.sub.Price = value.(int)
+	case "start_date":
+		rec.start = value.(time.Time)
+	default:
+		rec.sub.ServiceName = value.(string)
+	}
+	return rec
+}
+
+func compareRecords(field string, a, b memoryRecord) int {
+	switch field {
+	case "price":
+		return a.sub.Price - b.sub.Price
+	case "start_date":
+		return a.start.Compare(b.start)
+	default:
+		return strings.Compare(a.sub.ServiceName, b.sub.ServiceName)
+	}
+}
+
+func (r *MemoryRepo) SumSubscriptions(ctx context.Context, filter models.SubscriptionSumRequest) (models.SubscriptionSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return models.SubscriptionSummary{}, err
+	}
+	period, err := parsePeriod(filter.From, filter.To)
+	if err != nil {
+		return models.SubscriptionSummary{}, err
+	}
+	if filter.ServiceID != nil {
+		if err := checkServiceID(*filter.ServiceID); err != nil {
+			return models.SubscriptionSummary{}, err
+		}
+	}
+	filter.Category, filter.Tags = foldLabelFilter(filter.Category, filter.Tags)
+
+	var conv *converter
+	if filter.Currency != nil {
+		rates, err := r.ListExchangeRates(ctx)
+		if err != nil {
+			return models.SubscriptionSummary{}, err
+		}
+		if conv, err = newConverter(filter.Currency, rates); err != nil {
+			return models.SubscriptionSummary{}, err
+		}
+	}
+
+	r.mu.RLock()
+	var entries []costEntry
+	for _, rec := range r.subs {
+		s := rec.sub
+		if !rec.visible(ctx) || !rec.overlaps(period) {
+			continue
+		}
+		if filter.UserID != nil && s.UserID != *filter.UserID {
+			continue
+		}
+		if filter.ServiceID != nil && (s.ServiceID == nil || *s.ServiceID != *filter.ServiceID) {
+			continue
+		}
+		if filter.ServiceName != nil && !containsFold(s.ServiceName, *filter.ServiceName) {
+			continue
+		}
+		if filter.Category != nil && s.Category != *filter.Category || !hasTags(s.Tags, filter.Tags) {
+			continue
+		}
+		e := costEntry{
+			serviceName: s.ServiceName,
+			userID:      s.UserID,
+			category:    s.Category,
+			tags:        s.Tags,
+			price:       s.Price,
+			currency:    s.Currency,
+			rate:        billingRate(s.BillingPeriod, s.BillingMonths),
+			start:       rec.start,
+			end:         rec.end,
+			prices:      rec.prices,
+			pauses:      rec.pauses,
+		}
+		e.setTrial(rec.trialEnd, s.IntroPrice, s.IntroMonths)
+		entries = append(entries, e)
+	}
+	r.mu.RUnlock()
+
+	return summarize(entries, period, filter.GroupBy, conv)
+}
+
+func (r *MemoryRepo) GetSubscriptionByID(ctx context.Context, id string) (models.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Subscription{}, err
+	}
+	if err := checkID(id); err != nil {
+		return models.Subscription{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rec, ok := r.subs[id]
+	if !ok || !rec.visible(ctx) {
+		return models.Subscription{}, ErrNotFound
+	}
+	return rec.sub, nil
+}
+
+func (r *MemoryRepo) UpdateSubscription(ctx context.Context, s models.Subscription) (models.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return s, err
+	}
+	if err := checkID(s.ID); err != nil {
+		return s, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.resolveService(&s); err != nil {
+		return s, err
+	}
+	rec, err := newMemoryRecord(s)
+	if err != nil {
+		return s, err
+	}
+	old, err := r.live(s.ID)
+	if err != nil {
+		return s, err
+	}
+	if err := checkVersion(ctx, old.sub.Version); err != nil {
+		return s, err
+	}
+	if err := checkPriceChanges(rec.start, rec.end, old.prices); err != nil {
+		return s, err
+	}
+	if err := checkPauses(old.pauses, rec.start, rec.end); err != nil {
+		return s, err
+	}
+	rec.prices, rec.pauses = old.prices, old.pauses
+	rec.sub.Pauses = old.sub.Pauses
+	rec.sub.Version = old.sub.Version + 1
+	if err := r.appendAudit(ctx, s.ID, models.AuditUpdate, old.sub, rec.sub); err != nil {
+		return s, err
+	}
+	r.subs[s.ID] = rec
+	return rec.sub, nil
+}
+
+func (r *MemoryRepo) DeleteSubscription(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkID(id); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, err := r.live(id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(ctx, rec.sub.Version); err != nil {
+		return err
+	}
+	if err := r.appendAudit(ctx, id, models.AuditDelete, rec.sub, nil); err != nil {
+		return err
+	}
+	deletedAt := deletionTime()
+	rec.deletedAt = &deletedAt
+	rec.sub.DeletedAt = &deletedAt
+	rec.sub.Version++
+	r.subs[id] = rec
+	return nil
+}
+
+func (r *MemoryRepo) RestoreSubscription(ctx context.Context, id string) (models.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Subscription{}, err
+	}
+	if err := checkID(id); err != nil {
+		return models.Subscription{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.subs[id]
+	if !ok {
+		return models.Subscription{}, ErrNotFound
+	}
+	if rec.deletedAt == nil {
+		return models.Subscription{}, errNotDeleted(id)
+	}
+	rec.deletedAt = nil
+	rec.sub.DeletedAt = nil
+	rec.sub.Version++
+	if err := r.appendAudit(ctx, id, models.AuditRestore, nil, rec.sub); err != nil {
+		return models.Subscription{}, err
+	}
+	r.subs[id] = rec
+	return rec.sub, nil
+}
+
+func (r *MemoryRepo) PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for id, rec := range r.subs {
+		if rec.deletedAt != nil && rec.deletedAt.Before(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	// Log the purges in a stable order, as the database does by id.
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := r.appendAudit(ctx, id, models.AuditPurge, nil, nil); err != nil {
+			return 0, err
+		}
+		delete(r.subs, id)
+	}
+	return len(ids), nil
+}
+
+func (r *MemoryRepo) PurgeIdempotencyKeys(ctx context.Context, cutoff time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var purged int
+	for key, rec := range r.idempotency {
+		if !rec.expiresAt.After(cutoff) {
+			delete(r.idempotency, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (r *MemoryRepo) AddPriceChange(ctx context.Context, id string, p models.PriceChange) (models.PriceChange, error) {
+	if err := ctx.Err(); err != nil {
+		return p, err
+	}
+	if err := checkID(id); err != nil {
+		return p, err
+	}
+	from, err := normalizePriceChange(&p)
+	if err != nil {
+		return p, err
+	}
+	if p.Price <= 0 {
+		return p, fmt.Errorf("%w: price must be positive", ErrConstraint)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, err := r.live(id)
+	if err != nil {
+		return p, err
+	}
+	if err := checkPriceChange(rec.start, rec.end, from); err != nil {
+		return p, err
+	}
+
+	for _, c := range rec.prices {
+		if c.from.Equal(from) {
+			return p, fmt.Errorf("%w: price change on %s already exists", ErrConflict, p.EffectiveFrom)
+		}
+	}
+
+	if err := r.appendAudit(ctx, id, models.AuditPriceChange, nil, p); err != nil {
+		return p, err
+	}
+	prices := append(append([]priceChange(nil), rec.prices...), priceChange{from: from, price: p.Price})
+	sort.Slice(prices, func(i, j int) bool { return prices[i].from.Before(prices[j].from) })
+	rec.prices = prices
+	rec.sub.Version++
+	r.subs[id] = rec
+	return p, nil
+}
+
+func (r *MemoryRepo) ListPriceChanges(ctx context.Context, id string) ([]models.PriceChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rec, ok := r.subs[id]
+	if !ok || !rec.visible(ctx) {
+		return nil, ErrNotFound
+	}
+	changes := make([]models.PriceChange, 0, len(rec.prices))
+	for _, c := range rec.prices {
+		changes = append(changes, c.model())
+	}
+	return changes, nil
+}
+
+func (r *MemoryRepo) PauseSubscription(ctx context.Context, id string, p models.Pause) (models.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Subscription{}, err
+	}
+	if err := checkID(id); err != nil {
+		return models.Subscription{}, err
+	}
+	added, err := normalizePause(&p)
+	if err != nil {
+		return models.Subscription{}, err
+	}
+
+	return r.changePauses(ctx, id, models.AuditPause, func(rec memoryRecord) ([]pause, error) {
+		return addPause(rec.pauses, rec.start, rec.end, added)
+	})
+}
+
+func (r *MemoryRepo) ResumeSubscription(ctx context.Context, id, on string) (models.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Subscription{}, err
+	}
+	if err := checkID(id); err != nil {
+		return models.Subscription{}, err
+	}
+	day, err := parseRange(on)
+	if err != nil {
+		return models.Subscription{}, err
+	}
+
+	return r.changePauses(ctx, id, models.AuditResume, func(rec memoryRecord) ([]pause, error) {
+		return resumePauses(rec.pauses, day.from)
+	})
+}
+
+// changePauses replaces the pauses of subscription id with those computed by
+// fn from the stored record, recording the change as action.
+func (r *MemoryRepo) changePauses(ctx context.Context, id, action string, fn func(rec memoryRecord) ([]pause, error)) (models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, err := r.live(id)
+	if err != nil {
+		return models.Subscription{}, err
+	}
+	pauses, err := fn(rec)
+	if err != nil {
+		return models.Subscription{}, err
+	}
+	old := rec.sub
+	rec.pauses = pauses
+	rec.sub.Pauses = pauseModels(pauses)
+	rec.sub.Version++
+	if err := r.appendAudit(ctx, id, action, old, rec.sub); err != nil {
+		return models.Subscription{}, err
+	}
+	r.subs[id] = rec
+	return rec.sub, nil
+}
+
+func (r *MemoryRepo) CreateService(ctx context.Context, svc models.Service) (models.Service, error) {
+	if err := ctx.Err(); err != nil {
+		return svc, err
+	}
+	svc.ID = uuid.New().String()
+	keys, err := normalizeService(&svc)
+	if err != nil {
+		return svc, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkAliases(svc.ID, keys); err != nil {
+		return svc, err
+	}
+	r.setService(serviceRecord{svc: svc, keys: keys})
+	return svc, nil
+}
+
+func (r *MemoryRepo) ListServices(ctx context.Context) ([]models.Service, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	services := make([]models.Service, 0, len(r.services))
+	for _, rec := range r.services {
+		services = append(services, rec.svc)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Name != services[j].Name {
+			return services[i].Name < services[j].Name
+		}
+		return services[i].ID < services[j].ID
+	})
+	return services, nil
+}
+
+func (r *MemoryRepo) GetServiceByID(ctx context.Context, id string) (models.Service, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Service{}, err
+	}
+	if err := checkID(id); err != nil {
+		return models.Service{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rec, ok := r.services[id]
+	if !ok {
+		return models.Service{}, ErrNotFound
+	}
+	return rec.svc, nil
+}
+
+func (r *MemoryRepo) UpdateService(ctx context.Context, svc models.Service) (models.Service, error) {
+	if err := ctx.Err(); err != nil {
+		return svc, err
+	}
+	if err := checkID(svc.ID); err != nil {
+		return svc, err
+	}
+	keys, err := normalizeService(&svc)
+	if err != nil {
+		return svc, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.services[svc.ID]
+	if !ok {
+		return svc, ErrNotFound
+	}
+	if err := r.checkAliases(svc.ID, keys); err != nil {
+		return svc, err
+	}
+	r.deleteService(old)
+	r.setService(serviceRecord{svc: svc, keys: keys})
+
+	for _, id := range r.linked(svc.ID) {
+		// Deleted subscriptions cannot change; they keep the old name.
+		rec := r.subs[id]
+		if rec.sub.ServiceName == svc.Name || rec.deletedAt != nil {
+			continue
+		}
+		before := rec.sub
+		rec.sub.ServiceName = svc.Name
+		rec.sub.Version++
+		if err := r.appendAudit(ctx, id, models.AuditUpdate, before, rec.sub); err != nil {
+			return svc, err
+		}
+		r.subs[id] = rec
+	}
+	return svc, nil
+}
+
+func (r *MemoryRepo) DeleteService(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkID(id); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.services[id]
+	if !ok {
+		return ErrNotFound
+	}
+	r.deleteService(rec)
+
+	// Deleted subscriptions lose their service_id as well, as in the SQL
+	// repositories, where they cannot refer to a missing entry.
+	for _, subID := range r.linked(id) {
+		sub := r.subs[subID]
+		before := sub.sub
+		sub.sub.ServiceID = nil
+		sub.sub.Version++
+		if err := r.appendAudit(ctx, subID, models.AuditUpdate, before, sub.sub); err != nil {
+			return err
+		}
+		r.subs[subID] = sub
+	}
+	return nil
+}
+
+// linked returns the IDs of the subscriptions linked to catalog entry id in
+// order, like the SQL repositories visit them. The caller must hold r.mu.
+func (r *MemoryRepo) linked(id string) []string {
+	var ids []string
+	for subID, rec := range r.subs {
+		if rec.sub.ServiceID != nil && *rec.sub.ServiceID == id {
+			ids = append(ids, subID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// checkAliases fails the way the service_aliases primary key does when one
+// of keys belongs to a service other than id. The caller must hold r.mu.
+func (r *MemoryRepo) checkAliases(id string, keys []string) error {
+	for _, key := range keys {
+		if owner, ok := r.aliases[key]; ok && owner != id {
+			return fmt.Errorf("%w: service name or alias %q is already taken", ErrConflict, key)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepo) setService(rec serviceRecord) {
+	r.services[rec.svc.ID] = rec
+	for _, key := range rec.keys {
+		r.aliases[key] = rec.svc.ID
+	}
+}
+
+func (r *MemoryRepo) deleteService(rec serviceRecord) {
+	delete(r.services, rec.svc.ID)
+	for _, key := range rec.keys {
+		delete(r.aliases, key)
+	}
+}
+
+func (r *MemoryRepo) ListSubscriptionHistory(ctx context.Context, id string) ([]models.AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var history []models.AuditEntry
+	for _, e := range r.audit {
+		if e.SubscriptionID == id {
+			history = append(history, e)
+		}
+	}
+	if history != nil {
+		return history, nil
+	}
+	if _, ok := r.subs[id]; !ok {
+		return nil, ErrNotFound
+	}
+	return []models.AuditEntry{}, nil
+}
+
+func (r *MemoryRepo) ListAuditEntries(ctx context.Context, req models.AuditListRequest) (models.AuditPage, error) {
+	if err := ctx.Err(); err != nil {
+		return models.AuditPage{}, err
+	}
+	filter, err := parseAuditFilter(req)
+	if err != nil {
+		return models.AuditPage{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var entries []models.AuditEntry
+	for i := len(r.audit) - 1; i >= 0 && len(entries) <= filter.limit; i-- {
+		e := r.audit[i]
+		if filter.after != 0 && e.ID >= filter.after || !filter.matches(e) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return auditPage(entries, filter.limit), nil
+}
+
+func (r *MemoryRepo) ListExchangeRates(ctx context.Context) ([]models.ExchangeRate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	keys := make([]rateKey, 0, len(r.rates))
+	for k := range r.rates {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].currency != keys[j].currency {
+			return keys[i].currency < keys[j].currency
+		}
+		return keys[i].month.Before(keys[j].month)
+	})
+	rates := make([]models.ExchangeRate, 0, len(keys))
+	for _, k := range keys {
+		rates = append(rates, models.ExchangeRate{
+			Currency: k.currency,
+			Month:    k.month.Format(monthLayout),
+			Rate:     r.rates[k],
+		})
+	}
+	r.mu.RUnlock()
+	return rates, nil
+}
+
+func (r *MemoryRepo) SetExchangeRates(ctx context.Context, rates []models.ExchangeRate) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	keys := make([]rateKey, len(rates))
+	for i, rate := range rates {
+		month, err := parseExchangeRate(rate)
+		if err != nil {
+			return err
+		}
+		keys[i] = rateKey{currency: rate.Currency, month: month}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, rate := range rates {
+		r.rates[keys[i]] = rate.Rate
+	}
+	return nil
+}
+
+func (r *MemoryRepo) DeleteExchangeRate(ctx context.Context, currency, month string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m, err := parseMonth(month)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := rateKey{currency: currency, month: m}
+	if _, ok := r.rates[key]; !ok {
+		return ErrNotFound
+	}
+	delete(r.rates, key)
+	return nil
+}
@@ -0,0 +1,32 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRepo_Conformance(t *testing.T) {
+	runConformance(t, func(t *testing.T) Repository {
+		return NewMemoryRepo()
+	})
+}
+
+// TestMemoryRepo_HistoryWithoutEntries covers subscriptions stored before the
+// audit log was kept.
+func TestMemoryRepo_HistoryWithoutEntries(t *testing.T) {
+	r := NewMemoryRepo()
+	ctx := context.Background()
+	s := mustCreate(t, r, newSub(uuid.NewString(), "Netflix", 999, "01-2024", nil))
+	r.audit = nil
+
+	history, err := r.ListSubscriptionHistory(ctx, s.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []models.AuditEntry{}, history)
+	_, err = r.ListSubscriptionHistory(ctx, uuid.NewString())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
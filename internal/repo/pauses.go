@@ -0,0 +1,169 @@
+package repo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/dates"
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// pause is a span of days a subscription is not billed for. A nil to means
+// the pause lasts until the subscription is resumed.
+type pause struct {
+	from time.Time
+	to   *time.Time
+}
+
+func (p pause) model() models.Pause {
+	m := models.Pause{From: p.from.Format(dateLayout)}
+	if p.to != nil {
+		to := p.to.Format(dateLayout)
+		m.To = &to
+	}
+	return m
+}
+
+// contains reports whether day falls within the pause.
+func (p pause) contains(day time.Time) bool {
+	return !day.Before(p.from) && (p.to == nil || !day.After(*p.to))
+}
+
+func (p pause) overlaps(q pause) bool {
+	return (p.to == nil || !p.to.Before(q.from)) && (q.to == nil || !q.to.Before(p.from))
+}
+
+// touches reports whether q starts the day after p ends.
+func (p pause) touches(q pause) bool {
+	return p.to != nil && p.to.AddDate(0, 0, 1).Equal(q.from)
+}
+
+func pauseModels(pauses []pause) []models.Pause {
+	if len(pauses) == 0 {
+		return nil
+	}
+	result := make([]models.Pause, 0, len(pauses))
+	for _, p := range pauses {
+		result = append(result, p.model())
+	}
+	return result
+}
+
+// normalizePause parses the dates of p and rewrites them as ISO dates. A
+// month given as from starts on its first day, one given as to ends on its
+// last day.
+func normalizePause(p *models.Pause) (pause, error) {
+	from, err := dates.ParseStart(p.From)
+	if err != nil {
+		return pause{}, invalidDate(p.From)
+	}
+	p.From = from.Format(dateLayout)
+	if p.To == nil {
+		return pause{from: from}, nil
+	}
+	to, err := dates.ParseEnd(*p.To)
+	if err != nil {
+		return pause{}, invalidDate(*p.To)
+	}
+	if to.Before(from) {
+		return pause{}, fmt.Errorf("%w: pause must not end before it starts", ErrInvalidInput)
+	}
+	formatted := to.Format(dateLayout)
+	p.To = &formatted
+	return pause{from: from, to: &to}, nil
+}
+
+// addPause adds p to the ordered pauses of a subscription running from start
+// to end and returns the new list. Pauses must lie within the subscription
+// and must not overlap. A pause that starts right after another one ends is
+// merged with it, so every day between two pauses is billed.
+func addPause(pauses []pause, start time.Time, end *time.Time, p pause) ([]pause, error) {
+	if err := checkPause(p, start, end); err != nil {
+		return nil, err
+	}
+
+	result := make([]pause, 0, len(pauses)+1)
+	for _, q := range pauses {
+		switch {
+		case q.overlaps(p):
+			return nil, fmt.Errorf("%w: pause overlaps the one from %s", ErrConflict, q.from.Format(dateLayout))
+		case q.touches(p):
+			p.from = q.from
+		case p.touches(q):
+			p.to = q.to
+		default:
+			result = append(result, q)
+		}
+	}
+	result = append(result, p)
+	sort.Slice(result, func(i, j int) bool { return result[i].from.Before(result[j].from) })
+	return result, nil
+}
+
+// checkPause accepts a pause that lies within a subscription running from
+// start to end.
+func checkPause(p pause, start time.Time, end *time.Time) error {
+	if p.from.Before(start) {
+		return fmt.Errorf("%w: pause must not start before start_date", ErrInvalidInput)
+	}
+	if end != nil && (p.from.After(*end) || p.to != nil && p.to.After(*end)) {
+		return fmt.Errorf("%w: pause must not end after end_date", ErrInvalidInput)
+	}
+	return nil
+}
+
+// checkPauses applies checkPause to the stored pauses of a subscription
+// whose dates are updated to start and end.
+func checkPauses(pauses []pause, start time.Time, end *time.Time) error {
+	for _, p := range pauses {
+		if err := checkPause(p, start, end); err != nil {
+			return fmt.Errorf("pause from %s: %w", p.from.Format(dateLayout), err)
+		}
+	}
+	return nil
+}
+
+// resumePauses ends the pause that day on falls in, so that the subscription
+// is billed again from on, and returns the new list. A pause starting on that
+// day is dropped altogether.
+func resumePauses(pauses []pause, on time.Time) ([]pause, error) {
+	for i, p := range pauses {
+		if !p.contains(on) {
+			continue
+		}
+		result := append([]pause(nil), pauses[:i]...)
+		if p.from.Before(on) {
+			to := on.AddDate(0, 0, -1)
+			result = append(result, pause{from: p.from, to: &to})
+		}
+		return append(result, pauses[i+1:]...), nil
+	}
+	return nil, fmt.Errorf("%w: subscription is not paused on %s", ErrConflict, on.Format(dateLayout))
+}
+
+// pausedDays counts the days from..to, both included, that fall in a pause.
+func pausedDays(pauses []pause, from, to time.Time) int {
+	days := 0
+	for _, p := range pauses {
+		lo, hi := latest(from, p.from), to
+		if p.to != nil {
+			hi = earliest(to, *p.to)
+		}
+		if !hi.Before(lo) {
+			days += daysBetween(lo, hi) + 1
+		}
+	}
+	return days
+}
+
+// pausedThroughout reports whether the pauses cover every day from..to.
+// Pauses never overlap or touch, so that takes a single pause.
+func pausedThroughout(pauses []pause, from, to time.Time) bool {
+	for _, p := range pauses {
+		if p.contains(from) && (p.to == nil || !p.to.Before(to)) {
+			return true
+		}
+	}
+	return false
+}
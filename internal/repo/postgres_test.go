@@ -0,0 +1,32 @@
+package repo
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/pressly/goose"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostgresRepo_Conformance runs against the database in DATABASE_URL and
+// wipes its tables, so point it at a disposable database.
+func TestPostgresRepo_Conformance(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+
+	conn, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, conn.Ping())
+	require.NoError(t, goose.SetDialect("postgres"))
+	require.NoError(t, goose.Up(conn, "../../migrations"))
+
+	runConformance(t, func(t *testing.T) Repository {
+		_, err := conn.Exec(`TRUNCATE subscriptions, subscription_prices, subscription_pauses, subscription_tags, services, service_aliases, exchange_rates, audit_log, idempotency_keys RESTART IDENTITY`)
+		require.NoError(t, err)
+		return NewPostgresRepo(conn)
+	})
+}
@@ -0,0 +1,53 @@
+package repo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// priceChange is a price that applies from a given day on.
+type priceChange struct {
+	from  time.Time
+	price int
+}
+
+func (c priceChange) model() models.PriceChange {
+	return models.PriceChange{EffectiveFrom: c.from.Format(dateLayout), Price: c.price}
+}
+
+// normalizePriceChange parses the effective date of p, rewriting it as an ISO
+// date. A month means its first day.
+func normalizePriceChange(p *models.PriceChange) (time.Time, error) {
+	on, err := parseRange(p.EffectiveFrom)
+	if err != nil {
+		return time.Time{}, err
+	}
+	p.EffectiveFrom = on.from.Format(dateLayout)
+	return on.from, nil
+}
+
+// checkPriceChange accepts changes that take effect after the subscription
+// starts and no later than its end. The price at the start is the
+// subscription's own price.
+func checkPriceChange(start time.Time, end *time.Time, from time.Time) error {
+	if !from.After(start) {
+		return fmt.Errorf("%w: effective_from must be after start_date", ErrInvalidInput)
+	}
+	if end != nil && from.After(*end) {
+		return fmt.Errorf("%w: effective_from must not be after end_date", ErrInvalidInput)
+	}
+	return nil
+}
+
+// checkPriceChanges applies checkPriceChange to the stored changes of a
+// subscription whose dates are updated to start and end.
+func checkPriceChanges(start time.Time, end *time.Time, changes []priceChange) error {
+	for _, c := range changes {
+		if err := checkPriceChange(start, end, c.from); err != nil {
+			return fmt.Errorf("price change on %s: %w", c.from.Format(dateLayout), err)
+		}
+	}
+	return nil
+}
@@ -1,15 +1,174 @@
 package repo
 
-import "github.com/MosinFAM/subs-app/internal/models"
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/dates"
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// monthLayout is the MM-YYYY format used for months.
+	monthLayout = dates.MonthLayout
+	// dateLayout is the calendar date format used inside cursors.
+	dateLayout = dates.DayLayout
+)
 
 // go install go.uber.org/mock/mockgen@latest
 //
 //go:generate mockgen -source=repo.go -destination=repo_mock.go -package=repo Repository
 type Repository interface {
-	CreateSubscription(s models.Subscription) (models.Subscription, error)
-	ListSubscriptions(userID string) ([]models.Subscription, error)
-	SumSubscriptions(filter models.SubscriptionSumRequest) (int, error)
-	GetSubscriptionByID(id string) (models.Subscription, error)
-	UpdateSubscription(s models.Subscription) (models.Subscription, error)
-	DeleteSubscription(id string) error
+	// CreateSubscription stores s under a new ID. Under WithIdempotencyKey a
+	// retry returns the subscription created the first time.
+	CreateSubscription(ctx context.Context, s models.Subscription) (models.Subscription, error)
+	ListSubscriptions(ctx context.Context, filter models.SubscriptionListRequest) (models.SubscriptionPage, error)
+	// EachSubscription calls fn with every subscription matching filter, in
+	// the order of filter.Sort, ignoring its cursor and limit. Subscriptions
+	// are read a batch at a time rather than all at once, each bounded by
+	// WithBatchTimeout; an error from fn stops the iteration and is returned.
+	EachSubscription(ctx context.Context, filter models.SubscriptionListRequest, fn func(models.Subscription) error) error
+	SumSubscriptions(ctx context.Context, filter models.SubscriptionSumRequest) (models.SubscriptionSummary, error)
+	GetSubscriptionByID(ctx context.Context, id string) (models.Subscription, error)
+	// UpdateSubscription replaces subscription s.ID. Like every mutation of a
+	// subscription it increments the version, and like DeleteSubscription it
+	// checks the version expected by WithExpectedVersion.
+	UpdateSubscription(ctx context.Context, s models.Subscription) (models.Subscription, error)
+	// DeleteSubscription marks subscription id as deleted. Deleted
+	// subscriptions are left out of every read unless the context comes from
+	// WithDeleted, and cannot be changed until they are restored, except for
+	// being unlinked by DeleteService.
+	DeleteSubscription(ctx context.Context, id string) error
+	// RestoreSubscription undoes the deletion of subscription id.
+	RestoreSubscription(ctx context.Context, id string) (models.Subscription, error)
+	// PurgeDeleted permanently removes the subscriptions deleted before
+	// cutoff and returns how many were removed. Their audit history is kept.
+	PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error)
+	// PurgeIdempotencyKeys forgets the idempotency keys expiring by cutoff
+	// and returns how many there were.
+	PurgeIdempotencyKeys(ctx context.Context, cutoff time.Time) (int, error)
+
+	// AddPriceChange records a new price of subscription id. Changes must
+	// take effect after the subscription starts, on distinct days.
+	AddPriceChange(ctx context.Context, id string, p models.PriceChange) (models.PriceChange, error)
+	ListPriceChanges(ctx context.Context, id string) ([]models.PriceChange, error)
+
+	// PauseSubscription records a pause of subscription id and returns the
+	// subscription with all its pauses. Pauses must lie within the
+	// subscription and must not overlap.
+	PauseSubscription(ctx context.Context, id string, p models.Pause) (models.Subscription, error)
+	// ResumeSubscription ends the pause that day on falls in, so the
+	// subscription is billed again from that day.
+	ResumeSubscription(ctx context.Context, id, on string) (models.Subscription, error)
+
+	// CreateService adds a catalog entry. Its name and aliases must not match
+	// those of another entry.
+	CreateService(ctx context.Context, svc models.Service) (models.Service, error)
+	ListServices(ctx context.Context) ([]models.Service, error)
+	GetServiceByID(ctx context.Context, id string) (models.Service, error)
+	// UpdateService replaces a catalog entry and renames the subscriptions
+	// referring to it, apart from deleted ones.
+	UpdateService(ctx context.Context, svc models.Service) (models.Service, error)
+	// DeleteService removes a catalog entry. Subscriptions referring to it,
+	// deleted ones included, keep their service name but no longer refer to
+	// the catalog.
+	DeleteService(ctx context.Context, id string) error
+
+	// Every mutation of a subscription appends an entry to the audit log in
+	// the same transaction, recording the actor set with WithAuditInfo.
+	// ListSubscriptionHistory returns the entries of subscription id, oldest
+	// first, even after it was purged. A subscription without entries gets an
+	// empty list; ErrNotFound means there is no such subscription.
+	ListSubscriptionHistory(ctx context.Context, id string) ([]models.AuditEntry, error)
+	// ListAuditEntries returns a page of the audit log, newest first.
+	ListAuditEntries(ctx context.Context, filter models.AuditListRequest) (models.AuditPage, error)
+
+	ListExchangeRates(ctx context.Context) ([]models.ExchangeRate, error)
+	// SetExchangeRates adds the given rates, replacing existing ones for the
+	// same currency and month. Either all rates are stored or none.
+	SetExchangeRates(ctx context.Context, rates []models.ExchangeRate) error
+	DeleteExchangeRate(ctx context.Context, currency, month string) error
+
+	// InTransaction runs fn with a repository whose changes are kept only if
+	// fn succeeds, all together. fn must make every call through tx.
+	InTransaction(ctx context.Context, fn func(tx Repository) error) error
+}
+
+func parseMonth(value string) (time.Time, error) {
+	t, err := time.Parse(monthLayout, value)
+	if err != nil {
+		return t, invalidDate(value)
+	}
+	return t, nil
+}
+
+// dateRange is a span of days, both ends included.
+type dateRange struct {
+	from, to time.Time
+}
+
+// parseRange reads a day or, when given as MM-YYYY, a whole month.
+func parseRange(value string) (dateRange, error) {
+	from, err := dates.ParseStart(value)
+	if err != nil {
+		return dateRange{}, invalidDate(value)
+	}
+	to, err := dates.ParseEnd(value)
+	if err != nil {
+		return dateRange{}, invalidDate(value)
+	}
+	return dateRange{from: from, to: to}, nil
+}
+
+// parsePeriod reads the from..to window of a summary. A month given as from
+// starts on its first day, a month given as to ends on its last day.
+func parsePeriod(from, to string) (dateRange, error) {
+	start, err := parseRange(from)
+	if err != nil {
+		return dateRange{}, err
+	}
+	end, err := parseRange(to)
+	if err != nil {
+		return dateRange{}, err
+	}
+	return dateRange{from: start.from, to: end.to}, nil
+}
+
+// normalizeDates parses the start and optional end date of s and rewrites
+// them as ISO dates. An end month means the subscription runs until the last
+// day of that month.
+func normalizeDates(s *models.Subscription) (time.Time, *time.Time, error) {
+	start, err := dates.ParseStart(s.StartDate)
+	if err != nil {
+		return start, nil, invalidDate(s.StartDate)
+	}
+	s.StartDate = start.Format(dates.DayLayout)
+	if s.EndDate == nil {
+		return start, nil, nil
+	}
+	end, err := dates.ParseEnd(*s.EndDate)
+	if err != nil {
+		return start, nil, invalidDate(*s.EndDate)
+	}
+	formatted := end.Format(dates.DayLayout)
+	s.EndDate = &formatted
+	return start, &end, nil
+}
+
+// checkID rejects ids that are not UUIDs up front, the same way PostgreSQL
+// does for its UUID columns, so every backend reports them alike.
+func checkID(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("%w: id %q is not a UUID", ErrInvalidInput, id)
+	}
+	return nil
+}
+
+func checkUserID(userID string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return fmt.Errorf("%w: user_id %q is not a UUID", ErrInvalidInput, userID)
+	}
+	return nil
 }
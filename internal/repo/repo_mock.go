@@ -10,7 +10,9 @@
 package repo
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	models "github.com/MosinFAM/subs-app/internal/models"
 	gomock "go.uber.org/mock/gomock"
@@ -40,91 +42,371 @@ func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 	return m.recorder
 }
 
+// AddPriceChange mocks base method.
+func (m *MockRepository) AddPriceChange(ctx context.Context, id string, p models.PriceChange) (models.PriceChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddPriceChange", ctx, id, p)
+	ret0, _ := ret[0].(models.PriceChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddPriceChange indicates an expected call of AddPriceChange.
+func (mr *MockRepositoryMockRecorder) AddPriceChange(ctx, id, p any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPriceChange", reflect.TypeOf((*MockRepository)(nil).AddPriceChange), ctx, id, p)
+}
+
+// CreateService mocks base method.
+func (m *MockRepository) CreateService(ctx context.Context, svc models.Service) (models.Service, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateService", ctx, svc)
+	ret0, _ := ret[0].(models.Service)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateService indicates an expected call of CreateService.
+func (mr *MockRepositoryMockRecorder) CreateService(ctx, svc any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateService", reflect.TypeOf((*MockRepository)(nil).CreateService), ctx, svc)
+}
+
 // CreateSubscription mocks base method.
-func (m *MockRepository) CreateSubscription(s models.Subscription) (models.Subscription, error) {
+func (m *MockRepository) CreateSubscription(ctx context.Context, s models.Subscription) (models.Subscription, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateSubscription", s)
+	ret := m.ctrl.Call(m, "CreateSubscription", ctx, s)
 	ret0, _ := ret[0].(models.Subscription)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateSubscription indicates an expected call of CreateSubscription.
-func (mr *MockRepositoryMockRecorder) CreateSubscription(s any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) CreateSubscription(ctx, s any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSubscription", reflect.TypeOf((*MockRepository)(nil).CreateSubscription), ctx, s)
+}
+
+// DeleteExchangeRate mocks base method.
+func (m *MockRepository) DeleteExchangeRate(ctx context.Context, currency, month string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExchangeRate", ctx, currency, month)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteExchangeRate indicates an expected call of DeleteExchangeRate.
+func (mr *MockRepositoryMockRecorder) DeleteExchangeRate(ctx, currency, month any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExchangeRate", reflect.TypeOf((*MockRepository)(nil).DeleteExchangeRate), ctx, currency, month)
+}
+
+// DeleteService mocks base method.
+func (m *MockRepository) DeleteService(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteService", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteService indicates an expected call of DeleteService.
+func (mr *MockRepositoryMockRecorder) DeleteService(ctx, id any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSubscription", reflect.TypeOf((*MockRepository)(nil).CreateSubscription), s)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteService", reflect.TypeOf((*MockRepository)(nil).DeleteService), ctx, id)
 }
 
 // DeleteSubscription mocks base method.
-func (m *MockRepository) DeleteSubscription(id string) error {
+func (m *MockRepository) DeleteSubscription(ctx context.Context, id string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteSubscription", id)
+	ret := m.ctrl.Call(m, "DeleteSubscription", ctx, id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteSubscription indicates an expected call of DeleteSubscription.
-func (mr *MockRepositoryMockRecorder) DeleteSubscription(id any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) DeleteSubscription(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSubscription", reflect.TypeOf((*MockRepository)(nil).DeleteSubscription), ctx, id)
+}
+
+// EachSubscription mocks base method.
+func (m *MockRepository) EachSubscription(ctx context.Context, filter models.SubscriptionListRequest, fn func(models.Subscription) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EachSubscription", ctx, filter, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EachSubscription indicates an expected call of EachSubscription.
+func (mr *MockRepositoryMockRecorder) EachSubscription(ctx, filter, fn any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSubscription", reflect.TypeOf((*MockRepository)(nil).DeleteSubscription), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EachSubscription", reflect.TypeOf((*MockRepository)(nil).EachSubscription), ctx, filter, fn)
+}
+
+// GetServiceByID mocks base method.
+func (m *MockRepository) GetServiceByID(ctx context.Context, id string) (models.Service, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServiceByID", ctx, id)
+	ret0, _ := ret[0].(models.Service)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetServiceByID indicates an expected call of GetServiceByID.
+func (mr *MockRepositoryMockRecorder) GetServiceByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServiceByID", reflect.TypeOf((*MockRepository)(nil).GetServiceByID), ctx, id)
 }
 
 // GetSubscriptionByID mocks base method.
-func (m *MockRepository) GetSubscriptionByID(id string) (models.Subscription, error) {
+func (m *MockRepository) GetSubscriptionByID(ctx context.Context, id string) (models.Subscription, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetSubscriptionByID", id)
+	ret := m.ctrl.Call(m, "GetSubscriptionByID", ctx, id)
 	ret0, _ := ret[0].(models.Subscription)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetSubscriptionByID indicates an expected call of GetSubscriptionByID.
-func (mr *MockRepositoryMockRecorder) GetSubscriptionByID(id any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) GetSubscriptionByID(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscriptionByID", reflect.TypeOf((*MockRepository)(nil).GetSubscriptionByID), ctx, id)
+}
+
+// InTransaction mocks base method.
+func (m *MockRepository) InTransaction(ctx context.Context, fn func(tx Repository) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InTransaction", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InTransaction indicates an expected call of InTransaction.
+func (mr *MockRepositoryMockRecorder) InTransaction(ctx, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InTransaction", reflect.TypeOf((*MockRepository)(nil).InTransaction), ctx, fn)
+}
+
+// ListAuditEntries mocks base method.
+func (m *MockRepository) ListAuditEntries(ctx context.Context, filter models.AuditListRequest) (models.AuditPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAuditEntries", ctx, filter)
+	ret0, _ := ret[0].(models.AuditPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAuditEntries indicates an expected call of ListAuditEntries.
+func (mr *MockRepositoryMockRecorder) ListAuditEntries(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAuditEntries", reflect.TypeOf((*MockRepository)(nil).ListAuditEntries), ctx, filter)
+}
+
+// ListExchangeRates mocks base method.
+func (m *MockRepository) ListExchangeRates(ctx context.Context) ([]models.ExchangeRate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListExchangeRates", ctx)
+	ret0, _ := ret[0].([]models.ExchangeRate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListExchangeRates indicates an expected call of ListExchangeRates.
+func (mr *MockRepositoryMockRecorder) ListExchangeRates(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListExchangeRates", reflect.TypeOf((*MockRepository)(nil).ListExchangeRates), ctx)
+}
+
+// ListPriceChanges mocks base method.
+func (m *MockRepository) ListPriceChanges(ctx context.Context, id string) ([]models.PriceChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPriceChanges", ctx, id)
+	ret0, _ := ret[0].([]models.PriceChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPriceChanges indicates an expected call of ListPriceChanges.
+func (mr *MockRepositoryMockRecorder) ListPriceChanges(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPriceChanges", reflect.TypeOf((*MockRepository)(nil).ListPriceChanges), ctx, id)
+}
+
+// ListServices mocks base method.
+func (m *MockRepository) ListServices(ctx context.Context) ([]models.Service, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListServices", ctx)
+	ret0, _ := ret[0].([]models.Service)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListServices indicates an expected call of ListServices.
+func (mr *MockRepositoryMockRecorder) ListServices(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListServices", reflect.TypeOf((*MockRepository)(nil).ListServices), ctx)
+}
+
+// ListSubscriptionHistory mocks base method.
+func (m *MockRepository) ListSubscriptionHistory(ctx context.Context, id string) ([]models.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSubscriptionHistory", ctx, id)
+	ret0, _ := ret[0].([]models.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSubscriptionHistory indicates an expected call of ListSubscriptionHistory.
+func (mr *MockRepositoryMockRecorder) ListSubscriptionHistory(ctx, id any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscriptionByID", reflect.TypeOf((*MockRepository)(nil).GetSubscriptionByID), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSubscriptionHistory", reflect.TypeOf((*MockRepository)(nil).ListSubscriptionHistory), ctx, id)
 }
 
 // ListSubscriptions mocks base method.
-func (m *MockRepository) ListSubscriptions(userID string) ([]models.Subscription, error) {
+func (m *MockRepository) ListSubscriptions(ctx context.Context, filter models.SubscriptionListRequest) (models.SubscriptionPage, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListSubscriptions", userID)
-	ret0, _ := ret[0].([]models.Subscription)
+	ret := m.ctrl.Call(m, "ListSubscriptions", ctx, filter)
+	ret0, _ := ret[0].(models.SubscriptionPage)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // ListSubscriptions indicates an expected call of ListSubscriptions.
-func (mr *MockRepositoryMockRecorder) ListSubscriptions(userID any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) ListSubscriptions(ctx, filter any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSubscriptions", reflect.TypeOf((*MockRepository)(nil).ListSubscriptions), userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSubscriptions", reflect.TypeOf((*MockRepository)(nil).ListSubscriptions), ctx, filter)
 }
 
-// SumSubscriptions mocks base method.
-func (m *MockRepository) SumSubscriptions(filter models.SubscriptionSumRequest) (int, error) {
+// PauseSubscription mocks base method.
+func (m *MockRepository) PauseSubscription(ctx context.Context, id string, p models.Pause) (models.Subscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PauseSubscription", ctx, id, p)
+	ret0, _ := ret[0].(models.Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PauseSubscription indicates an expected call of PauseSubscription.
+func (mr *MockRepositoryMockRecorder) PauseSubscription(ctx, id, p any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseSubscription", reflect.TypeOf((*MockRepository)(nil).PauseSubscription), ctx, id, p)
+}
+
+// PurgeDeleted mocks base method.
+func (m *MockRepository) PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeleted", ctx, cutoff)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeleted indicates an expected call of PurgeDeleted.
+func (mr *MockRepositoryMockRecorder) PurgeDeleted(ctx, cutoff any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeleted", reflect.TypeOf((*MockRepository)(nil).PurgeDeleted), ctx, cutoff)
+}
+
+// PurgeIdempotencyKeys mocks base method.
+func (m *MockRepository) PurgeIdempotencyKeys(ctx context.Context, cutoff time.Time) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SumSubscriptions", filter)
+	ret := m.ctrl.Call(m, "PurgeIdempotencyKeys", ctx, cutoff)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// PurgeIdempotencyKeys indicates an expected call of PurgeIdempotencyKeys.
+func (mr *MockRepositoryMockRecorder) PurgeIdempotencyKeys(ctx, cutoff any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeIdempotencyKeys", reflect.TypeOf((*MockRepository)(nil).PurgeIdempotencyKeys), ctx, cutoff)
+}
+
+// RestoreSubscription mocks base method.
+func (m *MockRepository) RestoreSubscription(ctx context.Context, id string) (models.Subscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreSubscription", ctx, id)
+	ret0, _ := ret[0].(models.Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreSubscription indicates an expected call of RestoreSubscription.
+func (mr *MockRepositoryMockRecorder) RestoreSubscription(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreSubscription", reflect.TypeOf((*MockRepository)(nil).RestoreSubscription), ctx, id)
+}
+
+// ResumeSubscription mocks base method.
+func (m *MockRepository) ResumeSubscription(ctx context.Context, id, on string) (models.Subscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResumeSubscription", ctx, id, on)
+	ret0, _ := ret[0].(models.Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResumeSubscription indicates an expected call of ResumeSubscription.
+func (mr *MockRepositoryMockRecorder) ResumeSubscription(ctx, id, on any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResumeSubscription", reflect.TypeOf((*MockRepository)(nil).ResumeSubscription), ctx, id, on)
+}
+
+// SetExchangeRates mocks base method.
+func (m *MockRepository) SetExchangeRates(ctx context.Context, rates []models.ExchangeRate) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetExchangeRates", ctx, rates)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetExchangeRates indicates an expected call of SetExchangeRates.
+func (mr *MockRepositoryMockRecorder) SetExchangeRates(ctx, rates any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetExchangeRates", reflect.TypeOf((*MockRepository)(nil).SetExchangeRates), ctx, rates)
+}
+
+// SumSubscriptions mocks base method.
+func (m *MockRepository) SumSubscriptions(ctx context.Context, filter models.SubscriptionSumRequest) (models.SubscriptionSummary, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SumSubscriptions", ctx, filter)
+	ret0, _ := ret[0].(models.SubscriptionSummary)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // SumSubscriptions indicates an expected call of SumSubscriptions.
-func (mr *MockRepositoryMockRecorder) SumSubscriptions(filter any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) SumSubscriptions(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SumSubscriptions", reflect.TypeOf((*MockRepository)(nil).SumSubscriptions), ctx, filter)
+}
+
+// UpdateService mocks base method.
+func (m *MockRepository) UpdateService(ctx context.Context, svc models.Service) (models.Service, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateService", ctx, svc)
+	ret0, _ := ret[0].(models.Service)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateService indicates an expected call of UpdateService.
+func (mr *MockRepositoryMockRecorder) UpdateService(ctx, svc any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SumSubscriptions", reflect.TypeOf((*MockRepository)(nil).SumSubscriptions), filter)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateService", reflect.TypeOf((*MockRepository)(nil).UpdateService), ctx, svc)
 }
 
 // UpdateSubscription mocks base method.
-func (m *MockRepository) UpdateSubscription(s models.Subscription) (models.Subscription, error) {
+func (m *MockRepository) UpdateSubscription(ctx context.Context, s models.Subscription) (models.Subscription, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateSubscription", s)
+	ret := m.ctrl.Call(m, "UpdateSubscription", ctx, s)
 	ret0, _ := ret[0].(models.Subscription)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UpdateSubscription indicates an expected call of UpdateSubscription.
-func (mr *MockRepositoryMockRecorder) UpdateSubscription(s any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) UpdateSubscription(ctx, s any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSubscription", reflect.TypeOf((*MockRepository)(nil).UpdateSubscription), s)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSubscription", reflect.TypeOf((*MockRepository)(nil).UpdateSubscription), ctx, s)
 }
@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/google/uuid"
+)
+
+// aliasKey folds a service name for catalog matching: case and runs of
+// whitespace do not matter.
+func aliasKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// normalizeService trims the names of svc and drops empty aliases and ones
+// that match the name or an earlier alias. It returns the keys the entry is
+// matched by, the name's first.
+func normalizeService(svc *models.Service) ([]string, error) {
+	svc.Name = strings.TrimSpace(svc.Name)
+	if svc.Name == "" {
+		return nil, fmt.Errorf("%w: service name must not be empty", ErrInvalidInput)
+	}
+	if svc.DefaultPrice != nil && *svc.DefaultPrice <= 0 {
+		return nil, fmt.Errorf("%w: default_price must be positive", ErrInvalidInput)
+	}
+	if svc.DefaultCurrency != "" && !isCurrencyCode(svc.DefaultCurrency) {
+		return nil, fmt.Errorf("%w: unknown default_currency %q", ErrInvalidInput, svc.DefaultCurrency)
+	}
+
+	keys := []string{aliasKey(svc.Name)}
+	seen := map[string]bool{keys[0]: true}
+	aliases := []string{}
+	for _, alias := range svc.Aliases {
+		alias = strings.TrimSpace(alias)
+		key := aliasKey(alias)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+		aliases = append(aliases, alias)
+	}
+	svc.Aliases = aliases
+	return keys, nil
+}
+
+// linkService makes s refer to the catalog entry svc, taking its canonical
+// name and, where s has none, its default price, currency and category. A nil
+// svc leaves s unlinked with its service name trimmed.
+func linkService(s *models.Subscription, svc *models.Service) {
+	if svc == nil {
+		s.ServiceID = nil
+		s.ServiceName = strings.TrimSpace(s.ServiceName)
+	} else {
+		id := svc.ID
+		s.ServiceID = &id
+		s.ServiceName = svc.Name
+		if s.Price == 0 && svc.DefaultPrice != nil {
+			s.Price = *svc.DefaultPrice
+		}
+		if s.Currency == "" {
+			s.Currency = svc.DefaultCurrency
+		}
+	}
+	categorize(s, svc)
+}
+
+func checkServiceID(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("%w: service_id %q is not a UUID", ErrInvalidInput, id)
+	}
+	return nil
+}
+
+// errUnknownService reports a service_id missing from the catalog.
+func errUnknownService(id string) error {
+	return fmt.Errorf("%w: unknown service_id %q", ErrInvalidInput, id)
+}
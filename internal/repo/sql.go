@@ -0,0 +1,1423 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/google/uuid"
+)
+
+// dialect captures what differs between the SQL databases sqlRepo runs on.
+type dialect struct {
+	// ilike returns the condition that column matches the LIKE pattern,
+	// ignoring case, Unicode included.
+	ilike func(column, pattern string) string
+	// bytewise is appended to a text column to order it by its UTF-8 bytes,
+	// as MemoryRepo does, rather than by the collation of the database.
+	bytewise string
+	// rebind rewrites the $N placeholders used in queries, if needed.
+	rebind func(query string) string
+	// mapError translates driver errors into domain errors.
+	mapError func(err error) error
+	// forUpdate is appended to a SELECT to lock the rows it reads until the
+	// transaction ends. It is empty when the database serializes writers.
+	forUpdate string
+}
+
+// queryer is the part of *sql.DB and *sql.Tx the repository uses.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqlRepo implements Repository on top of database/sql. The queries are
+// written for PostgreSQL and adapted to other databases through dialect.
+type sqlRepo struct {
+	db queryer
+	d  dialect
+}
+
+// inTx runs fn with a repository bound to a new transaction, committing it
+// when fn succeeds. Nested calls reuse the outer transaction.
+func (r *sqlRepo) inTx(ctx context.Context, fn func(tx *sqlRepo) error) error {
+	db, ok := r.db.(*sql.DB)
+	if !ok {
+		return fn(r)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return r.mapError(err)
+	}
+	if err := fn(&sqlRepo{db: tx, d: r.d}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return r.mapError(tx.Commit())
+}
+
+func (r *sqlRepo) InTransaction(ctx context.Context, fn func(tx Repository) error) error {
+	return r.inTx(ctx, func(tx *sqlRepo) error {
+		return fn(tx)
+	})
+}
+
+func (r *sqlRepo) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	res, err := r.db.ExecContext(ctx, r.d.rebind(query), args...)
+	return res, r.mapError(err)
+}
+
+func (r *sqlRepo) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := r.db.QueryContext(ctx, r.d.rebind(query), args...)
+	return rows, r.mapError(err)
+}
+
+func (r *sqlRepo) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.db.QueryRowContext(ctx, r.d.rebind(query), args...)
+}
+
+func (r *sqlRepo) mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return r.d.mapError(err)
+}
+
+// subscriptionColumns lists the columns scanSubscription reads, in order.
+const subscriptionColumns = `id, service_id, service_name, price, currency, user_id, start_date, end_date, billing_period, billing_months,
+	trial_end_date, intro_price, intro_months, category, deleted_at, version`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSubscription reads a row selected with subscriptionColumns. The raw
+// start date is returned as well for building cursors.
+func scanSubscription(row scanner) (models.Subscription, time.Time, error) {
+	var s models.Subscription
+	var start time.Time
+	var end, trialEnd *time.Time
+
+	if err := row.Scan(&s.ID, &s.ServiceID, &s.ServiceName, &s.Price, &s.Currency, &s.UserID, &start, &end, &s.BillingPeriod, &s.BillingMonths,
+		&trialEnd, &s.IntroPrice, &s.IntroMonths, &s.Category, &s.DeletedAt, &s.Version); err != nil {
+		return s, start, err
+	}
+	if s.DeletedAt != nil {
+		deletedAt := s.DeletedAt.UTC()
+		s.DeletedAt = &deletedAt
+	}
+
+	s.StartDate = start.Format(dateLayout)
+	s.EndDate = formatDate(end)
+	s.TrialEndDate = formatDate(trialEnd)
+	return s, start, nil
+}
+
+func formatDate(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	str := t.Format(dateLayout)
+	return &str
+}
+
+// queryArgs collects positional query arguments and hands out their
+// placeholders.
+type queryArgs []interface{}
+
+func (a *queryArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+func (r *sqlRepo) CreateSubscription(ctx context.Context, s models.Subscription) (models.Subscription, error) {
+	s.ID = uuid.New().String()
+
+	start, end, err := normalizeDates(&s)
+	if err != nil {
+		return s, err
+	}
+	if err := checkUserID(s.UserID); err != nil {
+		return s, err
+	}
+	s.Tags = normalizeTags(s.Tags)
+	s.Pauses = nil
+	s.DeletedAt = nil
+	s.Version = 1
+
+	err = r.inTx(ctx, func(tx *sqlRepo) error {
+		key, idempotent := idempotencyKey(ctx)
+		if idempotent {
+			created, found, err := tx.idempotentResponse(ctx, key)
+			if err != nil {
+				return err
+			}
+			if found {
+				s = created
+				return nil
+			}
+		}
+		if err := tx.resolveService(ctx, &s); err != nil {
+			return err
+		}
+		if err := normalizeCurrency(&s); err != nil {
+			return err
+		}
+		if err := normalizeBilling(&s); err != nil {
+			return err
+		}
+		trialEnd, err := normalizeTrial(&s, start)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec(ctx, `
+			INSERT INTO subscriptions (id, service_id, service_name, price, currency, user_id, start_date, end_date, billing_period, billing_months,
+				trial_end_date, intro_price, intro_months, category, version)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		`, s.ID, s.ServiceID, s.ServiceName, s.Price, s.Currency, s.UserID, start, end, s.BillingPeriod, s.BillingMonths,
+			trialEnd, s.IntroPrice, s.IntroMonths, s.Category, s.Version)
+		if err != nil {
+			return err
+		}
+		if err := tx.setTags(ctx, s.ID, s.Tags); err != nil {
+			return err
+		}
+		if err := tx.audit(ctx, s.ID, models.AuditCreate, nil, s); err != nil {
+			return err
+		}
+		if !idempotent {
+			return nil
+		}
+		response, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		// A concurrent request under the same key fails here with ErrConflict.
+		_, err = tx.exec(ctx, `
+			INSERT INTO idempotency_keys (key, request_hash, response, expires_at) VALUES ($1, $2, $3, $4)
+		`, key.Key, key.Hash, string(response), key.ExpiresAt.UTC())
+		return err
+	})
+	return s, err
+}
+
+// idempotentResponse returns the subscription created under key unless the
+// key expired, in which case it is forgotten.
+func (r *sqlRepo) idempotentResponse(ctx context.Context, key IdempotencyKey) (models.Subscription, bool, error) {
+	now := time.Now().UTC()
+	if _, err := r.exec(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND expires_at <= $2`, key.Key, now); err != nil {
+		return models.Subscription{}, false, err
+	}
+	var hash string
+	var response []byte
+	err := r.queryRow(ctx, `SELECT request_hash, response FROM idempotency_keys WHERE key = $1`, key.Key).Scan(&hash, &response)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Subscription{}, false, nil
+	}
+	if err != nil {
+		return models.Subscription{}, false, r.mapError(err)
+	}
+	s, err := replayIdempotent(key, hash, response)
+	return s, true, err
+}
+
+// audit appends an entry for action on subscription id to the audit log.
+func (r *sqlRepo) audit(ctx context.Context, id, action string, before, after interface{}) error {
+	e, err := newAuditEntry(ctx, id, action, before, after)
+	if err != nil {
+		return err
+	}
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+	_, err = r.exec(ctx, `
+		INSERT INTO audit_log (subscription_id, action, actor, request_id, changes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, e.SubscriptionID, e.Action, e.Actor, e.RequestID, string(changes), e.At)
+	return err
+}
+
+// lockedSubscription loads subscription id, unless it is deleted, and locks
+// its row until the transaction ends.
+func (r *sqlRepo) lockedSubscription(ctx context.Context, id string) (models.Subscription, error) {
+	var locked string
+	if err := r.queryRow(ctx, `SELECT id FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`+r.d.forUpdate, id).Scan(&locked); err != nil {
+		return models.Subscription{}, r.mapError(err)
+	}
+	return r.GetSubscriptionByID(ctx, id)
+}
+
+// bumpVersion increments the version of subscription id after a change
+// stored outside its row.
+func (r *sqlRepo) bumpVersion(ctx context.Context, id string) error {
+	_, err := r.exec(ctx, `UPDATE subscriptions SET version = version + 1 WHERE id = $1`, id)
+	return err
+}
+
+// resolveService links s to its catalog entry: the one given by service_id,
+// or else the one whose name or an alias matches service_name.
+func (r *sqlRepo) resolveService(ctx context.Context, s *models.Subscription) error {
+	var id string
+	if s.ServiceID != nil {
+		if err := checkServiceID(*s.ServiceID); err != nil {
+			return err
+		}
+		id = *s.ServiceID
+	} else {
+		err := r.queryRow(ctx, `SELECT service_id FROM service_aliases WHERE alias_key = $1`, aliasKey(s.ServiceName)).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			linkService(s, nil)
+			return nil
+		}
+		if err != nil {
+			return r.mapError(err)
+		}
+	}
+
+	svc, err := r.GetServiceByID(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return errUnknownService(id)
+	}
+	if err != nil {
+		return err
+	}
+	linkService(s, &svc)
+	return nil
+}
+
+func (r *sqlRepo) ListSubscriptions(ctx context.Context, filter models.SubscriptionListRequest) (models.SubscriptionPage, error) {
+	limit := filter.Limit
+	if limit <= 0 || limit > models.MaxListLimit {
+		limit = models.DefaultListLimit
+	}
+	return r.listSubscriptions(ctx, filter, limit)
+}
+
+func (r *sqlRepo) EachSubscription(ctx context.Context, filter models.SubscriptionListRequest, fn func(models.Subscription) error) error {
+	return eachSubscription(ctx, filter, r.listSubscriptions, fn)
+}
+
+// listSubscriptions returns the page of at most limit subscriptions matching
+// filter.
+func (r *sqlRepo) listSubscriptions(ctx context.Context, filter models.SubscriptionListRequest, limit int) (models.SubscriptionPage, error) {
+	sort, err := parseSort(filter.Sort)
+	if err != nil {
+		return models.SubscriptionPage{}, err
+	}
+
+	var args queryArgs
+	where := []string{"TRUE"}
+
+	if !includeDeleted(ctx) {
+		where = append(where, "deleted_at IS NULL")
+	}
+	if filter.UserID != nil {
+		where = append(where, "user_id = "+args.add(*filter.UserID))
+	}
+	if filter.ServiceID != nil {
+		if err := checkServiceID(*filter.ServiceID); err != nil {
+			return models.SubscriptionPage{}, err
+		}
+		where = append(where, "service_id = "+args.add(*filter.ServiceID))
+	}
+	if filter.ServiceName != nil {
+		where = append(where, r.d.ilike("service_name", args.add("%"+*filter.ServiceName+"%")))
+	}
+	where = append(where, labelConditions(&args, filter.Category, filter.Tags)...)
+	if filter.MinPrice != nil {
+		where = append(where, "price >= "+args.add(*filter.MinPrice))
+	}
+	if filter.MaxPrice != nil {
+		where = append(where, "price <= "+args.add(*filter.MaxPrice))
+	}
+	if filter.ActiveOn != nil {
+		on, err := parseRange(*filter.ActiveOn)
+		if err != nil {
+			return models.SubscriptionPage{}, err
+		}
+		from, to := args.add(on.from), args.add(on.to)
+		// Pauses never overlap or touch, so the subscription is paused on
+		// every day of the range only if a single pause covers all of it.
+		where = append(where, fmt.Sprintf(`start_date <= %[2]s AND (end_date IS NULL OR end_date >= %[1]s) AND NOT EXISTS (
+			SELECT 1 FROM subscription_pauses p
+			WHERE p.subscription_id = subscriptions.id
+				AND (p.paused_from <= %[1]s OR p.paused_from <= subscriptions.start_date)
+				AND (p.paused_to IS NULL OR p.paused_to >= %[2]s OR p.paused_to >= subscriptions.end_date)
+		)`, from, to))
+	}
+	if filter.HasEndDate != nil {
+		if *filter.HasEndDate {
+			where = append(where, "end_date IS NOT NULL")
+		} else {
+			where = append(where, "end_date IS NULL")
+		}
+	}
+	if trialEnds := trialWindow(filter.TrialEndsWithin); trialEnds != nil {
+		where = append(where, fmt.Sprintf("trial_end_date BETWEEN %s AND %s", args.add(trialEnds.from), args.add(trialEnds.to)))
+	}
+
+	column := sortFields[sort.field]
+	if sort.field == "service_name" {
+		column += r.d.bytewise
+	}
+	dir, cmp := "ASC", ">"
+	if sort.desc {
+		dir, cmp = "DESC", "<"
+	}
+	if filter.Cursor != "" {
+		cur, err := decodeCursor(filter.Cursor, sort)
+		if err != nil {
+			return models.SubscriptionPage{}, err
+		}
+		value, err := cursorArg(sort.field, cur.Value)
+		if err != nil {
+			return models.SubscriptionPage{}, err
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", column, cmp, args.add(value), args.add(cur.ID)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM subscriptions
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT %s
+	`, subscriptionColumns, strings.Join(where, " AND "), column, dir, dir, args.add(limit+1))
+
+	rows, err := r.query(ctx, query, args...)
+	if err != nil {
+		return models.SubscriptionPage{}, err
+	}
+	defer rows.Close()
+
+	page := models.SubscriptionPage{Items: []models.Subscription{}, Limit: limit}
+	var last listCursor
+	for rows.Next() {
+		s, start, err := scanSubscription(rows)
+		if err != nil {
+			return models.SubscriptionPage{}, err
+		}
+		if len(page.Items) == limit {
+			page.HasMore = true
+			break
+		}
+		page.Items = append(page.Items, s)
+		last = listCursor{Sort: sort.String(), Value: cursorValue(sort.field, s, start), ID: s.ID}
+	}
+	if err := rows.Err(); err != nil {
+		return models.SubscriptionPage{}, err
+	}
+	// Release the connection before querying again; SQLite has only one.
+	rows.Close()
+	if err := r.attachDetails(ctx, page.Items); err != nil {
+		return models.SubscriptionPage{}, err
+	}
+
+	if page.HasMore {
+		next := encodeCursor(last)
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
+func (r *sqlRepo) SumSubscriptions(ctx context.Context, filter models.SubscriptionSumRequest) (models.SubscriptionSummary, error) {
+	period, err := parsePeriod(filter.From, filter.To)
+	if err != nil {
+		return models.SubscriptionSummary{}, err
+	}
+	if filter.ServiceID != nil {
+		if err := checkServiceID(*filter.ServiceID); err != nil {
+			return models.SubscriptionSummary{}, err
+		}
+	}
+	var conv *converter
+	if filter.Currency != nil {
+		rates, err := r.ListExchangeRates(ctx)
+		if err != nil {
+			return models.SubscriptionSummary{}, err
+		}
+		if conv, err = newConverter(filter.Currency, rates); err != nil {
+			return models.SubscriptionSummary{}, err
+		}
+	}
+
+	entries, err := r.costEntries(ctx, filter, period)
+	if err != nil {
+		return models.SubscriptionSummary{}, err
+	}
+	return summarize(entries, period, filter.GroupBy, conv)
+}
+
+// costEntries loads the subscriptions matching a summary filter that are
+// active within the period, together with their price changes and pauses.
+func (r *sqlRepo) costEntries(ctx context.Context, filter models.SubscriptionSumRequest, period dateRange) ([]costEntry, error) {
+	var args queryArgs
+	where := fmt.Sprintf("start_date <= %s AND (end_date IS NULL OR end_date >= %s)", args.add(period.to), args.add(period.from))
+	if !includeDeleted(ctx) {
+		where += " AND deleted_at IS NULL"
+	}
+	if filter.UserID != nil {
+		where += " AND user_id = " + args.add(*filter.UserID)
+	}
+	if filter.ServiceID != nil {
+		where += " AND service_id = " + args.add(*filter.ServiceID)
+	}
+	if filter.ServiceName != nil {
+		where += " AND " + r.d.ilike("service_name", args.add("%"+*filter.ServiceName+"%"))
+	}
+	for _, cond := range labelConditions(&args, filter.Category, filter.Tags) {
+		where += " AND " + cond
+	}
+
+	rows, err := r.query(ctx, `
+		SELECT id, service_name, user_id, category, price, currency, start_date, end_date, billing_period, billing_months,
+			trial_end_date, intro_price, intro_months
+		FROM subscriptions
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []costEntry
+	index := make(map[string]int)
+	for rows.Next() {
+		var e costEntry
+		var id, billingPeriod string
+		var months, introPrice, introMonths *int
+		var trialEnd *time.Time
+		if err := rows.Scan(&id, &e.serviceName, &e.userID, &e.category, &e.price, &e.currency, &e.start, &e.end, &billingPeriod, &months,
+			&trialEnd, &introPrice, &introMonths); err != nil {
+			return nil, err
+		}
+		e.rate = billingRate(billingPeriod, months)
+		e.setTrial(trialEnd, introPrice, introMonths)
+		index[id] = len(entries)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	rows, err = r.query(ctx, `
+		SELECT subscription_id, effective_from, price
+		FROM subscription_prices
+		WHERE subscription_id IN (SELECT id FROM subscriptions WHERE `+where+`)
+		ORDER BY effective_from
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var c priceChange
+		if err := rows.Scan(&id, &c.from, &c.price); err != nil {
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			entries[i].prices = append(entries[i].prices, c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	pauses, err := r.pausesWhere(ctx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := r.tagsWhere(ctx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	for id, i := range index {
+		entries[i].pauses = pauses[id]
+		entries[i].tags = tags[id]
+	}
+	return entries, nil
+}
+
+// pausesWhere loads the pauses of the subscriptions matching where, keyed by
+// subscription id and ordered by date.
+func (r *sqlRepo) pausesWhere(ctx context.Context, where string, args ...interface{}) (map[string][]pause, error) {
+	rows, err := r.query(ctx, `
+		SELECT subscription_id, paused_from, paused_to
+		FROM subscription_pauses
+		WHERE subscription_id IN (SELECT id FROM subscriptions WHERE `+where+`)
+		ORDER BY subscription_id, paused_from
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pauses := make(map[string][]pause)
+	for rows.Next() {
+		var id string
+		var p pause
+		if err := rows.Scan(&id, &p.from, &p.to); err != nil {
+			return nil, err
+		}
+		pauses[id] = append(pauses[id], p)
+	}
+	return pauses, rows.Err()
+}
+
+// tagsWhere loads the tags of the subscriptions matching where, keyed by
+// subscription id and sorted.
+func (r *sqlRepo) tagsWhere(ctx context.Context, where string, args ...interface{}) (map[string][]string, error) {
+	rows, err := r.query(ctx, `
+		SELECT subscription_id, tag
+		FROM subscription_tags
+		WHERE subscription_id IN (SELECT id FROM subscriptions WHERE `+where+`)
+		ORDER BY subscription_id, tag
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	return tags, rows.Err()
+}
+
+// setTags replaces the tags of subscription id.
+func (r *sqlRepo) setTags(ctx context.Context, id string, tags []string) error {
+	if _, err := r.exec(ctx, `DELETE FROM subscription_tags WHERE subscription_id = $1`, id); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := r.exec(ctx, `INSERT INTO subscription_tags (subscription_id, tag) VALUES ($1, $2)`, id, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelConditions returns the conditions filtering subscriptions by category
+// and by tags, all of which must be present.
+func labelConditions(args *queryArgs, category *string, tags []string) []string {
+	category, tags = foldLabelFilter(category, tags)
+	var conds []string
+	if category != nil {
+		conds = append(conds, "category = "+args.add(*category))
+	}
+	for _, tag := range tags {
+		conds = append(conds, `EXISTS (
+			SELECT 1 FROM subscription_tags t
+			WHERE t.subscription_id = subscriptions.id AND t.tag = `+args.add(tag)+`
+		)`)
+	}
+	return conds
+}
+
+// attachDetails fills in the pauses and tags of subs.
+func (r *sqlRepo) attachDetails(ctx context.Context, subs []models.Subscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	var args queryArgs
+	ids := make([]string, len(subs))
+	for i, s := range subs {
+		ids[i] = args.add(s.ID)
+	}
+	where := "id IN (" + strings.Join(ids, ", ") + ")"
+	pauses, err := r.pausesWhere(ctx, where, args...)
+	if err != nil {
+		return err
+	}
+	tags, err := r.tagsWhere(ctx, where, args...)
+	if err != nil {
+		return err
+	}
+	for i := range subs {
+		subs[i].Pauses = pauseModels(pauses[subs[i].ID])
+		subs[i].Tags = tags[subs[i].ID]
+	}
+	return nil
+}
+
+func (r *sqlRepo) GetSubscriptionByID(ctx context.Context, id string) (models.Subscription, error) {
+	if err := checkID(id); err != nil {
+		return models.Subscription{}, err
+	}
+
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE id = $1`
+	if !includeDeleted(ctx) {
+		query += ` AND deleted_at IS NULL`
+	}
+	s, _, err := scanSubscription(r.queryRow(ctx, query, id))
+	if err != nil {
+		return s, r.mapError(err)
+	}
+	subs := []models.Subscription{s}
+	err = r.attachDetails(ctx, subs)
+	return subs[0], err
+}
+
+func (r *sqlRepo) UpdateSubscription(ctx context.Context, s models.Subscription) (models.Subscription, error) {
+	if err := checkID(s.ID); err != nil {
+		return s, err
+	}
+	start, end, err := normalizeDates(&s)
+	if err != nil {
+		return s, err
+	}
+	if err := checkUserID(s.UserID); err != nil {
+		return s, err
+	}
+	s.Tags = normalizeTags(s.Tags)
+	s.DeletedAt = nil
+
+	err = r.inTx(ctx, func(tx *sqlRepo) error {
+		if err := tx.resolveService(ctx, &s); err != nil {
+			return err
+		}
+		if err := normalizeCurrency(&s); err != nil {
+			return err
+		}
+		if err := normalizeBilling(&s); err != nil {
+			return err
+		}
+		trialEnd, err := normalizeTrial(&s, start)
+		if err != nil {
+			return err
+		}
+		before, err := tx.lockedSubscription(ctx, s.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(ctx, before.Version); err != nil {
+			return err
+		}
+		prices, err := tx.priceChanges(ctx, s.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkPriceChanges(start, end, prices); err != nil {
+			return err
+		}
+		pauses, err := tx.pausesWhere(ctx, "id = $1", s.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkPauses(pauses[s.ID], start, end); err != nil {
+			return err
+		}
+		s.Version = before.Version + 1
+
+		res, err := tx.exec(ctx, `
+			UPDATE subscriptions
+			SET service_id=$1, service_name=$2, price=$3, currency=$4, user_id=$5, start_date=$6, end_date=$7, billing_period=$8, billing_months=$9,
+				trial_end_date=$10, intro_price=$11, intro_months=$12, category=$13, version=version+1
+			WHERE id=$14
+		`, s.ServiceID, s.ServiceName, s.Price, s.Currency, s.UserID, start, end, s.BillingPeriod, s.BillingMonths,
+			trialEnd, s.IntroPrice, s.IntroMonths, s.Category, s.ID)
+		if err != nil {
+			return err
+		}
+		if err := expectAffected(res); err != nil {
+			return err
+		}
+		subs := []models.Subscription{s}
+		if err := tx.setTags(ctx, s.ID, s.Tags); err != nil {
+			return err
+		}
+		if err := tx.attachDetails(ctx, subs); err != nil {
+			return err
+		}
+		s = subs[0]
+		return tx.audit(ctx, s.ID, models.AuditUpdate, before, s)
+	})
+	return s, err
+}
+
+func (r *sqlRepo) DeleteSubscription(ctx context.Context, id string) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+	return r.inTx(ctx, func(tx *sqlRepo) error {
+		before, err := tx.lockedSubscription(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(ctx, before.Version); err != nil {
+			return err
+		}
+		if _, err := tx.exec(ctx, `UPDATE subscriptions SET deleted_at = $1, version = version + 1 WHERE id = $2`, deletionTime(), id); err != nil {
+			return err
+		}
+		return tx.audit(ctx, id, models.AuditDelete, before, nil)
+	})
+}
+
+func (r *sqlRepo) RestoreSubscription(ctx context.Context, id string) (models.Subscription, error) {
+	if err := checkID(id); err != nil {
+		return models.Subscription{}, err
+	}
+
+	var s models.Subscription
+	err := r.inTx(ctx, func(tx *sqlRepo) error {
+		var deletedAt *time.Time
+		err := tx.queryRow(ctx, `SELECT deleted_at FROM subscriptions WHERE id = $1`+tx.d.forUpdate, id).Scan(&deletedAt)
+		if err != nil {
+			return tx.mapError(err)
+		}
+		if deletedAt == nil {
+			return errNotDeleted(id)
+		}
+		if _, err := tx.exec(ctx, `UPDATE subscriptions SET deleted_at = NULL, version = version + 1 WHERE id = $1`, id); err != nil {
+			return err
+		}
+		if s, err = tx.GetSubscriptionByID(ctx, id); err != nil {
+			return err
+		}
+		return tx.audit(ctx, id, models.AuditRestore, nil, s)
+	})
+	return s, err
+}
+
+func (r *sqlRepo) PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error) {
+	var purged int
+	err := r.inTx(ctx, func(tx *sqlRepo) error {
+		rows, err := tx.query(ctx, `SELECT id FROM subscriptions WHERE deleted_at < $1 ORDER BY id`+tx.d.forUpdate, cutoff.UTC())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		for _, id := range ids {
+			if _, err := tx.exec(ctx, `DELETE FROM subscriptions WHERE id = $1`, id); err != nil {
+				return err
+			}
+			if err := tx.audit(ctx, id, models.AuditPurge, nil, nil); err != nil {
+				return err
+			}
+		}
+		purged = len(ids)
+		return nil
+	})
+	return purged, err
+}
+
+func (r *sqlRepo) PurgeIdempotencyKeys(ctx context.Context, cutoff time.Time) (int, error) {
+	res, err := r.exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// auditColumns lists the columns scanAuditEntry reads, in order.
+const auditColumns = `id, subscription_id, action, actor, request_id, changes, created_at`
+
+func scanAuditEntry(row scanner) (models.AuditEntry, error) {
+	var e models.AuditEntry
+	var changes []byte
+	if err := row.Scan(&e.ID, &e.SubscriptionID, &e.Action, &e.Actor, &e.RequestID, &changes, &e.At); err != nil {
+		return e, err
+	}
+	e.At = e.At.UTC()
+	return e, json.Unmarshal(changes, &e.Changes)
+}
+
+// auditEntries runs a query selecting auditColumns.
+func (r *sqlRepo) auditEntries(ctx context.Context, query string, args ...interface{}) ([]models.AuditEntry, error) {
+	rows, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *sqlRepo) ListSubscriptionHistory(ctx context.Context, id string) ([]models.AuditEntry, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+	history, err := r.auditEntries(ctx, `
+		SELECT `+auditColumns+`
+		FROM audit_log
+		WHERE subscription_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil || history != nil {
+		return history, err
+	}
+	// Subscriptions stored before the audit log was kept have no entries.
+	var exists int
+	if err := r.queryRow(ctx, `SELECT 1 FROM subscriptions WHERE id = $1`, id).Scan(&exists); err != nil {
+		return nil, r.mapError(err)
+	}
+	return []models.AuditEntry{}, nil
+}
+
+func (r *sqlRepo) ListAuditEntries(ctx context.Context, req models.AuditListRequest) (models.AuditPage, error) {
+	filter, err := parseAuditFilter(req)
+	if err != nil {
+		return models.AuditPage{}, err
+	}
+
+	var args queryArgs
+	where := []string{"TRUE"}
+	if filter.SubscriptionID != nil {
+		where = append(where, "subscription_id = "+args.add(*filter.SubscriptionID))
+	}
+	if filter.Actor != nil {
+		where = append(where, "actor = "+args.add(*filter.Actor))
+	}
+	if filter.Action != nil {
+		where = append(where, "action = "+args.add(*filter.Action))
+	}
+	if filter.RequestID != nil {
+		where = append(where, "request_id = "+args.add(*filter.RequestID))
+	}
+	if filter.from != nil {
+		where = append(where, "created_at >= "+args.add(*filter.from))
+	}
+	if filter.to != nil {
+		where = append(where, "created_at < "+args.add(*filter.to))
+	}
+	if filter.after != 0 {
+		where = append(where, "id < "+args.add(filter.after))
+	}
+
+	entries, err := r.auditEntries(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM audit_log
+		WHERE %s
+		ORDER BY id DESC
+		LIMIT %s
+	`, auditColumns, strings.Join(where, " AND "), args.add(filter.limit+1)), args...)
+	if err != nil {
+		return models.AuditPage{}, err
+	}
+	return auditPage(entries, filter.limit), nil
+}
+
+func (r *sqlRepo) ListExchangeRates(ctx context.Context) ([]models.ExchangeRate, error) {
+	rows, err := r.query(ctx, `
+		SELECT currency, month, rate
+		FROM exchange_rates
+		ORDER BY currency, month
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		var rate models.ExchangeRate
+		var month time.Time
+		if err := rows.Scan(&rate.Currency, &month, &rate.Rate); err != nil {
+			return nil, err
+		}
+		rate.Month = month.Format(monthLayout)
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+func (r *sqlRepo) SetExchangeRates(ctx context.Context, rates []models.ExchangeRate) error {
+	months := make([]time.Time, len(rates))
+	for i, rate := range rates {
+		month, err := parseExchangeRate(rate)
+		if err != nil {
+			return err
+		}
+		months[i] = month
+	}
+
+	return r.inTx(ctx, func(tx *sqlRepo) error {
+		for i, rate := range rates {
+			_, err := tx.exec(ctx, `
+				INSERT INTO exchange_rates (currency, month, rate)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (currency, month) DO UPDATE SET rate = EXCLUDED.rate
+			`, rate.Currency, months[i], rate.Rate)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *sqlRepo) DeleteExchangeRate(ctx context.Context, currency, month string) error {
+	m, err := parseMonth(month)
+	if err != nil {
+		return err
+	}
+	res, err := r.exec(ctx, `DELETE FROM exchange_rates WHERE currency = $1 AND month = $2`, currency, m)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *sqlRepo) AddPriceChange(ctx context.Context, id string, p models.PriceChange) (models.PriceChange, error) {
+	if err := checkID(id); err != nil {
+		return p, err
+	}
+	from, err := normalizePriceChange(&p)
+	if err != nil {
+		return p, err
+	}
+
+	err = r.inTx(ctx, func(tx *sqlRepo) error {
+		var start time.Time
+		var end *time.Time
+		err := tx.queryRow(ctx, `SELECT start_date, end_date FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&start, &end)
+		if err != nil {
+			return tx.mapError(err)
+		}
+		if err := checkPriceChange(start, end, from); err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `
+			INSERT INTO subscription_prices (subscription_id, effective_from, price)
+			VALUES ($1, $2, $3)
+		`, id, from, p.Price)
+		if err != nil {
+			return err
+		}
+		if err := tx.bumpVersion(ctx, id); err != nil {
+			return err
+		}
+		return tx.audit(ctx, id, models.AuditPriceChange, nil, p)
+	})
+	return p, err
+}
+
+func (r *sqlRepo) ListPriceChanges(ctx context.Context, id string) ([]models.PriceChange, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
+	var changes []models.PriceChange
+	err := r.inTx(ctx, func(tx *sqlRepo) error {
+		var exists int
+		query := `SELECT 1 FROM subscriptions WHERE id = $1`
+		if !includeDeleted(ctx) {
+			query += ` AND deleted_at IS NULL`
+		}
+		if err := tx.queryRow(ctx, query, id).Scan(&exists); err != nil {
+			return tx.mapError(err)
+		}
+
+		prices, err := tx.priceChanges(ctx, id)
+		if err != nil {
+			return err
+		}
+		changes = []models.PriceChange{}
+		for _, c := range prices {
+			changes = append(changes, c.model())
+		}
+		return nil
+	})
+	return changes, err
+}
+
+// priceChanges loads the price changes of subscription id, ordered by date.
+func (r *sqlRepo) priceChanges(ctx context.Context, id string) ([]priceChange, error) {
+	rows, err := r.query(ctx, `
+		SELECT effective_from, price
+		FROM subscription_prices
+		WHERE subscription_id = $1
+		ORDER BY effective_from
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []priceChange
+	for rows.Next() {
+		var c priceChange
+		if err := rows.Scan(&c.from, &c.price); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+func (r *sqlRepo) PauseSubscription(ctx context.Context, id string, p models.Pause) (models.Subscription, error) {
+	if err := checkID(id); err != nil {
+		return models.Subscription{}, err
+	}
+	added, err := normalizePause(&p)
+	if err != nil {
+		return models.Subscription{}, err
+	}
+
+	return r.changePauses(ctx, id, models.AuditPause, func(start time.Time, end *time.Time, pauses []pause) ([]pause, error) {
+		return addPause(pauses, start, end, added)
+	})
+}
+
+func (r *sqlRepo) ResumeSubscription(ctx context.Context, id, on string) (models.Subscription, error) {
+	if err := checkID(id); err != nil {
+		return models.Subscription{}, err
+	}
+	day, err := parseRange(on)
+	if err != nil {
+		return models.Subscription{}, err
+	}
+
+	return r.changePauses(ctx, id, models.AuditResume, func(_ time.Time, _ *time.Time, pauses []pause) ([]pause, error) {
+		return resumePauses(pauses, day.from)
+	})
+}
+
+// changePauses replaces the pauses of subscription id with those computed by
+// fn from its dates and current pauses, recording the change as action, and
+// returns the subscription. The subscription row stays locked meanwhile so
+// concurrent changes queue up.
+func (r *sqlRepo) changePauses(ctx context.Context, id, action string, fn func(start time.Time, end *time.Time, pauses []pause) ([]pause, error)) (models.Subscription, error) {
+	var s models.Subscription
+	err := r.inTx(ctx, func(tx *sqlRepo) error {
+		var start time.Time
+		var end *time.Time
+		err := tx.queryRow(ctx, `SELECT start_date, end_date FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`+tx.d.forUpdate, id).Scan(&start, &end)
+		if err != nil {
+			return tx.mapError(err)
+		}
+		before, err := tx.GetSubscriptionByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		current, err := tx.pausesWhere(ctx, "id = $1", id)
+		if err != nil {
+			return err
+		}
+		pauses, err := fn(start, end, current[id])
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.exec(ctx, `DELETE FROM subscription_pauses WHERE subscription_id = $1`, id); err != nil {
+			return err
+		}
+		for _, p := range pauses {
+			_, err := tx.exec(ctx, `
+				INSERT INTO subscription_pauses (subscription_id, paused_from, paused_to)
+				VALUES ($1, $2, $3)
+			`, id, p.from, p.to)
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.bumpVersion(ctx, id); err != nil {
+			return err
+		}
+
+		s, err = tx.GetSubscriptionByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return tx.audit(ctx, id, action, before, s)
+	})
+	return s, err
+}
+
+// serviceColumns lists the columns scanService reads, in order.
+const serviceColumns = `id, name, category, default_price, default_currency, homepage`
+
+func scanService(row scanner) (models.Service, error) {
+	var svc models.Service
+	err := row.Scan(&svc.ID, &svc.Name, &svc.Category, &svc.DefaultPrice, &svc.DefaultCurrency, &svc.Homepage)
+	return svc, err
+}
+
+func (r *sqlRepo) CreateService(ctx context.Context, svc models.Service) (models.Service, error) {
+	svc.ID = uuid.New().String()
+	keys, err := normalizeService(&svc)
+	if err != nil {
+		return svc, err
+	}
+
+	err = r.inTx(ctx, func(tx *sqlRepo) error {
+		_, err := tx.exec(ctx, `
+			INSERT INTO services (`+serviceColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, svc.ID, svc.Name, svc.Category, svc.DefaultPrice, svc.DefaultCurrency, svc.Homepage)
+		if err != nil {
+			return err
+		}
+		return tx.insertAliases(ctx, svc, keys)
+	})
+	return svc, err
+}
+
+// insertAliases stores the keys normalizeService returned for svc, along
+// with the names they were folded from.
+func (r *sqlRepo) insertAliases(ctx context.Context, svc models.Service, keys []string) error {
+	names := append([]string{svc.Name}, svc.Aliases...)
+	for i, key := range keys {
+		_, err := r.exec(ctx, `
+			INSERT INTO service_aliases (alias_key, service_id, alias, position)
+			VALUES ($1, $2, $3, $4)
+		`, key, svc.ID, names[i], i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aliasesWhere loads the aliases of the services matching where, keyed by
+// service id and in the order they were given.
+func (r *sqlRepo) aliasesWhere(ctx context.Context, where string, args ...interface{}) (map[string][]string, error) {
+	rows, err := r.query(ctx, `
+		SELECT service_id, alias
+		FROM service_aliases
+		WHERE position > 0 AND service_id IN (SELECT id FROM services WHERE `+where+`)
+		ORDER BY service_id, position
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := make(map[string][]string)
+	for rows.Next() {
+		var id, alias string
+		if err := rows.Scan(&id, &alias); err != nil {
+			return nil, err
+		}
+		aliases[id] = append(aliases[id], alias)
+	}
+	return aliases, rows.Err()
+}
+
+func (r *sqlRepo) ListServices(ctx context.Context) ([]models.Service, error) {
+	var services []models.Service
+	err := r.inTx(ctx, func(tx *sqlRepo) error {
+		rows, err := tx.query(ctx, `SELECT `+serviceColumns+` FROM services ORDER BY name, id`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		services = []models.Service{}
+		for rows.Next() {
+			svc, err := scanService(rows)
+			if err != nil {
+				return err
+			}
+			services = append(services, svc)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		aliases, err := tx.aliasesWhere(ctx, "TRUE")
+		if err != nil {
+			return err
+		}
+		for i := range services {
+			services[i].Aliases = append([]string{}, aliases[services[i].ID]...)
+		}
+		return nil
+	})
+	return services, err
+}
+
+func (r *sqlRepo) GetServiceByID(ctx context.Context, id string) (models.Service, error) {
+	if err := checkID(id); err != nil {
+		return models.Service{}, err
+	}
+
+	svc, err := scanService(r.queryRow(ctx, `SELECT `+serviceColumns+` FROM services WHERE id = $1`, id))
+	if err != nil {
+		return svc, r.mapError(err)
+	}
+	aliases, err := r.aliasesWhere(ctx, "id = $1", id)
+	if err != nil {
+		return svc, err
+	}
+	svc.Aliases = append([]string{}, aliases[id]...)
+	return svc, nil
+}
+
+func (r *sqlRepo) UpdateService(ctx context.Context, svc models.Service) (models.Service, error) {
+	if err := checkID(svc.ID); err != nil {
+		return svc, err
+	}
+	keys, err := normalizeService(&svc)
+	if err != nil {
+		return svc, err
+	}
+
+	err = r.inTx(ctx, func(tx *sqlRepo) error {
+		res, err := tx.exec(ctx, `
+			UPDATE services
+			SET name=$1, category=$2, default_price=$3, default_currency=$4, homepage=$5
+			WHERE id=$6
+		`, svc.Name, svc.Category, svc.DefaultPrice, svc.DefaultCurrency, svc.Homepage, svc.ID)
+		if err != nil {
+			return err
+		}
+		if err := expectAffected(res); err != nil {
+			return err
+		}
+
+		if _, err := tx.exec(ctx, `DELETE FROM service_aliases WHERE service_id = $1`, svc.ID); err != nil {
+			return err
+		}
+		if err := tx.insertAliases(ctx, svc, keys); err != nil {
+			return err
+		}
+		// Deleted subscriptions cannot change; they keep the old name.
+		renamed, err := tx.linkedSubscriptions(ctx, `service_id = $1 AND service_name <> $2 AND deleted_at IS NULL`, svc.ID, svc.Name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec(ctx, `
+			UPDATE subscriptions
+			SET service_name = $1, version = version + 1
+			WHERE service_id = $2 AND service_name <> $1 AND deleted_at IS NULL
+		`, svc.Name, svc.ID)
+		if err != nil {
+			return err
+		}
+		return tx.auditReloaded(ctx, renamed)
+	})
+	return svc, err
+}
+
+func (r *sqlRepo) DeleteService(ctx context.Context, id string) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+	return r.inTx(ctx, func(tx *sqlRepo) error {
+		// The subscriptions lose their service_id, which is a change too.
+		// Deleted ones are no exception: they cannot refer to a missing entry.
+		unlinked, err := tx.linkedSubscriptions(ctx, `service_id = $1`, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.exec(ctx, `UPDATE subscriptions SET version = version + 1 WHERE service_id = $1`, id); err != nil {
+			return err
+		}
+		res, err := tx.exec(ctx, `DELETE FROM services WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		if err := expectAffected(res); err != nil {
+			return err
+		}
+		return tx.auditReloaded(ctx, unlinked)
+	})
+}
+
+// auditReloaded records an update of each of the subscriptions changed by a
+// catalog change, loading them again to audit them as they are now stored.
+func (r *sqlRepo) auditReloaded(ctx context.Context, changed []models.Subscription) error {
+	if len(changed) == 0 {
+		return nil
+	}
+	var args queryArgs
+	ids := make([]string, len(changed))
+	for i, s := range changed {
+		ids[i] = args.add(s.ID)
+	}
+	reloaded, err := r.linkedSubscriptions(ctx, "id IN ("+strings.Join(ids, ", ")+")", args...)
+	if err != nil {
+		return err
+	}
+	// Both lists are ordered by id.
+	for i, after := range reloaded {
+		if err := r.audit(ctx, after.ID, models.AuditUpdate, changed[i], after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkedSubscriptions loads the subscriptions matching where, which refers
+// to its arguments as $1 and on, with their details and locks their rows
+// until the transaction ends. It is meant for the subscriptions a catalog
+// change applies to.
+func (r *sqlRepo) linkedSubscriptions(ctx context.Context, where string, args ...interface{}) ([]models.Subscription, error) {
+	rows, err := r.query(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE `+where+` ORDER BY id`+r.d.forUpdate, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var subs []models.Subscription
+	for rows.Next() {
+		s, _, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Release the connection before querying again; SQLite has only one.
+	rows.Close()
+	return subs, r.attachDetails(ctx, subs)
+}
+
+// expectAffected reports ErrNotFound when a statement matched no rows.
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteRepo stores subscriptions in an SQLite database. It runs the same
+// queries as PostgresRepo, so summaries and listings behave identically.
+//
+// The connection must write times in a sortable format (`_time_format=sqlite`
+// in the DSN) because dates are stored as text and compared as strings.
+type SQLiteRepo struct {
+	*sqlRepo
+}
+
+func NewSQLiteRepo(db *sql.DB) *SQLiteRepo {
+	return &SQLiteRepo{&sqlRepo{db: db, d: sqliteDialect}}
+}
+
+// placeholderRe matches the PostgreSQL-style $N placeholders used in queries.
+var placeholderRe = regexp.MustCompile(`\$(\d+)`)
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("unicode_lower", 1, unicodeLower)
+}
+
+// unicodeLower lowers the case of a text argument like strings.ToLower. The
+// built-in lower and LIKE only fold ASCII letters.
+func unicodeLower(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	switch v := args[0].(type) {
+	case string:
+		return strings.ToLower(v), nil
+	case []byte:
+		return strings.ToLower(string(v)), nil
+	}
+	return args[0], nil
+}
+
+var sqliteDialect = dialect{
+	ilike: func(column, pattern string) string {
+		return "unicode_lower(" + column + ") LIKE unicode_lower(" + pattern + ")"
+	},
+	// The default BINARY collation already orders text by its bytes.
+	bytewise: "",
+	rebind: func(query string) string {
+		return placeholderRe.ReplaceAllString(query, "?$1")
+	},
+	mapError: mapSQLiteError,
+}
+
+func mapSQLiteError(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	switch code := sqliteErr.Code(); {
+	case code == sqlite3.SQLITE_CONSTRAINT_UNIQUE, code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case code&0xff == sqlite3.SQLITE_CONSTRAINT:
+		return fmt.Errorf("%w: %w", ErrConstraint, err)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/google/uuid"
+	"github.com/pressly/goose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteRepo_Conformance(t *testing.T) {
+	runConformance(t, func(t *testing.T) Repository {
+		return newSQLiteRepo(t)
+	})
+}
+
+// TestSQLiteRepo_HistoryWithoutEntries covers subscriptions stored before the
+// audit log was kept.
+func TestSQLiteRepo_HistoryWithoutEntries(t *testing.T) {
+	r := newSQLiteRepo(t)
+	ctx := context.Background()
+	s := mustCreate(t, r, newSub(uuid.NewString(), "Netflix", 999, "01-2024", nil))
+	_, err := r.db.ExecContext(ctx, `DELETE FROM audit_log`)
+	require.NoError(t, err)
+
+	history, err := r.ListSubscriptionHistory(ctx, s.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []models.AuditEntry{}, history)
+	_, err = r.ListSubscriptionHistory(ctx, uuid.NewString())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func newSQLiteRepo(t *testing.T) *SQLiteRepo {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "subs.db") + "?_time_format=sqlite&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	conn, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+
+	require.NoError(t, goose.SetDialect("sqlite3"))
+	require.NoError(t, goose.Up(conn, "../../migrations/sqlite"))
+	return NewSQLiteRepo(conn)
+}
@@ -0,0 +1,316 @@
+package repo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/dates"
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+var errInvalidPeriod = fmt.Errorf("%w: from must not be after to", ErrInvalidDate)
+
+// costEntry is a subscription reduced to the fields the summary needs.
+type costEntry struct {
+	serviceName string
+	userID      string
+	category    string
+	tags        []string
+	price       int
+	currency    string
+	rate        monthlyRate
+	start       time.Time
+	end         *time.Time
+	// prices are the later price changes, ordered by date.
+	prices []priceChange
+	// pauses are the days the entry is not charged for, ordered by date.
+	pauses []pause
+	// trialEnd is the last free day, and intro the price that follows it.
+	trialEnd *time.Time
+	intro    *introPrice
+}
+
+// groupKey identifies one summary group. Fields that are not grouped by stay
+// at their zero value so that all entries collapse into the same group.
+type groupKey struct {
+	serviceName string
+	userID      string
+	currency    string
+	month       int
+	category    string
+	tag         string
+}
+
+// grouping records which fields the summary is grouped by.
+type grouping struct {
+	fields                                        []string
+	service, user, currency, month, category, tag bool
+}
+
+func newGrouping(groupBy []string) grouping {
+	g := grouping{fields: groupBy}
+	for _, f := range groupBy {
+		switch f {
+		case models.GroupByServiceName:
+			g.service = true
+		case models.GroupByUserID:
+			g.user = true
+		case models.GroupByCurrency:
+			g.currency = true
+		case models.GroupByMonth:
+			g.month = true
+		case models.GroupByCategory:
+			g.category = true
+		case models.GroupByTag:
+			g.tag = true
+		}
+	}
+	return g
+}
+
+// keys returns the groups the cost of e in month m belongs to. Grouped by
+// tag, an entry belongs to the group of each of its tags, or to the one of
+// the empty tag if it has none.
+func (g grouping) keys(e costEntry, m int) []groupKey {
+	var key groupKey
+	if g.service {
+		key.serviceName = e.serviceName
+	}
+	if g.user {
+		key.userID = e.userID
+	}
+	if g.currency {
+		key.currency = e.currency
+	}
+	if g.month {
+		key.month = m
+	}
+	if g.category {
+		key.category = e.category
+	}
+	if !g.tag || len(e.tags) == 0 {
+		return []groupKey{key}
+	}
+	keys := make([]groupKey, len(e.tags))
+	for i, tag := range e.tags {
+		key.tag = tag
+		keys[i] = key
+	}
+	return keys
+}
+
+// monthIndex maps a date to a month counter so month ranges can be compared
+// and iterated without dealing with day-of-month details.
+func monthIndex(t time.Time) int {
+	return t.Year()*12 + int(t.Month()) - 1
+}
+
+func monthFromIndex(idx int) time.Time {
+	return time.Date(idx/12, time.Month(idx%12+1), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func formatMonthIndex(idx int) string {
+	return monthFromIndex(idx).Format(monthLayout)
+}
+
+// monthCost returns what the entry costs in month m within the period. A
+// month the entry or the period covers only partly, or that is partly paused,
+// is charged for its share of days, and a month is split wherever the price
+// changes, including at the end of a trial or intro period.
+func (e costEntry) monthCost(period dateRange, m int) int {
+	monthStart := monthFromIndex(m)
+	monthEnd := dates.EndOfMonth(monthStart)
+	inMonth := monthEnd.Day()
+	n := m - monthIndex(e.start)
+
+	from := latest(monthStart, e.start, period.from)
+	to := earliest(monthEnd, period.to)
+	if e.end != nil {
+		to = earliest(to, *e.end)
+	}
+	if to.Before(from) {
+		return 0
+	}
+
+	cost := 0
+	for {
+		price, next := e.priceOn(from)
+		if next.IsZero() || next.After(to) {
+			return cost + prorate(e.rate.charge(price, n), e.activeDays(from, to), inMonth)
+		}
+		cost += prorate(e.rate.charge(price, n), e.activeDays(from, next.AddDate(0, 0, -1)), inMonth)
+		from = next
+	}
+}
+
+// activeDays counts the days from..to, both included, outside of pauses.
+func (e costEntry) activeDays(from, to time.Time) int {
+	return daysBetween(from, to) + 1 - pausedDays(e.pauses, from, to)
+}
+
+// priceOn returns the price in effect on day together with the next day the
+// price changes, or the zero time if it stays the same from then on. Trial
+// days are free and the intro price precedes any regular price.
+func (e costEntry) priceOn(day time.Time) (int, time.Time) {
+	if e.trialEnd != nil && !day.After(*e.trialEnd) {
+		return 0, e.trialEnd.AddDate(0, 0, 1)
+	}
+	if e.intro != nil && day.Before(e.intro.until) {
+		return e.intro.price, e.intro.until
+	}
+	price := e.price
+	for _, c := range e.prices {
+		if c.from.After(day) {
+			return price, c.from
+		}
+		price = c.price
+	}
+	return price, time.Time{}
+}
+
+// prorate charges the share of a monthly cost that falls on the active days.
+func prorate(cost, days, inMonth int) int {
+	if days == inMonth {
+		return cost
+	}
+	return (cost*days + inMonth/2) / inMonth
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
+
+func latest(t time.Time, others ...time.Time) time.Time {
+	for _, o := range others {
+		if o.After(t) {
+			t = o
+		}
+	}
+	return t
+}
+
+func earliest(t time.Time, others ...time.Time) time.Time {
+	for _, o := range others {
+		if o.Before(t) {
+			t = o
+		}
+	}
+	return t
+}
+
+// summarize charges every entry its price, normalized to a month, for each
+// month it is active within the period. Months are counted from the entry's
+// start so that a yearly price is spread evenly over its billing year, and a
+// month the entry or the period covers only partly is charged for its share
+// of days. Paused and trial days are not charged. Costs are converted with
+// conv unless it is nil. It returns the per-month totals along with the
+// subtotals for the requested grouping; subtotals by tag overlap when entries
+// have several tags.
+func summarize(entries []costEntry, period dateRange, groupBy []string, conv *converter) (models.SubscriptionSummary, error) {
+	if period.from.After(period.to) {
+		return models.SubscriptionSummary{}, errInvalidPeriod
+	}
+	first, last := monthIndex(period.from), monthIndex(period.to)
+
+	grouping := newGrouping(groupBy)
+	totals := make([]int, last-first+1)
+	groups := make(map[groupKey]int)
+	for _, e := range entries {
+		lo := max(monthIndex(e.start), first)
+		hi := last
+		if e.end != nil {
+			hi = min(monthIndex(*e.end), last)
+		}
+		for m := lo; m <= hi; m++ {
+			cost, err := conv.convert(e.monthCost(period, m), e.currency, m)
+			if err != nil {
+				return models.SubscriptionSummary{}, err
+			}
+			totals[m-first] += cost
+
+			if len(groupBy) > 0 {
+				for _, key := range grouping.keys(e, m) {
+					groups[key] += cost
+				}
+			}
+		}
+	}
+
+	summary := models.SubscriptionSummary{Months: make([]models.MonthlyCost, 0, len(totals))}
+	for i, total := range totals {
+		summary.Total += total
+		summary.Months = append(summary.Months, models.MonthlyCost{
+			Month: formatMonthIndex(first + i),
+			Total: total,
+		})
+	}
+
+	if len(groupBy) > 0 {
+		summary.Groups = buildGroups(groups, grouping)
+	}
+	if conv != nil {
+		summary.Currency = &conv.target
+	}
+	return summary, nil
+}
+
+// buildGroups turns the aggregated subtotals into response rows ordered by the
+// group_by fields in the order they were requested.
+func buildGroups(groups map[groupKey]int, grouping grouping) []models.SummaryGroup {
+	keys := make([]groupKey, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		for _, g := range grouping.fields {
+			switch {
+			case g == models.GroupByServiceName && a.serviceName != b.serviceName:
+				return a.serviceName < b.serviceName
+			case g == models.GroupByUserID && a.userID != b.userID:
+				return a.userID < b.userID
+			case g == models.GroupByCurrency && a.currency != b.currency:
+				return a.currency < b.currency
+			case g == models.GroupByMonth && a.month != b.month:
+				return a.month < b.month
+			case g == models.GroupByCategory && a.category != b.category:
+				return a.category < b.category
+			case g == models.GroupByTag && a.tag != b.tag:
+				return a.tag < b.tag
+			}
+		}
+		return false
+	})
+
+	result := make([]models.SummaryGroup, 0, len(keys))
+	for _, k := range keys {
+		g := models.SummaryGroup{Total: groups[k]}
+		if grouping.service {
+			name := k.serviceName
+			g.ServiceName = &name
+		}
+		if grouping.user {
+			userID := k.userID
+			g.UserID = &userID
+		}
+		if grouping.currency {
+			currency := k.currency
+			g.Currency = &currency
+		}
+		if grouping.month {
+			month := formatMonthIndex(k.month)
+			g.Month = &month
+		}
+		if grouping.category {
+			category := k.category
+			g.Category = &category
+		}
+		if grouping.tag {
+			tag := k.tag
+			g.Tag = &tag
+		}
+		result = append(result, g)
+	}
+	return result
+}
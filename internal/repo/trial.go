@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/dates"
+	"github.com/MosinFAM/subs-app/internal/models"
+)
+
+// introPrice is the price charged from the end of the trial, or from the
+// start without one, until the regular price kicks in.
+type introPrice struct {
+	price int
+	// until is the first day of the regular price.
+	until time.Time
+}
+
+// normalizeTrial parses the trial end date of a subscription starting on
+// start, rewriting it as an ISO date, and checks its intro pricing. A trial
+// end month means the trial lasts until the last day of that month.
+func normalizeTrial(s *models.Subscription, start time.Time) (*time.Time, error) {
+	if (s.IntroPrice == nil) != (s.IntroMonths == nil) {
+		return nil, fmt.Errorf("%w: intro_price and intro_months must be given together", ErrInvalidInput)
+	}
+	if s.IntroPrice != nil && (*s.IntroPrice < 0 || *s.IntroMonths <= 0) {
+		return nil, fmt.Errorf("%w: intro_price must not be negative and intro_months must be positive", ErrInvalidInput)
+	}
+	if s.TrialEndDate == nil {
+		return nil, nil
+	}
+	trialEnd, err := dates.ParseEnd(*s.TrialEndDate)
+	if err != nil {
+		return nil, invalidDate(*s.TrialEndDate)
+	}
+	if trialEnd.Before(start) {
+		return nil, fmt.Errorf("%w: trial_end_date must not be before start_date", ErrInvalidInput)
+	}
+	formatted := trialEnd.Format(dateLayout)
+	s.TrialEndDate = &formatted
+	return &trialEnd, nil
+}
+
+// setTrial makes the entry free until trialEnd and then charges introPrice
+// per billing period for introMonths, if given, before its regular prices.
+func (e *costEntry) setTrial(trialEnd *time.Time, price, months *int) {
+	e.trialEnd = trialEnd
+	if price == nil || months == nil {
+		return
+	}
+	from := e.start
+	if trialEnd != nil {
+		from = trialEnd.AddDate(0, 0, 1)
+	}
+	e.intro = &introPrice{price: *price, until: dates.AddMonths(from, *months)}
+}
+
+// trialWindow returns the days from today through today+days, on which a
+// trial must end to match the trial_ends_within filter.
+func trialWindow(days *int) *dateRange {
+	if days == nil {
+		return nil
+	}
+	today := dates.Today()
+	return &dateRange{from: today, to: today.AddDate(0, 0, *days)}
+}
@@ -0,0 +1,25 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+)
+
+type expectedVersionKey struct{}
+
+// WithExpectedVersion returns a context under which UpdateSubscription and
+// DeleteSubscription fail with ErrVersionMismatch unless the subscription is
+// still at version.
+func WithExpectedVersion(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, version)
+}
+
+// checkVersion reports ErrVersionMismatch when ctx expects a version other
+// than current.
+func checkVersion(ctx context.Context, current int) error {
+	expected, ok := ctx.Value(expectedVersionKey{}).(int)
+	if ok && expected != current {
+		return fmt.Errorf("%w: expected version %d, found %d", ErrVersionMismatch, expected, current)
+	}
+	return nil
+}
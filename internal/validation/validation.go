@@ -0,0 +1,253 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MosinFAM/subs-app/internal/dates"
+	"github.com/MosinFAM/subs-app/internal/models"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	once     sync.Once
+	validate *validator.Validate
+)
+
+func instance() *validator.Validate {
+	once.Do(func() {
+		validate = validator.New(validator.WithRequiredStructEnabled())
+		validate.RegisterTagNameFunc(jsonName)
+		_ = validate.RegisterValidation("notblank", notBlank)
+		_ = validate.RegisterValidation("month_year", monthYear)
+		_ = validate.RegisterValidation("date", date)
+		validate.RegisterStructValidation(subscriptionRules, models.Subscription{})
+		validate.RegisterStructValidation(pauseRules, models.Pause{})
+		validate.RegisterStructValidation(batchOperationRules, models.BatchOperation{})
+	})
+	return validate
+}
+
+// Struct checks v against its `validate` tags and returns the violations as
+// a per-field list, or nil when v is valid.
+func Struct(v interface{}) []models.FieldError {
+	err := instance().Struct(v)
+	if err == nil {
+		return nil
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return []models.FieldError{{Code: "invalid", Message: err.Error()}}
+	}
+
+	fields := make([]models.FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		// The namespace names nested fields by their path, like
+		// subscription.price, after the name of v itself.
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		fields = append(fields, models.FieldError{
+			Field:   field,
+			Code:    fe.Tag(),
+			Message: message(fe),
+		})
+	}
+	return fields
+}
+
+// Currency reports whether code is an ISO 4217 currency code.
+func Currency(code string) bool {
+	return instance().Var(code, "iso4217") == nil
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "notblank":
+		return "must not be empty"
+	case "uuid":
+		return "must be a valid UUID"
+	case "max":
+		if fe.Kind() == reflect.Slice {
+			return "must have at most " + fe.Param() + " items"
+		}
+		return "must be at most " + fe.Param() + " characters long"
+	case "min":
+		if fe.Kind() == reflect.Slice {
+			return "must have at least " + fe.Param() + " items"
+		}
+		return "must be at least " + fe.Param() + " characters long"
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "iso4217":
+		return "must be an ISO 4217 currency code"
+	case "month_year":
+		return "must be a date in MM-YYYY format"
+	case "date":
+		return "must be a date in YYYY-MM-DD or MM-YYYY format"
+	case "gtefield":
+		return "must not be before " + fe.Param()
+	case "required_if":
+		return "is required when billing_period is custom"
+	case "excluded_unless":
+		return "is only allowed when billing_period is custom"
+	case "required_without":
+		return "is required when " + fe.Param() + " is not given"
+	case "url":
+		return "must be a valid URL"
+	case "excludesall":
+		return "must not contain any of " + strconv.Quote(fe.Param())
+	case "required_with":
+		return "is required together with " + fe.Param()
+	default:
+		return "is invalid"
+	}
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func notBlank(fl validator.FieldLevel) bool {
+	return strings.TrimSpace(fl.Field().String()) != ""
+}
+
+func monthYear(fl validator.FieldLevel) bool {
+	_, err := time.Parse(dates.MonthLayout, fl.Field().String())
+	return err == nil
+}
+
+func date(fl validator.FieldLevel) bool {
+	_, _, err := dates.Parse(fl.Field().String())
+	return err == nil
+}
+
+// subscriptionRules checks the constraints that span several fields of a
+// subscription.
+func subscriptionRules(sl validator.StructLevel) {
+	s := sl.Current().Interface().(models.Subscription)
+	subscriptionService(sl, s)
+	subscriptionDates(sl, s)
+	subscriptionBilling(sl, s)
+	subscriptionTrial(sl, s)
+}
+
+// subscriptionService requires service_name and price unless the
+// subscription refers to a catalog entry, which provides them.
+func subscriptionService(sl validator.StructLevel, s models.Subscription) {
+	if s.ServiceID != nil {
+		return
+	}
+	if s.ServiceName == "" {
+		sl.ReportError(s.ServiceName, "service_name", "ServiceName", "required_without", "service_id")
+	}
+	if s.Price == 0 {
+		sl.ReportError(s.Price, "price", "Price", "required_without", "service_id")
+	}
+}
+
+// subscriptionDates rejects an end_date earlier than start_date. Malformed
+// dates are left to the date rule.
+func subscriptionDates(sl validator.StructLevel, s models.Subscription) {
+	if s.EndDate == nil {
+		return
+	}
+	start, err := dates.ParseStart(s.StartDate)
+	if err != nil {
+		return
+	}
+	end, err := dates.ParseEnd(*s.EndDate)
+	if err != nil {
+		return
+	}
+	if end.Before(start) {
+		sl.ReportError(s.EndDate, "end_date", "EndDate", "gtefield", "start_date")
+	}
+}
+
+// subscriptionBilling requires billing_months for custom billing periods and
+// rejects it for the others.
+func subscriptionBilling(sl validator.StructLevel, s models.Subscription) {
+	custom := s.BillingPeriod == models.BillingCustom
+	switch {
+	case custom && s.BillingMonths == nil:
+		sl.ReportError(s.BillingMonths, "billing_months", "BillingMonths", "required_if", "")
+	case !custom && s.BillingMonths != nil:
+		sl.ReportError(s.BillingMonths, "billing_months", "BillingMonths", "excluded_unless", "")
+	}
+}
+
+// subscriptionTrial rejects a trial ending before start_date and requires
+// intro_price and intro_months to be given together.
+func subscriptionTrial(sl validator.StructLevel, s models.Subscription) {
+	switch {
+	case s.IntroPrice != nil && s.IntroMonths == nil:
+		sl.ReportError(s.IntroMonths, "intro_months", "IntroMonths", "required_with", "intro_price")
+	case s.IntroPrice == nil && s.IntroMonths != nil:
+		sl.ReportError(s.IntroPrice, "intro_price", "IntroPrice", "required_with", "intro_months")
+	}
+
+	if s.TrialEndDate == nil {
+		return
+	}
+	start, err := dates.ParseStart(s.StartDate)
+	if err != nil {
+		return
+	}
+	trialEnd, err := dates.ParseEnd(*s.TrialEndDate)
+	if err != nil {
+		return
+	}
+	if trialEnd.Before(start) {
+		sl.ReportError(s.TrialEndDate, "trial_end_date", "TrialEndDate", "gtefield", "start_date")
+	}
+}
+
+// pauseRules rejects a pause that ends before it starts.
+func pauseRules(sl validator.StructLevel) {
+	p := sl.Current().Interface().(models.Pause)
+	if p.To == nil {
+		return
+	}
+	from, err := dates.ParseStart(p.From)
+	if err != nil {
+		return
+	}
+	to, err := dates.ParseEnd(*p.To)
+	if err != nil {
+		return
+	}
+	if to.Before(from) {
+		sl.ReportError(p.To, "to", "To", "gtefield", "from")
+	}
+}
+
+// batchOperationRules requires the subscription data of creates and updates
+// and the ID of updates and deletes.
+func batchOperationRules(sl validator.StructLevel) {
+	op := sl.Current().Interface().(models.BatchOperation)
+	needsSubscription := op.Op == models.BatchCreate || op.Op == models.BatchUpdate
+	needsID := op.Op == models.BatchUpdate || op.Op == models.BatchDelete
+	if needsSubscription && op.Subscription == nil {
+		sl.ReportError(op.Subscription, "subscription", "Subscription", "required", "")
+	}
+	if needsID && op.ID == "" {
+		sl.ReportError(op.ID, "id", "ID", "required", "")
+	}
+}
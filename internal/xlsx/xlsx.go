@@ -0,0 +1,127 @@
+// Package xlsx writes single-sheet Office Open XML (XLSX) workbooks a row at
+// a time, so that the sheet is never held in memory.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const contentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
+
+const workbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const sheetStart = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const sheetEnd = `</sheetData></worksheet>`
+
+// Writer writes the rows of a sheet. Its methods must not be called after
+// one of them returned an error.
+type Writer struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+// NewWriter starts a workbook with a single sheet of the given name on w.
+func NewWriter(w io.Writer, sheet string) (*Writer, error) {
+	zw := zip.NewWriter(w)
+	var name strings.Builder
+	if err := xml.EscapeText(&name, []byte(sheet)); err != nil {
+		return nil, err
+	}
+	parts := []struct{ path, content string }{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", fmt.Sprintf(workbook, name.String())},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+	}
+	for _, p := range parts {
+		f, err := zw.Create(p.path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.content); err != nil {
+			return nil, err
+		}
+	}
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sw := bufio.NewWriter(f)
+	if _, err := sw.WriteString(sheetStart); err != nil {
+		return nil, err
+	}
+	return &Writer{zip: zw, sheet: sw}, nil
+}
+
+// WriteRow appends a row. Integers become numbers, nil leaves the cell empty
+// and anything else is written as text.
+func (w *Writer) WriteRow(cells ...any) error {
+	w.rows++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.rows)
+	for i, cell := range cells {
+		ref := column(i) + strconv.Itoa(w.rows)
+		switch v := cell.(type) {
+		case nil:
+			continue
+		case int:
+			fmt.Fprintf(w.sheet, `<c r="%s"><v>%d</v></c>`, ref, v)
+		default:
+			text := fmt.Sprint(v)
+			space := ""
+			if strings.TrimSpace(text) != text {
+				space = ` xml:space="preserve"`
+			}
+			fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"><is><t%s>`, ref, space)
+			if err := xml.EscapeText(w.sheet, []byte(text)); err != nil {
+				return err
+			}
+			w.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := w.sheet.WriteString(`</row>`)
+	return err
+}
+
+// Close finishes the sheet and the workbook. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if _, err := w.sheet.WriteString(sheetEnd); err != nil {
+		return err
+	}
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+// column returns the letters naming the column with zero-based index i.
+func column(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE subscriptions
+    ADD COLUMN billing_period TEXT NOT NULL DEFAULT 'monthly'
+        CHECK (billing_period IN ('weekly', 'monthly', 'quarterly', 'yearly', 'custom')),
+    ADD COLUMN billing_months INTEGER CHECK (billing_months > 0),
+    ADD CONSTRAINT subscriptions_custom_billing_months
+        CHECK ((billing_period = 'custom') = (billing_months IS NOT NULL));
+
+-- +goose Down
+ALTER TABLE subscriptions
+    DROP COLUMN billing_months,
+    DROP COLUMN billing_period;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- End months used to be stored as their first day; the end date is now the
+-- last day the subscription is active.
+UPDATE subscriptions
+SET end_date = (date_trunc('month', end_date) + INTERVAL '1 month - 1 day')::date
+WHERE end_date IS NOT NULL;
+
+-- +goose Down
+UPDATE subscriptions
+SET start_date = date_trunc('month', start_date)::date,
+    end_date = date_trunc('month', end_date)::date;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE subscriptions
+    ADD COLUMN trial_end_date DATE,
+    ADD COLUMN intro_price INTEGER CHECK (intro_price >= 0),
+    ADD COLUMN intro_months INTEGER CHECK (intro_months > 0),
+    ADD CONSTRAINT subscriptions_trial_after_start
+        CHECK (trial_end_date >= start_date),
+    ADD CONSTRAINT subscriptions_intro_complete
+        CHECK ((intro_price IS NULL) = (intro_months IS NULL));
+
+-- +goose Down
+ALTER TABLE subscriptions
+    DROP COLUMN intro_months,
+    DROP COLUMN intro_price,
+    DROP COLUMN trial_end_date;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS services (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    category TEXT NOT NULL DEFAULT '',
+    default_price INTEGER CHECK (default_price > 0),
+    default_currency TEXT NOT NULL DEFAULT '',
+    homepage TEXT NOT NULL DEFAULT ''
+);
+
+-- Every service is matched by its folded name (position 0) and aliases.
+CREATE TABLE IF NOT EXISTS service_aliases (
+    alias_key TEXT PRIMARY KEY,
+    service_id UUID NOT NULL REFERENCES services (id) ON DELETE CASCADE,
+    alias TEXT NOT NULL,
+    position INTEGER NOT NULL
+);
+
+ALTER TABLE subscriptions ADD COLUMN service_id UUID REFERENCES services (id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE subscriptions DROP COLUMN service_id;
+DROP TABLE IF EXISTS service_aliases;
+DROP TABLE IF EXISTS services;
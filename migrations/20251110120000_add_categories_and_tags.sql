@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE subscriptions ADD COLUMN category TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS subscription_tags (
+    subscription_id UUID NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (subscription_id, tag)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS subscription_tags;
+ALTER TABLE subscriptions DROP COLUMN category;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id TEXT PRIMARY KEY,
+    service_name TEXT NOT NULL,
+    price INTEGER NOT NULL CHECK (price > 0),
+    user_id TEXT NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS subscriptions;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE subscriptions ADD COLUMN billing_period TEXT NOT NULL DEFAULT 'monthly'
+    CHECK (billing_period IN ('weekly', 'monthly', 'quarterly', 'yearly', 'custom'));
+-- SQLite cannot add table constraints, so the column check covers both rules.
+ALTER TABLE subscriptions ADD COLUMN billing_months INTEGER
+    CHECK ((billing_period = 'custom') = (billing_months IS NOT NULL) AND (billing_months IS NULL OR billing_months > 0));
+
+-- +goose Down
+ALTER TABLE subscriptions DROP COLUMN billing_months;
+ALTER TABLE subscriptions DROP COLUMN billing_period;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE subscriptions ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD'
+    CHECK (length(currency) = 3 AND currency = upper(currency));
+
+-- Units of currency per one USD, effective from month until the next rate.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency TEXT NOT NULL CHECK (length(currency) = 3 AND currency = upper(currency)),
+    month DATE NOT NULL,
+    rate REAL NOT NULL CHECK (rate > 0),
+    PRIMARY KEY (currency, month)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS exchange_rates;
+ALTER TABLE subscriptions DROP COLUMN currency;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- End months used to be stored as their first day; the end date is now the
+-- last day the subscription is active. Dates keep the driver's time format.
+UPDATE subscriptions
+SET end_date = strftime('%Y-%m-%d 00:00:00+00:00', end_date, 'start of month', '+1 month', '-1 day')
+WHERE end_date IS NOT NULL;
+
+-- +goose Down
+UPDATE subscriptions
+SET start_date = strftime('%Y-%m-%d 00:00:00+00:00', start_date, 'start of month'),
+    end_date = strftime('%Y-%m-%d 00:00:00+00:00', end_date, 'start of month');
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS subscription_prices (
+    subscription_id TEXT NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    effective_from DATE NOT NULL,
+    price INTEGER NOT NULL CHECK (price > 0),
+    PRIMARY KEY (subscription_id, effective_from)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS subscription_prices;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS subscription_pauses (
+    subscription_id TEXT NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    paused_from DATE NOT NULL,
+    paused_to DATE CHECK (paused_to >= paused_from),
+    PRIMARY KEY (subscription_id, paused_from)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS subscription_pauses;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQLite cannot add table constraints, so the column checks cover all rules.
+ALTER TABLE subscriptions ADD COLUMN trial_end_date DATE CHECK (trial_end_date >= start_date);
+ALTER TABLE subscriptions ADD COLUMN intro_price INTEGER CHECK (intro_price >= 0);
+ALTER TABLE subscriptions ADD COLUMN intro_months INTEGER
+    CHECK ((intro_price IS NULL) = (intro_months IS NULL) AND (intro_months IS NULL OR intro_months > 0));
+
+-- +goose Down
+ALTER TABLE subscriptions DROP COLUMN intro_months;
+ALTER TABLE subscriptions DROP COLUMN intro_price;
+ALTER TABLE subscriptions DROP COLUMN trial_end_date;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Entries are only ever appended and outlive their subscriptions.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    changes TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_subscription_id_idx ON audit_log (subscription_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Deleted subscriptions are kept until the retention purge removes them.
+ALTER TABLE subscriptions ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS subscriptions_deleted_at_idx ON subscriptions (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS subscriptions_deleted_at_idx;
+ALTER TABLE subscriptions DROP COLUMN deleted_at;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- The version grows with every change and is exposed as the ETag.
+ALTER TABLE subscriptions ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE subscriptions DROP COLUMN version;